@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ActivityCalculation describes how the emissions of a record were calculated from activity data
+// It stores every input of the calculation, so the result can be reproduced later on
+// Alphabetic order to achieve determinism accross languages
+type ActivityCalculation struct {
+	Activity      Quantity `json:"Activity"` // Amount of the activity in the unit of the emission factor
+	ActivityType  string   `json:"ActivityType"`
+	CO2ePerUnit   Quantity `json:"CO2ePerUnit"` // Value of the emission factor version
+	FactorID      string   `json:"FactorID"`
+	FactorVersion int      `json:"FactorVersion"` // Version of the emission factor the record is pinned to
+}
+
+// AuditActivityEmissions calculates the emissions of an activity with the current version of the referenced emission factor,
+// checks the result and adds it to the ledger. The factor must be active and valid at the time of the transaction
+// The activity amount is a decimal with up to 6 decimal places, e.g. 1250.5 kWh
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) AuditActivityEmissions(ctx contractapi.TransactionContextInterface, id string, activityAmount string, activityUnit string, factorID string, scope int, category int, productCategory string, info string) error {
+	factor, err := s.usableEmissionFactor(ctx, factorID)
+	if err != nil {
+		return err
+	}
+
+	calculation, err := newActivityCalculation(activityAmount, activityUnit, factor)
+	if err != nil {
+		return err
+	}
+	co2e, err := calculateActivityEmissions(calculation, factor)
+	if err != nil {
+		return err
+	}
+
+	record := EmissionsRecord{
+		Calculation:     calculation,
+		Category:        category,
+		ID:              id,
+		ProductCategory: productCategory,
+		Scope:           scope,
+	}
+	err = setRecordEmissions(&record, co2e)
+	if err != nil {
+		return err
+	}
+	return s.auditEmissionsRecord(ctx, &record, info)
+}
+
+// VerifyEmissionsCalculation recalculates the emissions of a record from its stored activity data and the
+// pinned emission factor version and returns true if the result matches the emissions stored in the record
+func (s *SmartContract) VerifyEmissionsCalculation(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	record, err := s.GetEmissionsRecord(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if record.Calculation == nil {
+		return false, fmt.Errorf("the emissions record with ID %s was not calculated from activity data", id)
+	}
+
+	factor, err := s.GetEmissionFactor(ctx, record.Calculation.FactorID, record.Calculation.FactorVersion)
+	if err != nil {
+		return false, err
+	}
+	if factor.CO2ePerUnit.Unit != record.Calculation.CO2ePerUnit.Unit {
+		return false, nil
+	}
+	sameFactor, err := factor.CO2ePerUnit.equal(record.Calculation.CO2ePerUnit)
+	if err != nil || !sameFactor {
+		return false, err
+	}
+
+	co2e, err := calculateActivityEmissions(record.Calculation, factor)
+	if err != nil {
+		return false, err
+	}
+	if record.CO2e == nil {
+		return false, fmt.Errorf("the emissions record with ID %s has no exact emissions", id)
+	}
+	return co2e.equal(*record.CO2e)
+}
+
+// HELPER FUNCTION newActivityCalculation checks the activity data and pins it to the given emission factor version
+func newActivityCalculation(activityAmount string, activityUnit string, factor *EmissionFactor) (*ActivityCalculation, error) {
+	activity, err := parseQuantity(activityAmount, activityUnit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid activity amount: %v", err)
+	}
+
+	calculation := ActivityCalculation{
+		Activity:      activity,
+		ActivityType:  factor.ActivityType,
+		CO2ePerUnit:   factor.CO2ePerUnit,
+		FactorID:      factor.ID,
+		FactorVersion: factor.Version,
+	}
+	return &calculation, nil
+}
+
+// HELPER FUNCTION calculateActivityEmissions multiplies the activity data with the emission factor and returns the CO2 equivalents
+// in the unit of the emission factor. Both values are multiplied as exact decimals and the result is rounded half up to quantityDecimals decimal places
+func calculateActivityEmissions(calculation *ActivityCalculation, factor *EmissionFactor) (Quantity, error) {
+	amount, err := calculation.Activity.rat()
+	if err != nil {
+		return Quantity{}, fmt.Errorf("invalid activity amount: %v", err)
+	}
+	if calculation.Activity.Unit != factor.Unit {
+		return Quantity{}, fmt.Errorf("activity data is given in %s, but emission factor %s expects %s", calculation.Activity.Unit, factor.ID, factor.Unit)
+	}
+
+	perUnit, err := factor.CO2ePerUnit.rat()
+	if err != nil {
+		return Quantity{}, fmt.Errorf("invalid emission factor: %v", err)
+	}
+	co2e, err := quantityFromRat(new(big.Rat).Mul(amount, perUnit), factor.CO2ePerUnit.Unit)
+	if err != nil {
+		return Quantity{}, fmt.Errorf("failed to calculate emissions: %v", err)
+	}
+	_, err = wholeKgCO2e(co2e)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return co2e, nil
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const verifierObjectType = "verifier"
+
+// Signature algorithms of verifier keys
+const (
+	AlgorithmECDSA   = "ECDSA"
+	AlgorithmEd25519 = "ED25519"
+)
+
+// Status of a verifier
+const (
+	VerifierActive  = "ACTIVE"  // The verifier can attest emissions
+	VerifierRevoked = "REVOKED" // The key of the verifier is no longer accepted, existing attestations stay valid
+)
+
+// Assurance levels of an attestation as defined by ISAE 3410 and ISO 14064-3
+const (
+	AssuranceLimited    = "LIMITED"
+	AssuranceReasonable = "REASONABLE"
+)
+
+// assuranceRanks orders the assurance levels, an attestation can only be replaced by one with a higher level
+var assuranceRanks = map[string]int{
+	AssuranceLimited:    1,
+	AssuranceReasonable: 2,
+}
+
+// Subjects a verifier can attest
+const (
+	SubjectEmissionsRecord = "EMISSIONS_RECORD"
+	SubjectPeriodInventory = "PERIOD_INVENTORY"
+)
+
+// Verifier describes an independent third party, e.g. an audit firm or a certification body, that attests emissions with its own key
+// Alphabetic order to achieve determinism accross languages
+type Verifier struct {
+	Accreditation string `json:"Accreditation"` // Accreditation of the verifier, e.g. the ISO 14065 accreditation body and number
+	Algorithm     string `json:"Algorithm"`     // ECDSA or ED25519, derived from the public key
+	ID            string `json:"ID"`
+	Name          string `json:"Name"`
+	PublicKey     string `json:"PublicKey"` // PEM encoded PKIX public key the signatures of the verifier are checked against
+	RegisteredAt  string `json:"RegisteredAt"`
+	RegisteredBy  string `json:"RegisteredBy"`
+	RevokedAt     string `json:"RevokedAt,omitempty" metadata:",optional"`
+	Status        string `json:"Status"`
+}
+
+// Attestation describes the signed statement of a verifier on an emissions record or a period inventory
+// Alphabetic order to achieve determinism accross languages
+type Attestation struct {
+	AssuranceLevel string `json:"AssuranceLevel"` // LIMITED or REASONABLE
+	AttestedAt     string `json:"AttestedAt"`
+	Signature      string `json:"Signature"`   // Base64 encoded signature of the verifier over the digest of the statement
+	SubjectHash    string `json:"SubjectHash"` // Hex encoded SHA-256 hash of the canonical JSON of the attested record or inventory
+	SubmittedBy    string `json:"SubmittedBy"`
+	VerifierID     string `json:"VerifierID"`
+	VerifierName   string `json:"VerifierName"`
+}
+
+// AttestationStatement is the statement a verifier signs, its canonical JSON is hashed with SHA-256 to obtain the digest to sign
+// Alphabetic order to achieve determinism accross languages
+type AttestationStatement struct {
+	AssuranceLevel string `json:"AssuranceLevel"`
+	SubjectHash    string `json:"SubjectHash"` // Hex encoded SHA-256 hash of the canonical JSON of the attested record or inventory
+	SubjectID      string `json:"SubjectID"`   // Record ID, or MSPID and period ID separated by a slash
+	SubjectType    string `json:"SubjectType"` // EMISSIONS_RECORD or PERIOD_INVENTORY
+	VerifierID     string `json:"VerifierID"`
+}
+
+// AttestationRequest holds the statement on the current state of a record or inventory and the digest the verifier has to sign
+// Alphabetic order to achieve determinism accross languages
+type AttestationRequest struct {
+	Digest    string                `json:"Digest"` // Hex encoded SHA-256 hash of the canonical JSON of the statement
+	Statement *AttestationStatement `json:"Statement"`
+}
+
+// attestedInventory is the canonical form of a period inventory that is hashed for an attestation
+// It covers the totals and the revisions of the records, so any approved amendment changes the hash
+// Alphabetic order to achieve determinism accross languages
+type attestedInventory struct {
+	ByCategory []*ScopeAggregate `json:"ByCategory"`
+	ByScope    []*ScopeAggregate `json:"ByScope"`
+	End        string            `json:"End"`
+	MSPID      string            `json:"MSPID"`
+	PeriodID   string            `json:"PeriodID"`
+	RecordIDs  []string          `json:"RecordIDs"` // IDs of the latest revisions of the records, sorted
+	Start      string            `json:"Start"`
+	TotalCO2e  Quantity          `json:"TotalCO2e"`
+	TotalKgCO2 int               `json:"TotalKgCO2"`
+}
+
+// RegisterVerifier adds a verifier and its public key to the registry
+// The key is given as PEM encoded PKIX public key, ECDSA and Ed25519 keys are accepted
+func (s *SmartContract) RegisterVerifier(ctx contractapi.TransactionContextInterface, verifierID string, name string, accreditation string, publicKeyPEM string) error {
+	err := verifyClientIsAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(verifierID) == 0 {
+		return fmt.Errorf("verifier ID must be a non-empty string")
+	}
+	if len(name) == 0 {
+		return fmt.Errorf("name must be a non-empty string")
+	}
+	if len(accreditation) == 0 {
+		return fmt.Errorf("accreditation must be a non-empty string")
+	}
+	_, algorithm, err := parseVerifierKey(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+	existing, err := getVerifier(ctx, verifierID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("the verifier %s already exists", verifierID)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	clientID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+	verifier := Verifier{
+		Accreditation: accreditation,
+		Algorithm:     algorithm,
+		ID:            verifierID,
+		Name:          name,
+		PublicKey:     publicKeyPEM,
+		RegisteredAt:  txTime.Format(time.RFC3339),
+		RegisteredBy:  clientID,
+		Status:        VerifierActive,
+	}
+	return putVerifier(ctx, &verifier)
+}
+
+// RevokeVerifier stops accepting new attestations of a verifier, e.g. after its key was compromised or its accreditation expired
+// Attestations stored before stay on the ledger, a new key has to be registered under a new verifier ID
+func (s *SmartContract) RevokeVerifier(ctx contractapi.TransactionContextInterface, verifierID string) error {
+	err := verifyClientIsAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	verifier, err := s.GetVerifier(ctx, verifierID)
+	if err != nil {
+		return err
+	}
+	if verifier.Status != VerifierActive {
+		return fmt.Errorf("the verifier %s is already %s", verifierID, verifier.Status)
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	verifier.RevokedAt = txTime.Format(time.RFC3339)
+	verifier.Status = VerifierRevoked
+	return putVerifier(ctx, verifier)
+}
+
+// GetVerifier returns a registered verifier
+func (s *SmartContract) GetVerifier(ctx contractapi.TransactionContextInterface, verifierID string) (*Verifier, error) {
+	verifier, err := getVerifier(ctx, verifierID)
+	if err != nil {
+		return nil, err
+	}
+	if verifier == nil {
+		return nil, fmt.Errorf("the verifier %s does not exist", verifierID)
+	}
+	return verifier, nil
+}
+
+// GetVerifiers returns all registered verifiers ordered by their ID
+func (s *SmartContract) GetVerifiers(ctx contractapi.TransactionContextInterface) ([]*Verifier, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(verifierObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	verifiers := []*Verifier{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var verifier Verifier
+		err = json.Unmarshal(queryResponse.Value, &verifier)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, &verifier)
+	}
+
+	sort.Slice(verifiers, func(i, j int) bool {
+		return verifiers[i].ID < verifiers[j].ID
+	})
+	return verifiers, nil
+}
+
+// GetEmissionsRecordAttestationRequest returns the statement on exactly the given revision of an emissions record and the digest a verifier has to sign
+func (s *SmartContract) GetEmissionsRecordAttestationRequest(ctx contractapi.TransactionContextInterface, id string, verifierID string, assuranceLevel string) (*AttestationRequest, error) {
+	record, err := s.GetEmissionsRecordRevision(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	subjectHash, err := hashEmissionsRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	return newAttestationRequest(SubjectEmissionsRecord, id, subjectHash, verifierID, assuranceLevel)
+}
+
+// GetPeriodInventoryAttestationRequest returns the statement on the inventory of a reporting period of the invoking organization and the digest a verifier has to sign
+func (s *SmartContract) GetPeriodInventoryAttestationRequest(ctx contractapi.TransactionContextInterface, periodID string, verifierID string, assuranceLevel string) (*AttestationRequest, error) {
+	inventory, err := s.GetPeriodInventory(ctx, periodID)
+	if err != nil {
+		return nil, err
+	}
+	subjectHash, err := hashPeriodInventory(inventory)
+	if err != nil {
+		return nil, err
+	}
+	return newAttestationRequest(SubjectPeriodInventory, inventory.Period.MSPID+"/"+periodID, subjectHash, verifierID, assuranceLevel)
+}
+
+// AttestEmissionsRecord stores the attestation of a verifier on exactly the given revision of an emissions record
+// The signature is checked against the registered key of the verifier, amended revisions have to be attested again
+func (s *SmartContract) AttestEmissionsRecord(ctx contractapi.TransactionContextInterface, id string, verifierID string, assuranceLevel string, signature string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+
+	record, err := s.GetEmissionsRecordRevision(ctx, id)
+	if err != nil {
+		return err
+	}
+	subjectHash, err := hashEmissionsRecord(record)
+	if err != nil {
+		return err
+	}
+	attestation, err := s.verifyAttestation(ctx, SubjectEmissionsRecord, id, subjectHash, verifierID, assuranceLevel, signature, record.Attestation)
+	if err != nil {
+		return err
+	}
+
+	record.Attestation = attestation
+	return putEmissionsRecord(ctx, record)
+}
+
+// AttestPeriodInventory stores the attestation of a verifier on the inventory of a closed reporting period of the invoking organization
+// The signature is checked against the registered key of the verifier
+func (s *SmartContract) AttestPeriodInventory(ctx contractapi.TransactionContextInterface, periodID string, verifierID string, assuranceLevel string, signature string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+
+	inventory, err := s.GetPeriodInventory(ctx, periodID)
+	if err != nil {
+		return err
+	}
+	period := inventory.Period
+	// Only the inventory of a closed period is final, records of an open period can still be added
+	if period.Status != PeriodClosed {
+		return fmt.Errorf("the reporting period %s is %s, only closed periods can be attested", periodID, period.Status)
+	}
+	subjectHash, err := hashPeriodInventory(inventory)
+	if err != nil {
+		return err
+	}
+	attestation, err := s.verifyAttestation(ctx, SubjectPeriodInventory, period.MSPID+"/"+periodID, subjectHash, verifierID, assuranceLevel, signature, period.Attestation)
+	if err != nil {
+		return err
+	}
+
+	period.Attestation = attestation
+	return putReportingPeriod(ctx, period)
+}
+
+// HELPER FUNCTION verifyAttestation checks the signature of a verifier on a statement and returns the attestation to store
+// An existing attestation can only be replaced by one with a higher assurance level
+func (s *SmartContract) verifyAttestation(ctx contractapi.TransactionContextInterface, subjectType string, subjectID string, subjectHash string, verifierID string, assuranceLevel string, signature string, existing *Attestation) (*Attestation, error) {
+	request, err := newAttestationRequest(subjectType, subjectID, subjectHash, verifierID, assuranceLevel)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && assuranceRanks[existing.AssuranceLevel] >= assuranceRanks[assuranceLevel] {
+		return nil, fmt.Errorf("%s is already attested with %s assurance by %s", subjectID, existing.AssuranceLevel, existing.VerifierID)
+	}
+
+	verifier, err := s.GetVerifier(ctx, verifierID)
+	if err != nil {
+		return nil, err
+	}
+	if verifier.Status != VerifierActive {
+		return nil, fmt.Errorf("the verifier %s is %s", verifierID, verifier.Status)
+	}
+	digest, err := hex.DecodeString(request.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode digest: %v", err)
+	}
+	err = verifySignature(verifier, digest, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clientID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	attestation := Attestation{
+		AssuranceLevel: assuranceLevel,
+		AttestedAt:     txTime.Format(time.RFC3339),
+		Signature:      signature,
+		SubjectHash:    subjectHash,
+		SubmittedBy:    clientID,
+		VerifierID:     verifier.ID,
+		VerifierName:   verifier.Name,
+	}
+	return &attestation, nil
+}
+
+// HELPER FUNCTION newAttestationRequest builds the statement on a subject and its digest
+func newAttestationRequest(subjectType string, subjectID string, subjectHash string, verifierID string, assuranceLevel string) (*AttestationRequest, error) {
+	if _, ok := assuranceRanks[assuranceLevel]; !ok {
+		return nil, fmt.Errorf("assurance level must be %s or %s, got %s", AssuranceLimited, AssuranceReasonable, assuranceLevel)
+	}
+	if len(verifierID) == 0 {
+		return nil, fmt.Errorf("verifier ID must be a non-empty string")
+	}
+
+	statement := AttestationStatement{
+		AssuranceLevel: assuranceLevel,
+		SubjectHash:    subjectHash,
+		SubjectID:      subjectID,
+		SubjectType:    subjectType,
+		VerifierID:     verifierID,
+	}
+	digest, err := hashJSON(statement)
+	if err != nil {
+		return nil, err
+	}
+	return &AttestationRequest{Digest: digest, Statement: &statement}, nil
+}
+
+// HELPER FUNCTION hashEmissionsRecord returns the hash of the canonical JSON of an emissions record without its attestation
+func hashEmissionsRecord(record *EmissionsRecord) (string, error) {
+	canonical := *record
+	canonical.Attestation = nil
+	return hashJSON(canonical)
+}
+
+// HELPER FUNCTION hashPeriodInventory returns the hash of the canonical form of a period inventory
+func hashPeriodInventory(inventory *PeriodInventory) (string, error) {
+	recordIDs := []string{}
+	for _, record := range inventory.Records {
+		recordIDs = append(recordIDs, record.ID)
+	}
+	sort.Strings(recordIDs)
+
+	return hashJSON(attestedInventory{
+		ByCategory: inventory.ByCategory,
+		ByScope:    inventory.ByScope,
+		End:        inventory.Period.End,
+		MSPID:      inventory.Period.MSPID,
+		PeriodID:   inventory.Period.ID,
+		RecordIDs:  recordIDs,
+		Start:      inventory.Period.Start,
+		TotalCO2e:  inventory.TotalCO2e,
+		TotalKgCO2: inventory.TotalKgCO2,
+	})
+}
+
+// HELPER FUNCTION hashJSON returns the hex encoded SHA-256 hash of the JSON of a value
+// Structs are marshalled with their fields in alphabetic order, so the JSON is canonical
+func hashJSON(value interface{}) (string, error) {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal into JSON: %v", err)
+	}
+	hash := sha256.Sum256(valueJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// HELPER FUNCTION verifySignature checks a base64 encoded signature over a digest against the public key of a verifier
+// ECDSA signatures are ASN.1 encoded, Ed25519 signatures sign the digest as message
+func verifySignature(verifier *Verifier, digest []byte, signature string) error {
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+	publicKey, _, err := parseVerifierKey(verifier.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	valid := false
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest, signatureBytes)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, digest, signatureBytes)
+	}
+	if !valid {
+		return fmt.Errorf("the signature does not match the key of verifier %s", verifier.ID)
+	}
+	return nil
+}
+
+// HELPER FUNCTION parseVerifierKey parses a PEM encoded PKIX public key and returns it with its algorithm
+func parseVerifierKey(publicKeyPEM string) (interface{}, string, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, "", fmt.Errorf("public key must be PEM encoded")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return publicKey, AlgorithmECDSA, nil
+	case ed25519.PublicKey:
+		return publicKey, AlgorithmEd25519, nil
+	}
+	return nil, "", fmt.Errorf("public key must be an %s or %s key", AlgorithmECDSA, AlgorithmEd25519)
+}
+
+// HELPER FUNCTION getVerifier reads a verifier from the ledger, it returns nil if the verifier does not exist
+func getVerifier(ctx contractapi.TransactionContextInterface, verifierID string) (*Verifier, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(verifierObjectType, []string{verifierID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	verifierJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if verifierJSON == nil {
+		return nil, nil
+	}
+
+	var verifier Verifier
+	err = json.Unmarshal(verifierJSON, &verifier)
+	if err != nil {
+		return nil, err
+	}
+	return &verifier, nil
+}
+
+// HELPER FUNCTION putVerifier writes a verifier to the ledger
+func putVerifier(ctx contractapi.TransactionContextInterface, verifier *Verifier) error {
+	key, err := ctx.GetStub().CreateCompositeKey(verifierObjectType, []string{verifier.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	verifierJSON, err := json.Marshal(verifier)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, verifierJSON)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherECDSAKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("statement"))
+	otherDigest := sha256.Sum256([]byte("other statement"))
+	ecdsaSignature, err := ecdsa.SignASN1(rand.Reader, ecdsaKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Signature := ed25519.Sign(ed25519Key, digest[:])
+
+	tests := []struct {
+		name      string
+		publicKey crypto.PublicKey
+		digest    []byte
+		signature string
+		wantErr   bool
+	}{
+		{name: "ECDSA", publicKey: &ecdsaKey.PublicKey, digest: digest[:], signature: base64.StdEncoding.EncodeToString(ecdsaSignature)},
+		{name: "Ed25519", publicKey: ed25519Key.Public(), digest: digest[:], signature: base64.StdEncoding.EncodeToString(ed25519Signature)},
+		{name: "ECDSA with other digest", publicKey: &ecdsaKey.PublicKey, digest: otherDigest[:], signature: base64.StdEncoding.EncodeToString(ecdsaSignature), wantErr: true},
+		{name: "Ed25519 with other digest", publicKey: ed25519Key.Public(), digest: otherDigest[:], signature: base64.StdEncoding.EncodeToString(ed25519Signature), wantErr: true},
+		{name: "ECDSA with other key", publicKey: &otherECDSAKey.PublicKey, digest: digest[:], signature: base64.StdEncoding.EncodeToString(ecdsaSignature), wantErr: true},
+		{name: "Ed25519 signature for ECDSA key", publicKey: &ecdsaKey.PublicKey, digest: digest[:], signature: base64.StdEncoding.EncodeToString(ed25519Signature), wantErr: true},
+		{name: "signature not base64", publicKey: ed25519Key.Public(), digest: digest[:], signature: "not base64!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyDER, err := x509.MarshalPKIXPublicKey(tt.publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier := &Verifier{
+				ID:        "verifier1",
+				PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyDER})),
+			}
+			err = verifySignature(verifier, tt.digest, tt.signature)
+			if tt.wantErr && err == nil {
+				t.Errorf("verifySignature succeeded, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("verifySignature failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicKey string
+	}{
+		{name: "not PEM encoded", publicKey: "public key"},
+		{name: "no PKIX key", publicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("key")}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySignature(&Verifier{ID: "verifier1", PublicKey: tt.publicKey}, []byte("digest"), base64.StdEncoding.EncodeToString([]byte("signature")))
+			if err == nil {
+				t.Errorf("verifySignature succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const auditCaseObjectType = "auditCase"
+
+// Kinds of audit cases
+const (
+	CaseKindAudit     = "AUDIT"     // New emissions which failed the automated audit
+	CaseKindAmendment = "AMENDMENT" // A new revision of an existing emissions record
+)
+
+// Lifecycle states of an audit case
+const (
+	CaseOpen              = "OPEN"               // Waiting for an auditor to pick up the case
+	CaseInReview          = "IN_REVIEW"          // An auditor is reviewing the case
+	CaseEvidenceRequested = "EVIDENCE_REQUESTED" // The auditor waits for evidence from the submitter
+	CaseApproved          = "APPROVED"           // The emissions record was created
+	CaseRejected          = "REJECTED"           // The submitted emissions were rejected
+)
+
+// AuditCase is the public part of an audit case of submitted emissions which failed the automated audit and wait for a manual re-audit
+// It only tells auditors which cases are waiting, the submitted emissions and the owner are kept in the AuditCaseDetails
+// Alphabetic order to achieve determinism accross languages
+type AuditCase struct {
+	Auditor  string `json:"Auditor"` // Identity of the auditor who picked up the case
+	ID       string `json:"ID"`
+	RecordID string `json:"RecordID"` // ID of the emissions record that is created on approval, identical to the case ID
+	Status   string `json:"Status"`
+}
+
+// AuditCaseDetails are the submitted emissions and the history of an audit case
+// They are kept in the private data collection of the submitting organization, so the record cannot be linked to its owner by other organizations
+// Auditors receive them from the submitter and pass them as transient auditCase, they are checked against the hash on the ledger
+// The owner identifier is kept in the details, so the private details of the record can be created on approval
+// Alphabetic order to achieve determinism accross languages
+type AuditCaseDetails struct {
+	History          []AuditCaseEvent `json:"History"`
+	ID               string           `json:"ID"`
+	Info             string           `json:"Info"`
+	Kind             string           `json:"Kind"`             // AUDIT or AMENDMENT
+	OwnerID          string           `json:"OwnerID"`          // Not named Owner, so the details never match the queries for the records of an owner
+	PrevEmissionsIDs []string         `json:"PrevEmissionsIDs"` // Previous records of the owner the emissions were compared against
+	Reason           string           `json:"Reason"`           // Why the automated audit failed
+	Record           EmissionsRecord  `json:"Record"`           // Submitted emissions
+	SubmitterMSPID   string           `json:"SubmitterMSPID"`
+}
+
+// AuditCaseEvent describes a single state transition of an audit case
+// Alphabetic order to achieve determinism accross languages
+type AuditCaseEvent struct {
+	Actor     string `json:"Actor"` // Identity that performed the transition
+	Comment   string `json:"Comment"`
+	Status    string `json:"Status"` // Status after the transition
+	Timestamp string `json:"Timestamp"`
+	TxID      string `json:"TxID"`
+}
+
+// PickUpAuditCase assigns an open audit case to the invoking auditor
+// Transient Data: auditCase AuditCaseDetails (as received from the submitter)
+func (s *SmartContract) PickUpAuditCase(ctx contractapi.TransactionContextInterface, caseID string) error {
+	auditor, err := verifyClientIsAuditor(ctx)
+	if err != nil {
+		return err
+	}
+	auditCase, err := s.GetAuditCase(ctx, caseID)
+	if err != nil {
+		return err
+	}
+	if auditCase.Status != CaseOpen {
+		return fmt.Errorf("audit case %s is %s and cannot be picked up", caseID, auditCase.Status)
+	}
+	details, err := getAuditCaseDetails(ctx, caseID)
+	if err != nil {
+		return err
+	}
+	// Auditors must not review the emissions of their own organization
+	if strings.HasPrefix(auditor, details.SubmitterMSPID+"::") {
+		return fmt.Errorf("audit case %s was submitted by the organization of the auditor", caseID)
+	}
+
+	auditCase.Auditor = auditor
+	return transitionAuditCase(ctx, auditCase, details, CaseInReview, auditor, "picked up for manual re-audit")
+}
+
+// RequestAuditEvidence asks the submitter of an audit case for additional evidence
+// Transient Data: auditCase AuditCaseDetails (as received from the submitter)
+func (s *SmartContract) RequestAuditEvidence(ctx contractapi.TransactionContextInterface, caseID string, request string) error {
+	auditCase, details, auditor, err := s.getAssignedAuditCase(ctx, caseID)
+	if err != nil {
+		return err
+	}
+	if auditCase.Status != CaseInReview {
+		return fmt.Errorf("audit case %s is %s, evidence can only be requested while it is in review", caseID, auditCase.Status)
+	}
+	if len(request) == 0 {
+		return fmt.Errorf("request must be a non-empty string")
+	}
+
+	return transitionAuditCase(ctx, auditCase, details, CaseEvidenceRequested, auditor, request)
+}
+
+// SubmitAuditEvidence answers an evidence request of the auditor and returns the case to review
+// Only members of the submitting organization can provide evidence
+func (s *SmartContract) SubmitAuditEvidence(ctx contractapi.TransactionContextInterface, caseID string, evidence string) error {
+	auditCase, err := s.GetAuditCase(ctx, caseID)
+	if err != nil {
+		return err
+	}
+	details, err := getAuditCaseDetails(ctx, caseID)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	if clientMSPID != details.SubmitterMSPID {
+		return fmt.Errorf("client from org %v is not authorized to submit evidence for audit case %s", clientMSPID, caseID)
+	}
+	err = verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	if auditCase.Status != CaseEvidenceRequested {
+		return fmt.Errorf("audit case %s is %s, no evidence has been requested", caseID, auditCase.Status)
+	}
+	if len(evidence) == 0 {
+		return fmt.Errorf("evidence must be a non-empty string")
+	}
+
+	submitter, err := getClientIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+	return transitionAuditCase(ctx, auditCase, details, CaseInReview, submitter, evidence)
+}
+
+// ApproveAuditCase accepts the submitted emissions of an audit case
+// The emissions record is written to the ledger, its private details to the collection of the submitting organization
+// and the tokens for the emissions are minted to the submitting organization
+// Approved amendments become the latest revision of the amended record
+// Transient Data: auditCase AuditCaseDetails (as received from the submitter)
+func (s *SmartContract) ApproveAuditCase(ctx contractapi.TransactionContextInterface, caseID string, comment string) error {
+	auditCase, details, auditor, err := s.getAssignedAuditCase(ctx, caseID)
+	if err != nil {
+		return err
+	}
+	if auditCase.Status != CaseInReview {
+		return fmt.Errorf("audit case %s is %s, only cases in review can be approved", caseID, auditCase.Status)
+	}
+
+	exists, err := s.EmissionsRecordExists(ctx, details.Record.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the Emissions Record with ID %s already exists", details.Record.ID)
+	}
+	switch details.Kind {
+	case CaseKindAmendment:
+		err = s.approveAmendment(ctx, &details.Record, auditor)
+		if err != nil {
+			return err
+		}
+	case CaseKindAudit:
+		// Emissions of a period closed in the meantime can only be rejected
+		err = verifyReportingPeriodOpen(ctx, details.SubmitterMSPID, &details.Record)
+		if err != nil {
+			return err
+		}
+		err = putEmissionsRecord(ctx, &details.Record)
+		if err != nil {
+			return fmt.Errorf("failed to create emissions record: %v", err)
+		}
+		submitterCollection := details.SubmitterMSPID + "PrivateCollection"
+		err = putEmissionsRecordPrivateDetails(ctx, submitterCollection, &details.Record, details.OwnerID)
+		if err != nil {
+			return err
+		}
+		err = mintEmissionsTokens(ctx, details.SubmitterMSPID, &details.Record)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("audit case %s has unknown kind %s", caseID, details.Kind)
+	}
+
+	err = resolveAuditReport(ctx, details.Record.ID, ReportApproved)
+	if err != nil {
+		return err
+	}
+
+	return transitionAuditCase(ctx, auditCase, details, CaseApproved, auditor, comment)
+}
+
+// RejectAuditCase rejects the submitted emissions of an audit case, no emissions record is created
+// Transient Data: auditCase AuditCaseDetails (as received from the submitter)
+func (s *SmartContract) RejectAuditCase(ctx contractapi.TransactionContextInterface, caseID string, reason string) error {
+	auditCase, details, auditor, err := s.getAssignedAuditCase(ctx, caseID)
+	if err != nil {
+		return err
+	}
+	if auditCase.Status != CaseInReview && auditCase.Status != CaseEvidenceRequested {
+		return fmt.Errorf("audit case %s is %s and cannot be rejected", caseID, auditCase.Status)
+	}
+	if len(reason) == 0 {
+		return fmt.Errorf("reason must be a non-empty string")
+	}
+
+	err = resolveAuditReport(ctx, details.Record.ID, ReportFailed)
+	if err != nil {
+		return err
+	}
+
+	return transitionAuditCase(ctx, auditCase, details, CaseRejected, auditor, reason)
+}
+
+// GetAuditCase returns the audit case with the given ID
+func (s *SmartContract) GetAuditCase(ctx contractapi.TransactionContextInterface, caseID string) (*AuditCase, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(auditCaseObjectType, []string{caseID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	caseJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if caseJSON == nil {
+		return nil, fmt.Errorf("the audit case with ID %s does not exist", caseID)
+	}
+
+	var auditCase AuditCase
+	err = json.Unmarshal(caseJSON, &auditCase)
+	if err != nil {
+		return nil, err
+	}
+	return &auditCase, nil
+}
+
+// GetAuditCaseDetails returns the submitted emissions and the history of an audit case
+// The submitting organization reads them from its private data collection. Auditors pass the details received from the submitter
+// as transient auditCase, they are returned if they match the hash on the ledger, so an auditor can check them before the review
+func (s *SmartContract) GetAuditCaseDetails(ctx contractapi.TransactionContextInterface, caseID string) (*AuditCaseDetails, error) {
+	exists, err := s.AuditCaseExists(ctx, caseID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("the audit case with ID %s does not exist", caseID)
+	}
+	return getAuditCaseDetails(ctx, caseID)
+}
+
+// GetPendingAuditCases returns all audit cases that are neither approved nor rejected
+func (s *SmartContract) GetPendingAuditCases(ctx contractapi.TransactionContextInterface) ([]*AuditCase, error) {
+	err := verifyClientHasRole(ctx, RoleReader)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(auditCaseObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var cases []*AuditCase
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var auditCase AuditCase
+		err = json.Unmarshal(queryResponse.Value, &auditCase)
+		if err != nil {
+			return nil, err
+		}
+		if auditCase.Status == CaseApproved || auditCase.Status == CaseRejected {
+			continue
+		}
+		cases = append(cases, &auditCase)
+	}
+
+	return cases, nil
+}
+
+// AuditCaseExists returns true when an audit case with the given ID exists in the ledger
+func (s *SmartContract) AuditCaseExists(ctx contractapi.TransactionContextInterface, caseID string) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(auditCaseObjectType, []string{caseID})
+	if err != nil {
+		return false, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	caseJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+
+	return caseJSON != nil, nil
+}
+
+// HELPER FUNCTION openAuditCase stores emissions which failed the automated audit or an amendment as a new audit case
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) openAuditCase(ctx contractapi.TransactionContextInterface, kind string, record *EmissionsRecord, prevEmissionsIDs []string, info string, reason string) error {
+	ownerID, err := getOwnerID(ctx)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	submitter, err := getClientIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+
+	if prevEmissionsIDs == nil {
+		prevEmissionsIDs = []string{}
+	}
+	auditCase := AuditCase{
+		ID:       record.ID,
+		RecordID: record.ID,
+	}
+	details := AuditCaseDetails{
+		History:          []AuditCaseEvent{},
+		ID:               record.ID,
+		Info:             info,
+		Kind:             kind,
+		OwnerID:          ownerID,
+		PrevEmissionsIDs: prevEmissionsIDs,
+		Reason:           reason,
+		Record:           *record,
+		SubmitterMSPID:   clientMSPID,
+	}
+	err = transitionAuditCase(ctx, &auditCase, &details, CaseOpen, submitter, reason)
+	if err != nil {
+		return err
+	}
+
+	// Notify listening clients that the emissions are waiting for a manual re-audit, only the ID is published
+	return ctx.GetStub().SetEvent("AuditCaseOpened", []byte(auditCase.ID))
+}
+
+// HELPER FUNCTION getAssignedAuditCase reads an audit case and its details and checks that the invoking auditor picked it up
+func (s *SmartContract) getAssignedAuditCase(ctx contractapi.TransactionContextInterface, caseID string) (*AuditCase, *AuditCaseDetails, string, error) {
+	auditor, err := verifyClientIsAuditor(ctx)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	auditCase, err := s.GetAuditCase(ctx, caseID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if auditCase.Auditor != auditor {
+		return nil, nil, "", fmt.Errorf("audit case %s is not assigned to the invoking auditor", caseID)
+	}
+	details, err := getAuditCaseDetails(ctx, caseID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return auditCase, details, auditor, nil
+}
+
+// HELPER FUNCTION getAuditCaseDetails returns the details of an audit case
+// Details passed as transient auditCase are checked against the hash in the collection of the submitting organization,
+// otherwise they are read from the collection of the invoking organization
+func getAuditCaseDetails(ctx contractapi.TransactionContextInterface, caseID string) (*AuditCaseDetails, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(auditCaseObjectType, []string{caseID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+	if transientDetailsJSON, ok := transientMap["auditCase"]; ok {
+		var details AuditCaseDetails
+		err = json.Unmarshal(transientDetailsJSON, &details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		if details.ID != caseID {
+			return nil, fmt.Errorf("the transient auditCase belongs to the audit case %s instead of %s", details.ID, caseID)
+		}
+		// The details are hashed in the form they were written in by the chaincode
+		detailsJSON, err := json.Marshal(details)
+		if err != nil {
+			return nil, err
+		}
+		submitterCollection := details.SubmitterMSPID + "PrivateCollection"
+		storedHash, err := ctx.GetStub().GetPrivateDataHash(submitterCollection, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hash of audit case %s from collection %s: %v", caseID, submitterCollection, err)
+		}
+		hash := sha256.Sum256(detailsJSON)
+		if storedHash == nil || string(storedHash) != string(hash[:]) {
+			return nil, fmt.Errorf("the transient auditCase does not match the details of audit case %s stored by the submitting organization", caseID)
+		}
+		return &details, nil
+	}
+
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("the details of audit case %s have to be passed as transient auditCase: %v", caseID, err)
+	}
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	detailsJSON, err := ctx.GetStub().GetPrivateData(orgCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit case details: %v", err)
+	}
+	if detailsJSON == nil {
+		return nil, fmt.Errorf("the details of audit case %s are not in collection %s, auditors pass them as transient auditCase", caseID, orgCollection)
+	}
+	var details AuditCaseDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// HELPER FUNCTION transitionAuditCase moves an audit case into a new state and appends the transition to its history
+// The public case is written to the ledger, the details to the private data collection of the submitting organization
+func transitionAuditCase(ctx contractapi.TransactionContextInterface, auditCase *AuditCase, details *AuditCaseDetails, status string, actor string, comment string) error {
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	auditCase.Status = status
+	details.History = append(details.History, AuditCaseEvent{
+		Actor:     actor,
+		Comment:   comment,
+		Status:    status,
+		Timestamp: timestamp.Format(time.RFC3339),
+		TxID:      ctx.GetStub().GetTxID(),
+	})
+
+	key, err := ctx.GetStub().CreateCompositeKey(auditCaseObjectType, []string{auditCase.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	caseJSON, err := json.Marshal(auditCase)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(key, caseJSON)
+	if err != nil {
+		return err
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutPrivateData(details.SubmitterMSPID+"PrivateCollection", key, detailsJSON)
+}
+
+// HELPER FUNCTION verifyClientIsAuditor checks that the client holds the auditor role and returns its identifier
+func verifyClientIsAuditor(ctx contractapi.TransactionContextInterface) (string, error) {
+	err := verifyClientHasRole(ctx, RoleAuditor)
+	if err != nil {
+		return "", fmt.Errorf("client is not authorized to audit emissions: %v", err)
+	}
+	return getClientIdentifier(ctx)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const auditReportObjectType = "auditReport"
+
+// Decisions of an audit report
+const (
+	ReportPassed   = "PASSED"   // The emissions passed the automated audit
+	ReportManual   = "MANUAL"   // The emissions wait for a manual re-audit in an audit case
+	ReportApproved = "APPROVED" // The emissions were approved by an auditor
+	ReportFailed   = "FAILED"   // The emissions were rejected by an auditor
+)
+
+// AuditReport describes how submitted emissions were audited and why they were accepted or not
+// TxID and Timestamp belong to the submission, the steps of a manual re-audit are kept in the audit case
+// The previous records the emissions were compared against are only kept in the private data collection of the owner's organization,
+// the report holds their hash, so an assurance provider can check the IDs it receives from the owner
+// Alphabetic order to achieve determinism accross languages
+type AuditReport struct {
+	BaselineHash string           `json:"BaselineHash"` // Hex encoded SHA-256 hash of the JSON array of the sorted IDs of the baseline records
+	BaselineSize int              `json:"BaselineSize"` // Number of previous records of the owner the emissions were compared against
+	CaseID       string           `json:"CaseID,omitempty" metadata:",optional"`
+	Decision     string           `json:"Decision"`
+	Info         string           `json:"Info"`                                        // Information submitted together with the emissions
+	OutlierCheck *OutlierDecision `json:"OutlierCheck,omitempty" metadata:",optional"` // Not set for amendments, which are always audited manually
+	Reason       string           `json:"Reason"`
+	RecordID     string           `json:"RecordID"`
+	Timestamp    string           `json:"Timestamp"`
+	TxID         string           `json:"TxID"`
+}
+
+// GetAuditReport returns the audit report of the emissions record with the given id
+// Reports also exist for emissions that are waiting for or failed the manual re-audit
+func (s *SmartContract) GetAuditReport(ctx contractapi.TransactionContextInterface, recordID string) (*AuditReport, error) {
+	err := verifyClientHasRole(ctx, RoleReader)
+	if err != nil {
+		return nil, err
+	}
+	report, err := getAuditReport(ctx, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if report == nil {
+		return nil, fmt.Errorf("no audit report exists for the emissions record with ID %s", recordID)
+	}
+	return report, nil
+}
+
+// AuditReportBaseline lists the previous records of the owner the emissions of a record were compared against
+// Alphabetic order to achieve determinism accross languages
+type AuditReportBaseline struct {
+	BaselineIDs []string `json:"BaselineIDs"`
+	RecordID    string   `json:"RecordID"`
+}
+
+// GetAuditReportBaseline returns the previous records of the owner the emissions of a record were compared against
+// The owner's organization reads the baseline from its private data collection. Others, e.g. an assurance provider, pass the baseline
+// received from the owner as transient auditBaseline, it is returned if it matches the hash in the audit report
+func (s *SmartContract) GetAuditReportBaseline(ctx contractapi.TransactionContextInterface, recordID string) (*AuditReportBaseline, error) {
+	err := verifyClientHasRole(ctx, RoleReader)
+	if err != nil {
+		return nil, err
+	}
+	report, err := getAuditReport(ctx, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if report == nil {
+		return nil, fmt.Errorf("no audit report exists for the emissions record with ID %s", recordID)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+	if transientBaselineJSON, ok := transientMap["auditBaseline"]; ok {
+		var baseline AuditReportBaseline
+		err = json.Unmarshal(transientBaselineJSON, &baseline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		if baseline.RecordID != recordID {
+			return nil, fmt.Errorf("the transient auditBaseline belongs to the emissions record %s instead of %s", baseline.RecordID, recordID)
+		}
+		hash, err := baselineHash(baseline.BaselineIDs)
+		if err != nil {
+			return nil, err
+		}
+		if hash != report.BaselineHash {
+			return nil, fmt.Errorf("the transient auditBaseline does not match the audit report of emissions record %s", recordID)
+		}
+		return &baseline, nil
+	}
+
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetAuditReportBaseline cannot be performed: Error %v", err)
+	}
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(auditReportObjectType, []string{recordID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	baselineJSON, err := ctx.GetStub().GetPrivateData(orgCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from private data collection: %v", err)
+	}
+	if baselineJSON == nil {
+		return nil, fmt.Errorf("no audit baseline exists for the emissions record with ID %s in collection %s, others pass it as transient auditBaseline", recordID, orgCollection)
+	}
+
+	var baseline AuditReportBaseline
+	err = json.Unmarshal(baselineJSON, &baseline)
+	if err != nil {
+		return nil, err
+	}
+	return &baseline, nil
+}
+
+// HELPER FUNCTION createAuditReport writes the report of the automated audit of a record to the ledger
+func createAuditReport(ctx contractapi.TransactionContextInterface, record *EmissionsRecord, baselineIDs []string, info string, decision string, reason string) error {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	hash, err := baselineHash(baselineIDs)
+	if err != nil {
+		return err
+	}
+	report := AuditReport{
+		BaselineHash: hash,
+		BaselineSize: len(baselineIDs),
+		Decision:     decision,
+		Info:         info,
+		OutlierCheck: record.OutlierCheck,
+		Reason:       reason,
+		RecordID:     record.ID,
+		Timestamp:    txTime.Format(time.RFC3339),
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+	// Emissions that go to manual re-audit are tracked in an audit case with the same ID
+	if decision == ReportManual {
+		report.CaseID = record.ID
+	}
+	err = putAuditReport(ctx, &report)
+	if err != nil {
+		return err
+	}
+
+	// The baseline is only known to the owner, the audit is always run on a peer of the owner's organization
+	if len(baselineIDs) == 0 {
+		return nil
+	}
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(auditReportObjectType, []string{record.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	baselineJSON, err := json.Marshal(AuditReportBaseline{BaselineIDs: baselineIDs, RecordID: record.ID})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutPrivateData(orgCollection, key, baselineJSON)
+}
+
+// HELPER FUNCTION resolveAuditReport stores the outcome of the manual re-audit in the report of a record
+func resolveAuditReport(ctx contractapi.TransactionContextInterface, recordID string, decision string) error {
+	report, err := getAuditReport(ctx, recordID)
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		return fmt.Errorf("no audit report exists for the emissions record with ID %s", recordID)
+	}
+	report.Decision = decision
+	return putAuditReport(ctx, report)
+}
+
+// HELPER FUNCTION getAuditReport reads the report of a record from the ledger, it returns nil if no report exists
+func getAuditReport(ctx contractapi.TransactionContextInterface, recordID string) (*AuditReport, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(auditReportObjectType, []string{recordID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	reportJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if reportJSON == nil {
+		return nil, nil
+	}
+
+	var report AuditReport
+	err = json.Unmarshal(reportJSON, &report)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// HELPER FUNCTION baselineHash returns the hash of the baseline of a report, the IDs are sorted so their order does not matter
+func baselineHash(baselineIDs []string) (string, error) {
+	sortedIDs := make([]string, len(baselineIDs))
+	copy(sortedIDs, baselineIDs)
+	sort.Strings(sortedIDs)
+	return hashJSON(sortedIDs)
+}
+
+// HELPER FUNCTION putAuditReport writes an audit report to the ledger
+func putAuditReport(ctx contractapi.TransactionContextInterface, report *AuditReport) error {
+	key, err := ctx.GetStub().CreateCompositeKey(auditReportObjectType, []string{report.RecordID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, reportJSON)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestBaselineHash(t *testing.T) {
+	tests := []struct {
+		name        string
+		baselineIDs []string
+		want        string
+	}{
+		{name: "no baseline", baselineIDs: []string{}, want: "4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"},
+		{name: "sorted IDs", baselineIDs: []string{"E1", "E2"}, want: "9252e86400f42b25abcb9d40132421bbccad875a7c2e2b6e352a70af1d184923"},
+		{name: "order does not matter", baselineIDs: []string{"E2", "E1"}, want: "9252e86400f42b25abcb9d40132421bbccad875a7c2e2b6e352a70af1d184923"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := baselineHash(tt.baselineIDs)
+			if err != nil {
+				t.Fatalf("baselineHash(%v) failed: %v", tt.baselineIDs, err)
+			}
+			if got != tt.want {
+				t.Errorf("baselineHash(%v) = %s, want %s", tt.baselineIDs, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const emissionFactorObjectType = "emissionFactor"
+const emissionFactorIndexObjectType = "emissionFactorByActivity"
+
+// Lifecycle states of an emission factor version
+const (
+	FactorActive     = "ACTIVE"     // Version can be used for new calculations
+	FactorSuperseded = "SUPERSEDED" // A newer version replaced this one
+	FactorDeprecated = "DEPRECATED" // Factor must not be used for new calculations anymore
+)
+
+// EmissionFactor describes the emissions caused per unit of an activity, e.g. 0.4 kgCO2e per kWh of electricity
+// Every version of a factor is stored under its own key, so records can always be recalculated with the version they used
+// Alphabetic order to achieve determinism accross languages
+type EmissionFactor struct {
+	ActivityType      string   `json:"ActivityType"` // Activity the factor applies to, e.g. electricity or diesel
+	CO2ePerUnit       Quantity `json:"CO2ePerUnit"`  // Emissions per unit of activity
+	CreatedAt         string   `json:"CreatedAt"`    // Timestamp of the transaction that created this version
+	CreatedBy         string   `json:"CreatedBy"`    // MSPID of the organization that created this version
+	DeprecationReason string   `json:"DeprecationReason,omitempty" metadata:",optional"`
+	ID                string   `json:"ID"`
+	Region            string   `json:"Region"` // Region the factor is valid for, e.g. an ISO country code, a grid region or GLOBAL
+	Source            string   `json:"Source"` // Citation of the source, e.g. DEFRA 2023, ecoinvent 3.9.1 or IEA 2023
+	Status            string   `json:"Status"`
+	SupersededBy      int      `json:"SupersededBy,omitempty" metadata:",optional"` // Version that replaced this one
+	Unit              string   `json:"Unit"`                                        // Unit of the activity data, e.g. kWh, l or t
+	ValidFrom         string   `json:"ValidFrom"`                                   // First day the factor is valid (YYYY-MM-DD)
+	ValidTo           string   `json:"ValidTo"`                                     // Last day the factor is valid (YYYY-MM-DD)
+	Version           int      `json:"Version"`
+}
+
+// CreateEmissionFactor adds the first version of a new emission factor to the ledger
+// The value is a decimal with up to 6 decimal places in gCO2e, kgCO2e or tCO2e per unit of activity
+func (s *SmartContract) CreateEmissionFactor(ctx contractapi.TransactionContextInterface, id string, activityType string, region string, unit string, co2ePerUnit string, co2eUnit string, source string, validFrom string, validTo string) error {
+	clientMSPID, err := verifyClientIsFactorAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(id) == 0 {
+		return fmt.Errorf("emission factor ID must be a non-empty string")
+	}
+	if len(activityType) == 0 {
+		return fmt.Errorf("activity type must be a non-empty string")
+	}
+	if len(region) == 0 {
+		return fmt.Errorf("region must be a non-empty string")
+	}
+	if _, ok := quantityUnits[unit]; !ok {
+		return fmt.Errorf("unknown unit of activity data %s", unit)
+	}
+	value, err := parseCO2ePerUnit(co2ePerUnit, co2eUnit)
+	if err != nil {
+		return err
+	}
+
+	latest, err := latestEmissionFactor(ctx, id)
+	if err != nil {
+		return err
+	}
+	if latest != nil {
+		return fmt.Errorf("the emission factor with ID %s already exists", id)
+	}
+
+	createdAt, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	factor := EmissionFactor{
+		ActivityType: activityType,
+		CO2ePerUnit:  value,
+		CreatedAt:    createdAt.Format(time.RFC3339),
+		CreatedBy:    clientMSPID,
+		ID:           id,
+		Region:       region,
+		Source:       source,
+		Status:       FactorActive,
+		Unit:         unit,
+		ValidFrom:    validFrom,
+		ValidTo:      validTo,
+		Version:      1,
+	}
+	err = validateEmissionFactor(&factor)
+	if err != nil {
+		return err
+	}
+	err = putEmissionFactor(ctx, &factor)
+	if err != nil {
+		return err
+	}
+
+	// Index the factor by activity type and region for lookups
+	indexKey, err := ctx.GetStub().CreateCompositeKey(emissionFactorIndexObjectType, []string{activityType, region, id})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+// SupersedeEmissionFactor adds a new version of an emission factor with updated values and marks the previous version as superseded
+// Activity type, region and unit are taken over from the previous version. Records keep referencing the version they were calculated with
+func (s *SmartContract) SupersedeEmissionFactor(ctx contractapi.TransactionContextInterface, id string, co2ePerUnit string, co2eUnit string, source string, validFrom string, validTo string) error {
+	clientMSPID, err := verifyClientIsFactorAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	value, err := parseCO2ePerUnit(co2ePerUnit, co2eUnit)
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.GetCurrentEmissionFactor(ctx, id)
+	if err != nil {
+		return err
+	}
+	if previous.Status == FactorDeprecated {
+		return fmt.Errorf("the emission factor with ID %s is deprecated and cannot be superseded", id)
+	}
+
+	createdAt, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	factor := EmissionFactor{
+		ActivityType: previous.ActivityType,
+		CO2ePerUnit:  value,
+		CreatedAt:    createdAt.Format(time.RFC3339),
+		CreatedBy:    clientMSPID,
+		ID:           id,
+		Region:       previous.Region,
+		Source:       source,
+		Status:       FactorActive,
+		Unit:         previous.Unit,
+		ValidFrom:    validFrom,
+		ValidTo:      validTo,
+		Version:      previous.Version + 1,
+	}
+	err = validateEmissionFactor(&factor)
+	if err != nil {
+		return err
+	}
+	err = putEmissionFactor(ctx, &factor)
+	if err != nil {
+		return err
+	}
+
+	previous.Status = FactorSuperseded
+	previous.SupersededBy = factor.Version
+	return putEmissionFactor(ctx, previous)
+}
+
+// DeprecateEmissionFactor marks the current version of an emission factor as deprecated, so it cannot be used for new calculations
+func (s *SmartContract) DeprecateEmissionFactor(ctx contractapi.TransactionContextInterface, id string, reason string) error {
+	_, err := verifyClientIsFactorAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if len(reason) == 0 {
+		return fmt.Errorf("reason must be a non-empty string")
+	}
+
+	factor, err := s.GetCurrentEmissionFactor(ctx, id)
+	if err != nil {
+		return err
+	}
+	if factor.Status == FactorDeprecated {
+		return fmt.Errorf("the emission factor with ID %s is already deprecated", id)
+	}
+
+	factor.Status = FactorDeprecated
+	factor.DeprecationReason = reason
+	return putEmissionFactor(ctx, factor)
+}
+
+// GetEmissionFactor returns the given version of an emission factor
+func (s *SmartContract) GetEmissionFactor(ctx contractapi.TransactionContextInterface, id string, version int) (*EmissionFactor, error) {
+	key, err := emissionFactorKey(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	factorJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if factorJSON == nil {
+		return nil, fmt.Errorf("version %d of the emission factor with ID %s does not exist", version, id)
+	}
+
+	var factor EmissionFactor
+	err = json.Unmarshal(factorJSON, &factor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &factor, nil
+}
+
+// GetCurrentEmissionFactor returns the latest version of an emission factor
+func (s *SmartContract) GetCurrentEmissionFactor(ctx contractapi.TransactionContextInterface, id string) (*EmissionFactor, error) {
+	factor, err := latestEmissionFactor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil {
+		return nil, fmt.Errorf("the emission factor with ID %s does not exist", id)
+	}
+	return factor, nil
+}
+
+// GetEmissionFactorVersions returns all versions of an emission factor, oldest first
+func (s *SmartContract) GetEmissionFactorVersions(ctx contractapi.TransactionContextInterface, id string) ([]*EmissionFactor, error) {
+	return emissionFactorVersions(ctx, id)
+}
+
+// FindEmissionFactors returns the current versions of all active emission factors for an activity type and region
+// which are valid at the time of the transaction
+func (s *SmartContract) FindEmissionFactors(ctx contractapi.TransactionContextInterface, activityType string, region string) ([]*EmissionFactor, error) {
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(emissionFactorIndexObjectType, []string{activityType, region})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var factors []*EmissionFactor
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		factor, err := s.GetCurrentEmissionFactor(ctx, keyParts[2])
+		if err != nil {
+			return nil, err
+		}
+		if factor.Status != FactorActive || checkFactorValidity(factor, now) != nil {
+			continue
+		}
+		factors = append(factors, factor)
+	}
+
+	return factors, nil
+}
+
+// HELPER FUNCTION usableEmissionFactor returns the current version of an emission factor if it may be used for a new calculation
+func (s *SmartContract) usableEmissionFactor(ctx contractapi.TransactionContextInterface, id string) (*EmissionFactor, error) {
+	factor, err := s.GetCurrentEmissionFactor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if factor.Status != FactorActive {
+		return nil, fmt.Errorf("the emission factor with ID %s is %s and cannot be used for new calculations", id, factor.Status)
+	}
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = checkFactorValidity(factor, now)
+	if err != nil {
+		return nil, err
+	}
+	return factor, nil
+}
+
+// HELPER FUNCTION checkFactorValidity checks that the given time lies within the validity period of the factor
+func checkFactorValidity(factor *EmissionFactor, now time.Time) error {
+	validFrom, err := time.Parse(dateLayout, factor.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("invalid start of validity period: %v", err)
+	}
+	validTo, err := time.Parse(dateLayout, factor.ValidTo)
+	if err != nil {
+		return fmt.Errorf("invalid end of validity period: %v", err)
+	}
+	if now.Before(validFrom) || !now.Before(validTo.AddDate(0, 0, 1)) {
+		return fmt.Errorf("version %d of the emission factor with ID %s is only valid from %s to %s", factor.Version, factor.ID, factor.ValidFrom, factor.ValidTo)
+	}
+	return nil
+}
+
+// HELPER FUNCTION validateEmissionFactor checks the values of a new emission factor version
+func validateEmissionFactor(factor *EmissionFactor) error {
+	if _, ok := quantityUnits[factor.Unit]; !ok {
+		return fmt.Errorf("unknown unit of activity data %s", factor.Unit)
+	}
+	if len(factor.Source) == 0 {
+		return fmt.Errorf("source must be a non-empty string")
+	}
+	validFrom, err := time.Parse(dateLayout, factor.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("start of validity period must be given as YYYY-MM-DD: %v", err)
+	}
+	validTo, err := time.Parse(dateLayout, factor.ValidTo)
+	if err != nil {
+		return fmt.Errorf("end of validity period must be given as YYYY-MM-DD: %v", err)
+	}
+	if validTo.Before(validFrom) {
+		return fmt.Errorf("validity period must not end before it starts")
+	}
+	return nil
+}
+
+// HELPER FUNCTION parseCO2ePerUnit checks the value of an emission factor, which must be given in CO2 equivalents
+func parseCO2ePerUnit(value string, unit string) (Quantity, error) {
+	co2ePerUnit, err := parseQuantity(value, unit)
+	if err != nil {
+		return Quantity{}, fmt.Errorf("invalid emission factor: %v", err)
+	}
+	if quantityUnits[unit].dimension != "CO2e" {
+		return Quantity{}, fmt.Errorf("emission factor must be given in %s, %s or %s per unit, got %s", UnitGramCO2e, UnitKgCO2e, UnitTonneCO2e, unit)
+	}
+	return co2ePerUnit, nil
+}
+
+// HELPER FUNCTION emissionFactorVersions reads all versions of an emission factor, oldest first
+func emissionFactorVersions(ctx contractapi.TransactionContextInterface, id string) ([]*EmissionFactor, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(emissionFactorObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var factors []*EmissionFactor
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var factor EmissionFactor
+		err = json.Unmarshal(queryResponse.Value, &factor)
+		if err != nil {
+			return nil, err
+		}
+		factors = append(factors, &factor)
+	}
+
+	return factors, nil
+}
+
+// HELPER FUNCTION latestEmissionFactor returns the latest version of an emission factor or nil if the factor does not exist
+func latestEmissionFactor(ctx contractapi.TransactionContextInterface, id string) (*EmissionFactor, error) {
+	factors, err := emissionFactorVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(factors) == 0 {
+		return nil, nil
+	}
+	// Versions are zero-padded in the key, therefore the range query returns them in ascending order
+	return factors[len(factors)-1], nil
+}
+
+// HELPER FUNCTION emissionFactorKey creates the ledger key of a specific version of an emission factor
+func emissionFactorKey(ctx contractapi.TransactionContextInterface, id string, version int) (string, error) {
+	if version <= 0 {
+		return "", fmt.Errorf("emission factor version must be positive, got %d", version)
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(emissionFactorObjectType, []string{id, fmt.Sprintf("%08d", version)})
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return key, nil
+}
+
+// HELPER FUNCTION putEmissionFactor writes a version of an emission factor to the ledger
+func putEmissionFactor(ctx contractapi.TransactionContextInterface, factor *EmissionFactor) error {
+	key, err := emissionFactorKey(ctx, factor.ID, factor.Version)
+	if err != nil {
+		return err
+	}
+	factorJSON, err := json.Marshal(factor)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, factorJSON)
+}
+
+// HELPER FUNCTION verifyClientIsFactorAdmin checks that the client holds the factor-admin role and returns its MSPID
+func verifyClientIsFactorAdmin(ctx contractapi.TransactionContextInterface) (string, error) {
+	err := verifyClientHasRole(ctx, RoleFactorAdmin)
+	if err != nil {
+		return "", fmt.Errorf("client is not authorized to maintain emission factors: %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	return clientMSPID, nil
+}
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
-	"sort"
+	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// dateLayout is the format of calendar dates stored on the ledger
+const dateLayout = "2006-01-02"
+
+// adminMSPID is the organization that maintains reference data such as GWP tables
+const adminMSPID = "Org1MSP"
+
+// Attributes of the client certificates issued by the Fabric CA of an organization
+const (
+	supplierIDAttribute = "supplierID"        // Identifies the supplier a client acts for, all clients of a supplier share its records
+	delegateAttribute   = "emissionsDelegate" // Set to "true" to allow a client to act on behalf of other owners of its organization
+)
+
 // Import hyperledger fabric SmartContract
 type SmartContract struct {
 	contractapi.Contract
@@ -18,20 +32,44 @@ type SmartContract struct {
 // Emissions Record describes which emissions are being tracked
 // Alphabetic order to achieve determinism accross languages
 type EmissionsRecord struct {
-	ID    string `json:"ID"`
-	KgCO2 int    `json:"KgCO2"` // Total emissions in Kg of CO2
+	Amendment       *Amendment           `json:"Amendment,omitempty" metadata:",optional"`   // Set if the record is a revision of an earlier record
+	Attestation     *Attestation         `json:"Attestation,omitempty" metadata:",optional"` // Assurance level and verifier of the latest attestation of exactly this revision
+	CO2e            *Quantity            `json:"CO2e,omitempty" metadata:",optional"`        // Exact emissions in the unit they were submitted or calculated in, not set for records created before
+	Calculation     *ActivityCalculation `json:"Calculation,omitempty" metadata:",optional"` // Inputs of the calculation if the emissions were calculated from activity data
+	Category        int                  `json:"Category"`                                   // GHG Protocol Scope 3 category (1-15), 0 for Scope 1 and 2
+	DocType         string               `json:"DocType"`                                    // Always emissionsRecord, distinguishes records from other objects in rich queries
+	FacilityID      string               `json:"FacilityID,omitempty" metadata:",optional"`  // Facility of the owner's organization the emissions are attributed to
+	GWPTableID      string               `json:"GWPTableID"`                                 // GWP table used to convert the gases into CO2 equivalents
+	Gases           map[string]int       `json:"Gases,omitempty" metadata:",optional"`       // Emissions per greenhouse gas in Kg of the gas itself
+	ID              string               `json:"ID"`
+	KgCO2           int                  `json:"KgCO2"`                                          // Total emissions in whole Kg of CO2 equivalents, CO2e rounded half up
+	OutlierCheck    *OutlierDecision     `json:"OutlierCheck,omitempty" metadata:",optional"`    // Decision of the automated audit, including the method and parameters used
+	ProductCategory string               `json:"ProductCategory,omitempty" metadata:",optional"` // Category of the product the emissions belong to, selects the outlier policy
+	ReportingPeriod string               `json:"ReportingPeriod,omitempty" metadata:",optional"` // Reporting period of the owner's organization the emissions are assigned to
+	Scope           int                  `json:"Scope"`                                          // GHG Protocol scope (1, 2 or 3)
+	Timestamp       string               `json:"Timestamp,omitempty" metadata:",optional"`       // Time the emissions were submitted for the audit
 }
 
 // EmissionsRecordPrivateDetails describes details that are private to owner/creator of the emissions record
 type EmissionsRecordPrivateDetails struct {
-	ID    string `json:"ID"`
-	Owner string `json:"Owner"` // Identifier based on MSPID and ID of the client's identity
+	FacilityID      string `json:"FacilityID,omitempty" metadata:",optional"` // Copied from the public record, so the inventory of a facility can be queried
+	ID              string `json:"ID"`
+	Owner           string `json:"Owner"`                                          // Identifier based on MSPID and ID or supplierID attribute of the client's identity
+	ProductCategory string `json:"ProductCategory"`                                // Copied from the public record, so the history of an owner can be queried per product category
+	ReportingPeriod string `json:"ReportingPeriod,omitempty" metadata:",optional"` // Copied from the public record, so the inventory of a period can be queried
 }
 
-
-// CreateEmissionsRecord adds a new emissions record to the ledger
-// Maybe this should be a private function, but for now it is public
-func (s *SmartContract) CreateEmissionsRecord(ctx contractapi.TransactionContextInterface, id string, kgCO2 int) error {
+// CreateEmissionsRecord adds a new emissions record to the ledger without the automated audit
+// Only auditors can create records directly, all other emissions have to pass AuditEmissions
+func (s *SmartContract) CreateEmissionsRecord(ctx contractapi.TransactionContextInterface, id string, kgCO2 int, scope int, category int) error {
+	_, err := verifyClientIsAuditor(ctx)
+	if err != nil {
+		return err
+	}
+	err = validateScope(scope, category)
+	if err != nil {
+		return err
+	}
 	// Check if the emissions record already exists
 	exists, err := s.EmissionsRecordExists(ctx, id)
 	if err != nil {
@@ -41,28 +79,33 @@ func (s *SmartContract) CreateEmissionsRecord(ctx contractapi.TransactionContext
 		return fmt.Errorf("the Emissions Record with ID %s already exists", id)
 	}
 
+	co2e, err := quantityFromInt(kgCO2, UnitKgCO2e)
+	if err != nil {
+		return err
+	}
+
 	// Create a new emissions record
 	emissionsRecord := EmissionsRecord{
-		ID:    id,
-		KgCO2: kgCO2,
+		Category: category,
+		Gases:    map[string]int{"CO2": kgCO2},
+		ID:       id,
+		Scope:    scope,
 	}
-	recordJSON, err := json.Marshal(emissionsRecord) // Convert the emissions record to JSON
+	err = setRecordEmissions(&emissionsRecord, co2e)
 	if err != nil {
 		return err
 	}
-
-	return ctx.GetStub().PutState(id, recordJSON) // Write the emissions record to the ledger
+	return putEmissionsRecord(ctx, &emissionsRecord)
 }
 
-
-// CreateEmissionsRecordPrivateDetails adds new private emissions record details to the private data collection
-// Transient Data: ownerID string
-// Maybe this should be a private function, but for now it is public
-func (s *SmartContract) CreateEmissionsRecordPrivateDetails(ctx contractapi.TransactionContextInterface, id string) error {
-	// Get new emissions data from transient map
-	transientOwnerID, err := getTransientData(ctx, "ownerID") // OPTIONAL TODO: Check if the ownerID is a valid ID
+// HELPER FUNCTION createEmissionsRecordPrivateDetails adds new private emissions record details to the private data collection
+// It is only called for records that passed the audit, otherwise any client could claim the ownership of a record
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) createEmissionsRecordPrivateDetails(ctx contractapi.TransactionContextInterface, id string) error {
+	// The owner is derived from the verified identity of the client
+	ownerID, err := getOwnerID(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get transient: %v", err)
+		return err
 	}
 	// Check if emissons record already exists on private data collection
 	// Get collection name for this organization.
@@ -87,27 +130,28 @@ func (s *SmartContract) CreateEmissionsRecordPrivateDetails(ctx contractapi.Tran
 		return fmt.Errorf("CreateAsset cannot be performed: Error %v", err)
 	}
 
-	// Save emissionRecordDetails to collection visible to owning organization
-	emissionsRecordPrivateDetails := EmissionsRecordPrivateDetails{
-		ID:    id,
-		Owner: string(transientOwnerID),
-	}
-
-	emissionsRecordPrivateDetailsAsBytes, err := json.Marshal(emissionsRecordPrivateDetails) // marshal private record details to JSON
+	// The product category of the public record is kept with the private details to build the audit baseline of the owner
+	record, err := s.GetEmissionsRecord(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed to marshal into JSON: %v", err)
+		return err
 	}
 
-	// Put private details of emissions Record into owners org specific private data collection
-	err = ctx.GetStub().PutPrivateData(orgCollection, id, emissionsRecordPrivateDetailsAsBytes)
-	if err != nil {
-		return fmt.Errorf("failed to put emissionsRecord private details: %v", err)
-	}
-	return nil
+	// Save emissionRecordDetails to collection visible to owning organization
+	return putEmissionsRecordPrivateDetails(ctx, orgCollection, record, ownerID)
 }
 
 // GetEmissionsRecord returns the record stored in the ledger with the given id.
+// Amended records resolve to their latest revision
 func (s *SmartContract) GetEmissionsRecord(ctx contractapi.TransactionContextInterface, id string) (*EmissionsRecord, error) {
+	record, err := s.GetEmissionsRecordRevision(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveLatestRevision(ctx, record)
+}
+
+// GetEmissionsRecordRevision returns exactly the record stored in the ledger with the given id, even if it was amended later on
+func (s *SmartContract) GetEmissionsRecordRevision(ctx contractapi.TransactionContextInterface, id string) (*EmissionsRecord, error) {
 	recordJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from ledger: %v", err)
@@ -138,72 +182,64 @@ func (s *SmartContract) GetEmissionsRecordsList(ctx contractapi.TransactionConte
 	return records, nil
 }
 
-// GetAllEmissionsRecords returns all emissions records stored in the ledger
-// This function should be used only for testing purposes
-func (s *SmartContract) GetAllEmissionsRecords(ctx contractapi.TransactionContextInterface) ([]*EmissionsRecord, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+// GetOwnedEmissionsRecords returns the latest revisions of the given emissions records if all of them passed the audit and belong to the invoking organization
+// It is invoked by the asset chaincode to reject dangling or foreign emissions IDs, amended records are owned by the owner of their original record
+func (s *SmartContract) GetOwnedEmissionsRecords(ctx contractapi.TransactionContextInterface, ids []string) ([]*EmissionsRecord, error) {
+	err := verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("GetOwnedEmissionsRecords cannot be performed: Error %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the client's MSPID: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var records []*EmissionsRecord
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
+	records := []*EmissionsRecord{}
+	for _, id := range ids {
+		// Only records that passed the automated audit or were approved by an auditor are written to the ledger
+		record, err := s.GetEmissionsRecordRevision(ctx, id)
 		if err != nil {
+			auditCase, caseErr := s.GetAuditCase(ctx, id)
+			if caseErr == nil {
+				return nil, fmt.Errorf("the emissions record %s has not passed the audit, its audit case is %s", id, auditCase.Status)
+			}
 			return nil, err
 		}
-
-		var record EmissionsRecord
-		err = json.Unmarshal(queryResponse.Value, &record)
+		rootID := record.ID
+		if record.Amendment != nil {
+			rootID = record.Amendment.RootID
+		}
+		// The private details only exist in the collection of the organization owning the record
+		details, err := s.GetEmissionsRecordPrivateDetails(ctx, rootID)
+		if err != nil {
+			return nil, err
+		}
+		if details == nil {
+			return nil, fmt.Errorf("the emissions record %s is not owned by %s", id, clientMSPID)
+		}
+		latest, err := s.resolveLatestRevision(ctx, record)
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, &record)
+		records = append(records, latest)
 	}
-
 	return records, nil
 }
 
 // GetEmissionsRecordsOfOwner returns all emissions records stored in the private data collection for the invoking owner
-// Transient Data: ownerID string
+// Transient Data: ownerID string (optional, delegates only)
 func (s *SmartContract) GetEmissionsRecordsOfOwner(ctx contractapi.TransactionContextInterface) ([]*EmissionsRecordPrivateDetails, error) {
 	// Get collection name for this organization.
 	orgCollection, err := getCollectionName(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
-	// Get ownerID from transient data
-	ownerID, err := getTransientData(ctx, "ownerID")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get ownerID from transient data: %v", err)
-	}
-
-	queryString := fmt.Sprintf(`{"selector":{"Owner":"%s"}}`, ownerID)
-	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(orgCollection, queryString)
+	ownerID, err := getOwnerID(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute the private data query: %w", err)
-	}
-	defer resultsIterator.Close()
-
-	var recordsDetails []*EmissionsRecordPrivateDetails
-
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate over private data query results: %w", err)
-		}
-
-		var record EmissionsRecordPrivateDetails
-		err = json.Unmarshal(queryResponse.Value, &record)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal struct JSON: %w", err)
-		}
-
-		recordsDetails = append(recordsDetails, &record)
+		return nil, err
 	}
 
-	return recordsDetails, nil
+	return queryEmissionsRecordsOfOwner(ctx, orgCollection, ownerID, nil)
 }
 
 // GetEmissionsRecordPrivateDetails reads the private details of an emissions Record in organization specific collection
@@ -232,50 +268,104 @@ func (s *SmartContract) GetEmissionsRecordPrivateDetails(ctx contractapi.Transac
 	return recordDetails, nil
 }
 
-// GetAllEmissionsRecordsPrivateDetails returns all emissions records private details stored in the private data collection of the invoking organization
-// This function should be used only for testing purposes
-func (s *SmartContract) GetAllEmissionsRecordsPrivateDetails(ctx contractapi.TransactionContextInterface) ([]*EmissionsRecordPrivateDetails, error) {
-	// Get collection name for this organization.
-	orgCollection, err := getCollectionName(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
-	}
-	resultsIterator, err := ctx.GetStub().GetPrivateDataByRange(orgCollection, "", "")
+// EmissionsRecordExists returns true when record with given ID exists in ledger
+func (s *SmartContract) EmissionsRecordExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	recordJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("failed to read from ledger: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var records []*EmissionsRecordPrivateDetails
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
+	return recordJSON != nil, nil
+}
 
-		var record EmissionsRecordPrivateDetails
-		err = json.Unmarshal(queryResponse.Value, &record)
-		if err != nil {
-			return nil, err
-		}
-		records = append(records, &record)
+// AuditEmissions takes emissions data from an organization, checks its validity and adds it to the ledger
+// The submitted emissions are treated as pure CO2
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) AuditEmissions(ctx contractapi.TransactionContextInterface, id string, kgCO2 int, scope int, category int, productCategory string, info string) error {
+	if kgCO2 < 0 {
+		return fmt.Errorf("emissions must not be negative")
 	}
-
-	return records, nil
+	co2e, err := quantityFromInt(kgCO2, UnitKgCO2e)
+	if err != nil {
+		return err
+	}
+	record := EmissionsRecord{
+		Category:        category,
+		Gases:           map[string]int{"CO2": kgCO2},
+		ID:              id,
+		ProductCategory: productCategory,
+		Scope:           scope,
+	}
+	err = setRecordEmissions(&record, co2e)
+	if err != nil {
+		return err
+	}
+	return s.auditEmissionsRecord(ctx, &record, info)
 }
 
-// EmissionsRecordExists returns true when record with given ID exists in ledger
-func (s *SmartContract) EmissionsRecordExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	recordJSON, err := ctx.GetStub().GetState(id)
+// AuditQuantityEmissions works like AuditEmissions, but takes the CO2 equivalents as exact decimal in gCO2e, kgCO2e or tCO2e,
+// so the emissions of small parts are not rounded away. The record keeps the exact value, KgCO2 holds it rounded to whole Kg
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) AuditQuantityEmissions(ctx contractapi.TransactionContextInterface, id string, value string, unit string, scope int, category int, productCategory string, info string) error {
+	co2e, err := parseQuantity(value, unit)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from ledger: %v", err)
+		return err
+	}
+	record := EmissionsRecord{
+		Category:        category,
+		ID:              id,
+		ProductCategory: productCategory,
+		Scope:           scope,
+	}
+	err = setRecordEmissions(&record, co2e)
+	if err != nil {
+		return err
 	}
+	return s.auditEmissionsRecord(ctx, &record, info)
+}
 
-	return recordJSON != nil, nil
+// AuditGasEmissions takes per-gas emissions data from an organization, converts it into CO2 equivalents
+// with the given GWP table, checks its validity and adds it to the ledger
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) AuditGasEmissions(ctx contractapi.TransactionContextInterface, id string, gases map[string]int, gwpTableID string, scope int, category int, productCategory string, info string) error {
+	table, err := s.GetGWPTable(ctx, gwpTableID)
+	if err != nil {
+		return err
+	}
+	co2e, err := calculateCO2e(gases, table)
+	if err != nil {
+		return fmt.Errorf("failed to calculate CO2 equivalents: %v", err)
+	}
+	record := EmissionsRecord{
+		Category:        category,
+		GWPTableID:      table.ID,
+		Gases:           gases,
+		ID:              id,
+		ProductCategory: productCategory,
+		Scope:           scope,
+	}
+	err = setRecordEmissions(&record, co2e)
+	if err != nil {
+		return err
+	}
+	return s.auditEmissionsRecord(ctx, &record, info)
 }
 
-// AuditEmissions takes emissions data from an organization, checks its validity and adds it to the ledger
-func (s *SmartContract) AuditEmissions(ctx contractapi.TransactionContextInterface, id string, prevEmissionsIDs []string, kgCO2 int, info string) error {
+// HELPER FUNCTION auditEmissionsRecord checks the CO2e total of a new record against the previous emissions of the owner
+// and writes the record to the ledger if it passes the audit
+// The previous emissions are taken from the private data collection of the owner, so the submitter cannot choose them
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) auditEmissionsRecord(ctx contractapi.TransactionContextInterface, record *EmissionsRecord, info string) error {
+	id := record.ID
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	// Check that the emissions are classified according to the GHG Protocol
+	err = validateScope(record.Scope, record.Category)
+	if err != nil {
+		return err
+	}
 	// Check if the emissions record already exists on public ledger
 	exists, err := s.EmissionsRecordExists(ctx, id)
 	if err != nil {
@@ -284,113 +374,238 @@ func (s *SmartContract) AuditEmissions(ctx contractapi.TransactionContextInterfa
 	if exists {
 		return fmt.Errorf("the Emissions Record with ID %s already exists", id)
 	}
+	// Check if the emissions are already waiting for a manual re-audit
+	exists, err = s.AuditCaseExists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("an audit case for the Emissions Record with ID %s already exists", id)
+	}
 
 	// Check if the emissions matche the expected value
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	record.Timestamp = txTime.Format(time.RFC3339)
 
-	// If no records exist, no outlier detection is possible
-	if len(prevEmissionsIDs) > 0 {
-		// Get the emissions records from the ledger
-		records, err := s.GetEmissionsRecordsList(ctx, prevEmissionsIDs)
-		if err != nil {
-			return fmt.Errorf("unable to retrieve emissionsRecords from ledger")
-		}
+	// Assign the emissions to a reporting period of the organization, closed periods do not accept new emissions
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	record.ReportingPeriod, err = assignReportingPeriod(ctx, clientMSPID, txTime)
+	if err != nil {
+		return err
+	}
+	// Attribute the emissions to a facility of the organization, calculated emissions must use a factor of its region
+	facility, err := assignFacility(ctx, clientMSPID, record, txTime)
+	if err != nil {
+		return err
+	}
+	if facility != nil {
+		record.FacilityID = facility.ID
+	}
+	err = s.verifyFactorRegion(ctx, record, facility)
+	if err != nil {
+		return err
+	}
 
-		if len(records) == 0 {
-			return fmt.Errorf("records on public ledger do not match records in private collection")
-		}
+	// Get the previous emissions records of the owner for the same product category
+	baselineIDs, records, err := s.getAuditBaseline(ctx, record.ProductCategory)
+	if err != nil {
+		return err
+	}
+
+	// Check if submitted emissions match expected range with the outlier detection configured for the org and product category
+	policy, err := resolveOutlierPolicy(ctx, clientMSPID, record.ProductCategory)
+	if err != nil {
+		return err
+	}
+	// The decision is stored with the record, so the method and parameters of the audit can be traced
+	record.OutlierCheck, err = evaluateOutlier(record, records, policy, txTime)
+	if err != nil {
+		return err
+	}
 
-		// Check if submitted emissions match expected range with a simple outlier detection
-		// Extract Emissions from records
-		previousEmissions := make([]int, len(records))
-		for i, record := range records {
-			previousEmissions[i] = record.KgCO2
+	// Records are only approved automatically if the decision is based on enough previous emissions of the owner
+	if record.OutlierCheck.BaselineSize < policy.MinHistory {
+		reason := fmt.Sprintf("the submitted emissions cannot be audited automatically: %d previous records available, %d required",
+			record.OutlierCheck.BaselineSize, policy.MinHistory)
+		err = createAuditReport(ctx, record, baselineIDs, info, ReportManual, reason)
+		if err != nil {
+			return err
 		}
-		// Check if the submitted emissions are an outlier
-		if isOutlier(kgCO2, previousEmissions) {
-			return fmt.Errorf("the submitted emissions do not pass the automated Audit, please contact an administrator for manual reauditing")
+		return s.openAuditCase(ctx, CaseKindAudit, record, baselineIDs, info, reason)
+	}
+	// Outliers are not rejected, but kept in an audit case until an auditor re-audits them manually
+	if record.OutlierCheck.Outlier {
+		reason := fmt.Sprintf("the submitted emissions do not pass the automated Audit: %s %s is outside [%s, %s] KgCO2e (%s)",
+			record.CO2e.Value, record.CO2e.Unit, record.OutlierCheck.LowerFence.Value, record.OutlierCheck.UpperFence.Value, record.OutlierCheck.AppliedRule)
+		err = createAuditReport(ctx, record, baselineIDs, info, ReportManual, reason)
+		if err != nil {
+			return err
 		}
+		return s.openAuditCase(ctx, CaseKindAudit, record, baselineIDs, info, reason)
 	}
 
-	// Emissions are valid, add them to the ledger
+	// Emissions are valid, add them to the ledger together with the report of the audit
+	err = createAuditReport(ctx, record, baselineIDs, info, ReportPassed, "the submitted emissions pass the automated Audit")
+	if err != nil {
+		return err
+	}
 	// Create a new emissions record
-	err = s.CreateEmissionsRecord(ctx, id, kgCO2)
+	err = putEmissionsRecord(ctx, record)
 	if err != nil {
 		return fmt.Errorf("failed to create emissions record: %v", err)
 	}
-	return s.CreateEmissionsRecordPrivateDetails(ctx, id)
+	err = s.createEmissionsRecordPrivateDetails(ctx, id)
+	if err != nil {
+		return err
+	}
+	// The organization of the owner receives tokens for the audited emissions
+	return mintEmissionsTokens(ctx, clientMSPID, record)
 }
 
-// HELPER FUNCTION isOutlier checks if a value is an outlier in a given set of values based on the Median Absolute Deviation (MAD) method
-func isOutlier(value int, values []int) bool {
-	// No outlier detection is possible if there are no values
-	if len(values) == 0 {
-		return false
+// HELPER FUNCTION getAuditBaseline returns the IDs and public records of the previous emissions of the owner for a product category
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) getAuditBaseline(ctx contractapi.TransactionContextInterface, productCategory string) ([]string, []*EmissionsRecord, error) {
+	ownerID, err := getOwnerID(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The history of the owner is read from the private data collection of this peer
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("AuditEmissions cannot be performed: Error %v", err)
 	}
-	// For 1-4 values, use the simple outlier detection method where values can differentiate by 50%
-	if len(values) < 5 {
-		// Calculate the median
-		median := calculateMedian(values)
-		lowerFence := median * 0.5
-		upperFence := median * 1.5
-		return float64(value) < lowerFence || float64(value) > upperFence
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
-	// For more than 4 values, calculate quantiles 
-	// Sort the values in ascending order
-	sortedValues := make([]int, len(values))
-	copy(sortedValues, values)
-	sort.Ints(sortedValues)
+	recordsDetails, err := queryEmissionsRecordsOfOwner(ctx, orgCollection, ownerID, &productCategory)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Calculate the first quartile (25th percentile) and the third quartile (75th percentile)
-	q1 := calculatePercentile(sortedValues, 25)
-	q3 := calculatePercentile(sortedValues, 75)
+	ids := []string{}
+	var records []*EmissionsRecord
+	for _, details := range recordsDetails {
+		record, err := s.GetEmissionsRecord(ctx, details.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("records on public ledger do not match records in private collection: %v", err)
+		}
+		// Amended records are compared with their latest revision
+		ids = append(ids, record.ID)
+		records = append(records, record)
+	}
+	return ids, records, nil
+}
 
-	// Calculate the interquartile range (IQR)
-	iqr := q3 - q1
+// HELPER FUNCTION queryEmissionsRecordsOfOwner returns the private details of all records of an owner in the given collection
+// If productCategory is not nil, only records of that product category are returned
+func queryEmissionsRecordsOfOwner(ctx contractapi.TransactionContextInterface, collection string, ownerID string, productCategory *string) ([]*EmissionsRecordPrivateDetails, error) {
+	// Build the selector with the JSON encoder, so the values cannot alter the query
+	selector := map[string]string{"Owner": ownerID}
+	if productCategory != nil {
+		selector["ProductCategory"] = *productCategory
+	}
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, err
+	}
 
-	// Calculate the lower and upper fences
-	lowerFence := q1 - (1.5 * float64(iqr))
-	upperFence := q3 + (1.5 * float64(iqr))
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(collection, string(queryJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the private data query: %w", err)
+	}
+	defer resultsIterator.Close()
 
-	// Check if the value is an outlier
-	return float64(value) < lowerFence || float64(value) > upperFence
-}
+	var recordsDetails []*EmissionsRecordPrivateDetails
 
-// HELPER FUNCTION calculatePercentile calculates the percentile of a given set of values
-func calculatePercentile(sortedValues []int, percentile int) float64 {
-	length := len(sortedValues)
-	index := (percentile * (length + 1) / 100) - 1
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate over private data query results: %w", err)
+		}
+
+		var record EmissionsRecordPrivateDetails
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal struct JSON: %w", err)
+		}
+
+		recordsDetails = append(recordsDetails, &record)
+	}
+
+	return recordsDetails, nil
+}
 
-	if index < 0 {
-		return float64(sortedValues[0])
-	} else if index >= length-1 {
-		return float64(sortedValues[length-1])
+// HELPER FUNCTION putEmissionsRecord writes an emissions record to the ledger
+func putEmissionsRecord(ctx contractapi.TransactionContextInterface, record *EmissionsRecord) error {
+	record.DocType = emissionsRecordDocType
+	recordJSON, err := json.Marshal(record) // Convert the emissions record to JSON
+	if err != nil {
+		return err
 	}
 
-	lowerValue := float64(sortedValues[index])
-	upperValue := float64(sortedValues[index+1])
+	return ctx.GetStub().PutState(record.ID, recordJSON) // Write the emissions record to the ledger
+}
 
-	return lowerValue + (upperValue-lowerValue)*(float64(percentile%100)/100.0)
+// HELPER FUNCTION setRecordEmissions stores the exact emissions of a record and their value rounded to whole Kg of CO2 equivalents
+func setRecordEmissions(record *EmissionsRecord, co2e Quantity) error {
+	kgCO2e, err := wholeKgCO2e(co2e)
+	if err != nil {
+		return err
+	}
+	record.CO2e = &co2e
+	record.KgCO2 = kgCO2e
+	return nil
 }
 
-// HELPER FUNCTION calculateMedian calculates the median of a given set of values
-func calculateMedian(data []int) float64 {
-	dataCopy := make([]int, len(data))
-	copy(dataCopy, data)
+// HELPER FUNCTION recordCO2e returns the exact emissions of a record, records created before exact emissions were introduced only have whole Kg
+func recordCO2e(record *EmissionsRecord) (Quantity, error) {
+	if record.CO2e != nil {
+		return *record.CO2e, nil
+	}
+	return quantityFromInt(record.KgCO2, UnitKgCO2e)
+}
+
+// HELPER FUNCTION putEmissionsRecordPrivateDetails writes the private details of an emissions record to the given collection
+func putEmissionsRecordPrivateDetails(ctx contractapi.TransactionContextInterface, collection string, record *EmissionsRecord, owner string) error {
+	emissionsRecordPrivateDetails := EmissionsRecordPrivateDetails{
+		ID:              record.ID,
+		Owner:           owner,
+		ProductCategory: record.ProductCategory,
+		FacilityID:      record.FacilityID,
+		ReportingPeriod: record.ReportingPeriod,
+	}
 
-	sort.Ints(dataCopy)
+	emissionsRecordPrivateDetailsAsBytes, err := json.Marshal(emissionsRecordPrivateDetails) // marshal private record details to JSON
+	if err != nil {
+		return fmt.Errorf("failed to marshal into JSON: %v", err)
+	}
 
-	var median float64
-	l := len(dataCopy)
-	if l == 0 {
-		return 0
-	} else if l%2 == 0 {
-		median = float64(dataCopy[l/2-1]+dataCopy[l/2]) / 2
-	} else {
-		median = float64(dataCopy[l/2])
+	// Put private details of emissions Record into owners org specific private data collection
+	err = ctx.GetStub().PutPrivateData(collection, record.ID, emissionsRecordPrivateDetailsAsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put emissionsRecord private details: %v", err)
 	}
+	return nil
+}
 
-	return median
+// HELPER FUNCTION verifyClientIsAdmin checks that the client belongs to the administrating organization of the channel
+func verifyClientIsAdmin(ctx contractapi.TransactionContextInterface) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	if clientMSPID != adminMSPID {
+		return fmt.Errorf("client from org %v is not authorized to administrate the emissions chaincode", clientMSPID)
+	}
+	return nil
 }
 
 // HELPER FUNCTIONS verifyClientOrgMatchesPeerOrg is an internal function used verify client org id and matches peer org id.
@@ -425,23 +640,72 @@ func getCollectionName(ctx contractapi.TransactionContextInterface) (string, err
 	return orgCollection, nil
 }
 
-// HELPER FUNCTION getTransientData to extract transient data from the transaction proposal
-func getTransientData(ctx contractapi.TransactionContextInterface, key string) (string, error) {
-	// Get data from transient map
+// HELPER FUNCTION getClientIdentifier returns an identifier of the submitting client based on its MSPID and the ID of its identity
+func getClientIdentifier(ctx contractapi.TransactionContextInterface) (string, error) {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	b64ID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read clientID: %v", err)
+	}
+	decodeID, err := base64.StdEncoding.DecodeString(b64ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to base64 decode clientID: %v", err)
+	}
+	return clientMSPID + "::" + string(decodeID), nil
+}
+
+// HELPER FUNCTION getOwnerID returns the owner identifier of the invoking client
+// The owner is the supplierID attribute of the client's certificate if present, otherwise its MSPID and ID.
+// Clients carrying the delegation attribute may submit on behalf of another owner of their organization
+// by passing the owner identifier as transient ownerID
+func getOwnerID(ctx contractapi.TransactionContextInterface) (string, error) {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	ownerID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return "", err
+	}
+	supplierID, found, err := ctx.GetClientIdentity().GetAttributeValue(supplierIDAttribute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the %s attribute: %v", supplierIDAttribute, err)
+	}
+	if found && len(supplierID) > 0 {
+		ownerID = clientMSPID + "::" + supplierIDAttribute + "::" + supplierID
+	}
+
 	transientMap, err := ctx.GetStub().GetTransient()
 	if err != nil {
 		return "", fmt.Errorf("error getting transient: %v", err)
 	}
+	delegatedOwnerID, ok := transientMap["ownerID"]
+	if !ok || string(delegatedOwnerID) == ownerID {
+		return ownerID, nil
+	}
 
-	transientData, ok := transientMap[key]
-	if !ok {
-		return "", fmt.Errorf("key \"%v\" not found in the transient map input", key)
+	// Delegated submissions must be explicitly granted by the certificate authority of the organization
+	err = ctx.GetClientIdentity().AssertAttributeValue(delegateAttribute, "true")
+	if err != nil {
+		return "", fmt.Errorf("client is not authorized to act on behalf of owner %s: %v", delegatedOwnerID, err)
+	}
+	if !strings.HasPrefix(string(delegatedOwnerID), clientMSPID+"::") {
+		return "", fmt.Errorf("client from org %v can only act on behalf of owners of its own organization", clientMSPID)
 	}
+	return string(delegatedOwnerID), nil
+}
 
-	if len(transientData) == 0 {
-		return "", fmt.Errorf("key \"%v\" field in the transient map must be a non-empty string", key)
+// HELPER FUNCTION getTxTime returns the timestamp of the transaction proposal
+// The timestamp is set by the client and identical on all endorsing peers, unlike the local time of a peer
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
 	}
-	return string(transientData), nil
+	return timestamp.AsTime().UTC(), nil
 }
 
 // main function starts up the chaincode in the container during instantiate
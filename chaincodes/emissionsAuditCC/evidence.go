@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const evidenceObjectType = "evidence"
+const evidenceLinkObjectType = "evidenceLink"
+
+// Types of evidence documents
+const (
+	EvidenceMeterReading = "METER_READING"
+	EvidenceInvoice      = "INVOICE"
+	EvidenceLabReport    = "LAB_REPORT"
+	EvidenceOther        = "OTHER"
+)
+
+// validEvidenceTypes lists all types an evidence document can be anchored with
+var validEvidenceTypes = map[string]bool{
+	EvidenceMeterReading: true,
+	EvidenceInvoice:      true,
+	EvidenceLabReport:    true,
+	EvidenceOther:        true,
+}
+
+// contentHashPattern matches hex encoded SHA-256 hashes
+var contentHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// EvidenceDocument describes an off-chain document supporting emissions, e.g. a meter reading, invoice or lab report
+// Only the hash and metadata of the document are stored in the private data collection of the owner's organization, never its content
+// Alphabetic order to achieve determinism accross languages
+type EvidenceDocument struct {
+	AnchoredAt   string   `json:"AnchoredAt"`
+	AnchoredBy   string   `json:"AnchoredBy"`
+	ContentHash  string   `json:"ContentHash"` // Hex encoded SHA-256 hash of the content of the document
+	DocumentType string   `json:"DocumentType"`
+	MediaType    string   `json:"MediaType"` // e.g. application/pdf
+	RecordIDs    []string `json:"RecordIDs"` // Emissions records and audit cases the document supports, sorted
+	Size         int64    `json:"Size"`      // Size of the document in bytes
+	URI          string   `json:"URI"`       // Off-chain location of the document, e.g. an https or s3 URI
+}
+
+// EvidenceVerification reports whether a document is anchored in the private data collection of the invoking organization
+// Alphabetic order to achieve determinism accross languages
+type EvidenceVerification struct {
+	Anchored    bool              `json:"Anchored"`
+	ContentHash string            `json:"ContentHash"`
+	Document    *EvidenceDocument `json:"Document,omitempty" metadata:",optional"` // Not set if the document is not anchored
+	RecordIDs   []string          `json:"RecordIDs"`                               // Emissions records and audit cases the document supports
+}
+
+// AnchorEvidence links an evidence document to an emissions record or an open audit case of the invoking owner
+// The same document can support several records, anchoring it again only adds the link
+// Transient Data: evidence {ContentHash string, DocumentType string, MediaType string, Size int64, URI string}, ownerID string (optional, delegates only)
+func (s *SmartContract) AnchorEvidence(ctx contractapi.TransactionContextInterface, recordID string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("AnchorEvidence cannot be performed: Error %v", err)
+	}
+
+	// The document metadata is private, therefore it is passed as transient data instead of function arguments
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+	evidenceJSON, ok := transientMap["evidence"]
+	if !ok {
+		return fmt.Errorf("evidence not found in the transient map input")
+	}
+	var input EvidenceDocument
+	err = json.Unmarshal(evidenceJSON, &input)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	input.ContentHash = strings.ToLower(input.ContentHash)
+	err = validateEvidence(&input)
+	if err != nil {
+		return err
+	}
+
+	err = s.verifyEvidenceSubject(ctx, recordID)
+	if err != nil {
+		return err
+	}
+
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	document, err := getEvidence(ctx, orgCollection, input.ContentHash)
+	if err != nil {
+		return err
+	}
+	if document == nil {
+		txTime, err := getTxTime(ctx)
+		if err != nil {
+			return err
+		}
+		clientID, err := getClientIdentifier(ctx)
+		if err != nil {
+			return err
+		}
+		document = &EvidenceDocument{
+			AnchoredAt:   txTime.Format(time.RFC3339),
+			AnchoredBy:   clientID,
+			ContentHash:  input.ContentHash,
+			DocumentType: input.DocumentType,
+			MediaType:    input.MediaType,
+			RecordIDs:    []string{},
+			Size:         input.Size,
+			URI:          input.URI,
+		}
+	} else if document.Size != input.Size || document.MediaType != input.MediaType {
+		// Equal hashes imply equal content, differing metadata points to a wrong hash or an error of the client
+		return fmt.Errorf("the document %s is already anchored with %d bytes of %s", input.ContentHash, document.Size, document.MediaType)
+	}
+	for _, id := range document.RecordIDs {
+		if id == recordID {
+			return fmt.Errorf("the document %s is already linked to %s", input.ContentHash, recordID)
+		}
+	}
+	document.RecordIDs = append(document.RecordIDs, recordID)
+	sort.Strings(document.RecordIDs)
+
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("failed to marshal into JSON: %v", err)
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(evidenceObjectType, []string{input.ContentHash})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutPrivateData(orgCollection, key, documentJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put evidence document: %v", err)
+	}
+
+	// The link is kept under its own key, so the hash of its value proves the link to other organizations
+	linkKey, err := ctx.GetStub().CreateCompositeKey(evidenceLinkObjectType, []string{recordID, input.ContentHash})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return ctx.GetStub().PutPrivateData(orgCollection, linkKey, []byte(input.ContentHash))
+}
+
+// GetEvidence returns an evidence document anchored in the private data collection of the invoking organization
+func (s *SmartContract) GetEvidence(ctx contractapi.TransactionContextInterface, contentHash string) (*EvidenceDocument, error) {
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	document, err := getEvidence(ctx, orgCollection, strings.ToLower(contentHash))
+	if err != nil {
+		return nil, err
+	}
+	if document == nil {
+		return nil, fmt.Errorf("the document %s is not anchored in collection %s", contentHash, orgCollection)
+	}
+	return document, nil
+}
+
+// GetRecordEvidence returns the evidence documents linked to an emissions record or audit case of the invoking organization
+func (s *SmartContract) GetRecordEvidence(ctx contractapi.TransactionContextInterface, recordID string) ([]*EvidenceDocument, error) {
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(orgCollection, evidenceLinkObjectType, []string{recordID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	documents := []*EvidenceDocument{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		document, err := getEvidence(ctx, orgCollection, string(queryResponse.Value))
+		if err != nil {
+			return nil, err
+		}
+		if document != nil {
+			documents = append(documents, document)
+		}
+	}
+	return documents, nil
+}
+
+// VerifyEvidence takes the hash of a document and reports which emissions records and audit cases of the invoking organization it supports
+func (s *SmartContract) VerifyEvidence(ctx contractapi.TransactionContextInterface, contentHash string) (*EvidenceVerification, error) {
+	contentHash = strings.ToLower(contentHash)
+	if !contentHashPattern.MatchString(contentHash) {
+		return nil, fmt.Errorf("content hash must be a hex encoded SHA-256 hash, got %s", contentHash)
+	}
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	document, err := getEvidence(ctx, orgCollection, contentHash)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := EvidenceVerification{
+		ContentHash: contentHash,
+		RecordIDs:   []string{},
+	}
+	if document != nil {
+		verification.Anchored = true
+		verification.Document = document
+		verification.RecordIDs = document.RecordIDs
+	}
+	return &verification, nil
+}
+
+// VerifyEvidenceLink returns true if a document is linked to an emissions record or audit case in the private data collection of another organization
+// It only compares the hash of the private data, so auditors can check evidence without access to the collection
+func (s *SmartContract) VerifyEvidenceLink(ctx contractapi.TransactionContextInterface, mspID string, recordID string, contentHash string) (bool, error) {
+	contentHash = strings.ToLower(contentHash)
+	if !contentHashPattern.MatchString(contentHash) {
+		return false, fmt.Errorf("content hash must be a hex encoded SHA-256 hash, got %s", contentHash)
+	}
+	linkKey, err := ctx.GetStub().CreateCompositeKey(evidenceLinkObjectType, []string{recordID, contentHash})
+	if err != nil {
+		return false, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	linkHash, err := ctx.GetStub().GetPrivateDataHash(mspID+"PrivateCollection", linkKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read private data hash: %v", err)
+	}
+	return linkHash != nil, nil
+}
+
+// HELPER FUNCTION validateEvidence checks the metadata of an evidence document and brings the media type into its canonical form
+func validateEvidence(document *EvidenceDocument) error {
+	if !contentHashPattern.MatchString(document.ContentHash) {
+		return fmt.Errorf("content hash must be a hex encoded SHA-256 hash, got %s", document.ContentHash)
+	}
+	if !validEvidenceTypes[document.DocumentType] {
+		return fmt.Errorf("unknown document type %s", document.DocumentType)
+	}
+	mediaType, params, err := mime.ParseMediaType(document.MediaType)
+	if err != nil {
+		return fmt.Errorf("invalid media type %s: %v", document.MediaType, err)
+	}
+	document.MediaType = mime.FormatMediaType(mediaType, params)
+	if document.Size <= 0 {
+		return fmt.Errorf("size must be positive, got %d", document.Size)
+	}
+	uri, err := url.Parse(document.URI)
+	if err != nil {
+		return fmt.Errorf("invalid URI %s: %v", document.URI, err)
+	}
+	if len(uri.Scheme) == 0 {
+		return fmt.Errorf("URI %s must be absolute", document.URI)
+	}
+	return nil
+}
+
+// HELPER FUNCTION verifyEvidenceSubject checks that evidence is anchored to a record or an audit case of the invoking owner
+// Records resolve to the owner of their original record, audit cases keep the owner until the record is created
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) verifyEvidenceSubject(ctx contractapi.TransactionContextInterface, recordID string) error {
+	ownerID, err := getOwnerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	exists, err := s.EmissionsRecordExists(ctx, recordID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		record, err := s.GetEmissionsRecordRevision(ctx, recordID)
+		if err != nil {
+			return err
+		}
+		rootID := record.ID
+		if record.Amendment != nil {
+			rootID = record.Amendment.RootID
+		}
+		details, err := s.GetEmissionsRecordPrivateDetails(ctx, rootID)
+		if err != nil {
+			return err
+		}
+		if details == nil || details.Owner != ownerID {
+			return fmt.Errorf("the emissions record with ID %s is not owned by the invoking owner", recordID)
+		}
+		return nil
+	}
+
+	exists, err = s.AuditCaseExists(ctx, recordID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("neither an emissions record nor an audit case with ID %s exists", recordID)
+	}
+	caseDetails, err := getAuditCaseDetails(ctx, recordID)
+	if err != nil {
+		return err
+	}
+	if caseDetails.OwnerID != ownerID {
+		return fmt.Errorf("the audit case %s was not submitted by the invoking owner", recordID)
+	}
+	return nil
+}
+
+// HELPER FUNCTION getEvidence reads an evidence document from a private data collection, it returns nil if the document is not anchored
+func getEvidence(ctx contractapi.TransactionContextInterface, collection string, contentHash string) (*EvidenceDocument, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(evidenceObjectType, []string{contentHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	documentJSON, err := ctx.GetStub().GetPrivateData(collection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence document: %v", err)
+	}
+	if documentJSON == nil {
+		return nil, nil
+	}
+
+	var document EvidenceDocument
+	err = json.Unmarshal(documentJSON, &document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return &document, nil
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const facilityObjectType = "facility"
+
+// globalRegion is the region of emission factors that apply everywhere
+const globalRegion = "GLOBAL"
+
+// Kinds of facilities emissions can be attributed to
+const (
+	FacilityMine      = "MINE"
+	FacilitySmelter   = "SMELTER"
+	FacilityFactory   = "FACTORY"
+	FacilityWarehouse = "WAREHOUSE"
+	FacilityOther     = "OTHER"
+)
+
+// validFacilityKinds lists all kinds a facility can be registered with
+var validFacilityKinds = map[string]bool{
+	FacilityMine:      true,
+	FacilitySmelter:   true,
+	FacilityFactory:   true,
+	FacilityWarehouse: true,
+	FacilityOther:     true,
+}
+
+// Status of a facility
+const (
+	FacilityActive         = "ACTIVE"         // Emissions can be attributed to the facility
+	FacilityDecommissioned = "DECOMMISSIONED" // The facility is closed, no new emissions can be attributed to it
+)
+
+// countryCodePattern matches ISO 3166-1 alpha-2 country codes
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Facility describes a site of an organization that causes emissions, e.g. a mine, smelter, factory or warehouse
+// Alphabetic order to achieve determinism accross languages
+type Facility struct {
+	CommissionedOn     string `json:"CommissionedOn"`                                  // First day of operation (YYYY-MM-DD)
+	Country            string `json:"Country"`                                         // ISO 3166-1 alpha-2 code of the country the facility is located in
+	DecommissionedOn   string `json:"DecommissionedOn,omitempty" metadata:",optional"` // Last day of operation (YYYY-MM-DD)
+	GridRegion         string `json:"GridRegion,omitempty" metadata:",optional"`       // Electricity grid region the facility draws power from, e.g. an eGRID subregion or bidding zone
+	ID                 string `json:"ID"`
+	Kind               string `json:"Kind"`
+	MSPID              string `json:"MSPID"`
+	Name               string `json:"Name"`
+	OperationalControl bool   `json:"OperationalControl"`                    // Whether the organization has operational control, only then Scope 1 and 2 emissions can be attributed to it
+	Region             string `json:"Region,omitempty" metadata:",optional"` // Subdivision of the country, e.g. an ISO 3166-2 code
+	RegisteredAt       string `json:"RegisteredAt"`
+	RegisteredBy       string `json:"RegisteredBy"`
+	Status             string `json:"Status"`
+}
+
+// FacilityInventory describes the aggregated emissions of a facility, optionally restricted to a reporting period
+// Alphabetic order to achieve determinism accross languages
+type FacilityInventory struct {
+	ByCategory  []*ScopeAggregate  `json:"ByCategory"`
+	ByScope     []*ScopeAggregate  `json:"ByScope"`
+	Facility    *Facility          `json:"Facility"`
+	PeriodID    string             `json:"PeriodID,omitempty" metadata:",optional"` // Not set if the inventory covers all periods
+	RecordCount int                `json:"RecordCount"`
+	Records     []*EmissionsRecord `json:"Records"`   // Latest revisions of the records attributed to the facility
+	TotalCO2e   Quantity           `json:"TotalCO2e"` // Exact sum of the emissions in Kg of CO2 equivalents, in g if it cannot be expressed in Kg without rounding
+	TotalKgCO2  int                `json:"TotalKgCO2"`
+}
+
+// RegisterFacility adds a facility to the registry of the invoking organization
+// Region and grid region are optional, the commissioning date is given as YYYY-MM-DD
+func (s *SmartContract) RegisterFacility(ctx contractapi.TransactionContextInterface, facilityID string, name string, kind string, country string, region string, gridRegion string, operationalControl bool, commissionedOn string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+
+	if len(facilityID) == 0 {
+		return fmt.Errorf("facility ID must be a non-empty string")
+	}
+	if len(name) == 0 {
+		return fmt.Errorf("name must be a non-empty string")
+	}
+	if !validFacilityKinds[kind] {
+		return fmt.Errorf("unknown facility kind %s", kind)
+	}
+	if !countryCodePattern.MatchString(country) {
+		return fmt.Errorf("country must be an ISO 3166-1 alpha-2 code, got %s", country)
+	}
+	_, err = time.Parse(dateLayout, commissionedOn)
+	if err != nil {
+		return fmt.Errorf("failed to parse commissioning date %s, expected YYYY-MM-DD: %v", commissionedOn, err)
+	}
+
+	existing, err := getFacility(ctx, clientMSPID, facilityID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("the facility %s already exists", facilityID)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	clientID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+	facility := Facility{
+		CommissionedOn:     commissionedOn,
+		Country:            country,
+		GridRegion:         gridRegion,
+		ID:                 facilityID,
+		Kind:               kind,
+		MSPID:              clientMSPID,
+		Name:               name,
+		OperationalControl: operationalControl,
+		Region:             region,
+		RegisteredAt:       txTime.Format(time.RFC3339),
+		RegisteredBy:       clientID,
+		Status:             FacilityActive,
+	}
+	return putFacility(ctx, &facility)
+}
+
+// SetFacilityOperationalControl changes whether the invoking organization has operational control over one of its facilities
+// Records attributed to the facility before keep their scope
+func (s *SmartContract) SetFacilityOperationalControl(ctx contractapi.TransactionContextInterface, facilityID string, operationalControl bool) error {
+	facility, err := getOwnFacility(ctx, facilityID)
+	if err != nil {
+		return err
+	}
+	if facility.Status != FacilityActive {
+		return fmt.Errorf("the facility %s is %s", facilityID, facility.Status)
+	}
+	facility.OperationalControl = operationalControl
+	return putFacility(ctx, facility)
+}
+
+// DecommissionFacility marks a facility of the invoking organization as closed, the date is given as YYYY-MM-DD
+// Records attributed to the facility are kept, but no new emissions can be attributed to it
+func (s *SmartContract) DecommissionFacility(ctx contractapi.TransactionContextInterface, facilityID string, decommissionedOn string) error {
+	facility, err := getOwnFacility(ctx, facilityID)
+	if err != nil {
+		return err
+	}
+	if facility.Status != FacilityActive {
+		return fmt.Errorf("the facility %s is already %s", facilityID, facility.Status)
+	}
+	_, err = time.Parse(dateLayout, decommissionedOn)
+	if err != nil {
+		return fmt.Errorf("failed to parse decommissioning date %s, expected YYYY-MM-DD: %v", decommissionedOn, err)
+	}
+	// Dates in the layout YYYY-MM-DD can be compared as strings
+	if decommissionedOn < facility.CommissionedOn {
+		return fmt.Errorf("the facility %s cannot be decommissioned before it was commissioned on %s", facilityID, facility.CommissionedOn)
+	}
+
+	facility.DecommissionedOn = decommissionedOn
+	facility.Status = FacilityDecommissioned
+	return putFacility(ctx, facility)
+}
+
+// GetFacility returns a facility of an organization
+func (s *SmartContract) GetFacility(ctx contractapi.TransactionContextInterface, mspID string, facilityID string) (*Facility, error) {
+	facility, err := getFacility(ctx, mspID, facilityID)
+	if err != nil {
+		return nil, err
+	}
+	if facility == nil {
+		return nil, fmt.Errorf("the facility %s of organization %s does not exist", facilityID, mspID)
+	}
+	return facility, nil
+}
+
+// GetFacilities returns all facilities of an organization ordered by their ID
+func (s *SmartContract) GetFacilities(ctx contractapi.TransactionContextInterface, mspID string) ([]*Facility, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(facilityObjectType, []string{mspID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	facilities := []*Facility{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var facility Facility
+		err = json.Unmarshal(queryResponse.Value, &facility)
+		if err != nil {
+			return nil, err
+		}
+		facilities = append(facilities, &facility)
+	}
+
+	sort.Slice(facilities, func(i, j int) bool {
+		return facilities[i].ID < facilities[j].ID
+	})
+	return facilities, nil
+}
+
+// GetFacilityInventory returns the emissions attributed to a facility of the invoking organization, summed up per scope and Scope 3 category
+// If periodID is not empty, only the records assigned to that reporting period are included
+func (s *SmartContract) GetFacilityInventory(ctx contractapi.TransactionContextInterface, facilityID string, periodID string) (*FacilityInventory, error) {
+	err := verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetFacilityInventory cannot be performed: Error %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	facility, err := s.GetFacility(ctx, clientMSPID, facilityID)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]string{"FacilityID": facilityID}
+	if len(periodID) > 0 {
+		_, err = s.GetReportingPeriod(ctx, clientMSPID, periodID)
+		if err != nil {
+			return nil, err
+		}
+		selector["ReportingPeriod"] = periodID
+	}
+	records, err := s.getOrgRecords(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	byCategory, err := aggregateRecords(records, true)
+	if err != nil {
+		return nil, err
+	}
+	byScope, err := aggregateRecords(records, false)
+	if err != nil {
+		return nil, err
+	}
+	totalCO2e, err := sumRecordsCO2e(records)
+	if err != nil {
+		return nil, err
+	}
+	inventory := FacilityInventory{
+		ByCategory:  byCategory,
+		ByScope:     byScope,
+		Facility:    facility,
+		PeriodID:    periodID,
+		RecordCount: len(records),
+		Records:     records,
+		TotalCO2e:   totalCO2e,
+	}
+	for _, record := range records {
+		inventory.TotalKgCO2 += record.KgCO2
+	}
+	return &inventory, nil
+}
+
+// FindEmissionFactorsForFacility returns the usable emission factors for an activity at a facility of an organization
+// The most specific region with matching factors wins: grid region, then country subdivision, then country and finally GLOBAL
+func (s *SmartContract) FindEmissionFactorsForFacility(ctx contractapi.TransactionContextInterface, mspID string, facilityID string, activityType string) ([]*EmissionFactor, error) {
+	facility, err := s.GetFacility(ctx, mspID, facilityID)
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range facilityRegions(facility) {
+		factors, err := s.FindEmissionFactors(ctx, activityType, region)
+		if err != nil {
+			return nil, err
+		}
+		if len(factors) > 0 {
+			return factors, nil
+		}
+	}
+	return []*EmissionFactor{}, nil
+}
+
+// HELPER FUNCTION assignFacility returns the facility of the organization new emissions are attributed to
+// Emissions without a facility are attributed to the organization as a whole and nil is returned
+// Transient Data: facilityID string (optional)
+func assignFacility(ctx contractapi.TransactionContextInterface, mspID string, record *EmissionsRecord, txTime time.Time) (*Facility, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+	facilityID, ok := transientMap["facilityID"]
+	if !ok || len(facilityID) == 0 {
+		return nil, nil
+	}
+
+	facility, err := getFacility(ctx, mspID, string(facilityID))
+	if err != nil {
+		return nil, err
+	}
+	if facility == nil {
+		return nil, fmt.Errorf("the facility %s of organization %s does not exist", facilityID, mspID)
+	}
+	if facility.Status != FacilityActive {
+		return nil, fmt.Errorf("the facility %s is %s, no new emissions can be attributed to it", facility.ID, facility.Status)
+	}
+	if txTime.Format(dateLayout) < facility.CommissionedOn {
+		return nil, fmt.Errorf("the facility %s is only commissioned on %s", facility.ID, facility.CommissionedOn)
+	}
+	// Under the operational control approach direct and energy indirect emissions are only reported for controlled facilities
+	if !facility.OperationalControl && record.Scope != 3 {
+		return nil, fmt.Errorf("the organization has no operational control over the facility %s, its emissions can only be reported as Scope 3", facility.ID)
+	}
+	return facility, nil
+}
+
+// HELPER FUNCTION verifyFactorRegion checks that the emission factor of a calculated record applies to the region of its facility
+func (s *SmartContract) verifyFactorRegion(ctx contractapi.TransactionContextInterface, record *EmissionsRecord, facility *Facility) error {
+	if record.Calculation == nil || facility == nil {
+		return nil
+	}
+	factor, err := s.GetEmissionFactor(ctx, record.Calculation.FactorID, record.Calculation.FactorVersion)
+	if err != nil {
+		return err
+	}
+	for _, region := range facilityRegions(facility) {
+		if factor.Region == region {
+			return nil
+		}
+	}
+	return fmt.Errorf("the emission factor %s is valid for region %s, which does not cover the facility %s in %v", factor.ID, factor.Region, facility.ID, facilityRegions(facility))
+}
+
+// HELPER FUNCTION facilityRegions lists the regions of a facility from the most to the least specific
+func facilityRegions(facility *Facility) []string {
+	regions := []string{}
+	for _, region := range []string{facility.GridRegion, facility.Region, facility.Country} {
+		if len(region) > 0 {
+			regions = append(regions, region)
+		}
+	}
+	return append(regions, globalRegion)
+}
+
+// HELPER FUNCTION getOwnFacility reads a facility of the invoking organization, the client needs the submitter role
+func getOwnFacility(ctx contractapi.TransactionContextInterface, facilityID string) (*Facility, error) {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return nil, err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	facility, err := getFacility(ctx, clientMSPID, facilityID)
+	if err != nil {
+		return nil, err
+	}
+	if facility == nil {
+		return nil, fmt.Errorf("the facility %s of organization %s does not exist", facilityID, clientMSPID)
+	}
+	return facility, nil
+}
+
+// HELPER FUNCTION getFacility reads a facility of an organization from the ledger, it returns nil if the facility does not exist
+func getFacility(ctx contractapi.TransactionContextInterface, mspID string, facilityID string) (*Facility, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(facilityObjectType, []string{mspID, facilityID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	facilityJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if facilityJSON == nil {
+		return nil, nil
+	}
+
+	var facility Facility
+	err = json.Unmarshal(facilityJSON, &facility)
+	if err != nil {
+		return nil, err
+	}
+	return &facility, nil
+}
+
+// HELPER FUNCTION putFacility writes a facility to the ledger
+func putFacility(ctx contractapi.TransactionContextInterface, facility *Facility) error {
+	key, err := ctx.GetStub().CreateCompositeKey(facilityObjectType, []string{facility.MSPID, facility.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	facilityJSON, err := json.Marshal(facility)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, facilityJSON)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const gwpTableObjectType = "gwpTable"
+
+// GWPTable describes a versioned set of Global Warming Potentials used to convert
+// the emissions of a greenhouse gas into CO2 equivalents
+// Alphabetic order to achieve determinism accross languages
+type GWPTable struct {
+	Assessment  string             `json:"Assessment"`  // IPCC assessment report the values are taken from, e.g. AR5 or AR6
+	Factors     map[string]float64 `json:"Factors"`     // GWP of each gas relative to CO2
+	ID          string             `json:"ID"`          // Version identifier of the table, e.g. AR6-GWP100
+	TimeHorizon int                `json:"TimeHorizon"` // Time horizon of the GWP values in years
+}
+
+// GasEmissions describes the emissions of a single greenhouse gas within an emissions record
+type GasEmissions struct {
+	CO2e   Quantity `json:"CO2e"` // Exact emissions in Kg of CO2 equivalents
+	GWP    float64  `json:"GWP"`
+	Gas    string   `json:"Gas"`
+	Kg     int      `json:"Kg"`     // Emissions in Kg of the gas itself
+	KgCO2e int      `json:"KgCO2e"` // Emissions in Kg of CO2 equivalents
+}
+
+// defaultGWPTables holds the 100-year GWP values of the IPCC Fifth and Sixth Assessment Reports
+// for the gases covered by the GHG Protocol (CO2, CH4, N2O, HFCs, PFCs, SF6 and NF3)
+var defaultGWPTables = []GWPTable{
+	{
+		Assessment: "AR5",
+		Factors: map[string]float64{
+			"CO2":        1,
+			"CH4":        28,
+			"CH4-fossil": 30,
+			"N2O":        265,
+			"HFC-23":     12400,
+			"HFC-32":     677,
+			"HFC-125":    3170,
+			"HFC-134a":   1300,
+			"HFC-143a":   4800,
+			"HFC-152a":   138,
+			"HFC-227ea":  3350,
+			"PFC-14":     6630,
+			"PFC-116":    11100,
+			"PFC-218":    8900,
+			"SF6":        23500,
+			"NF3":        16100,
+		},
+		ID:          "AR5-GWP100",
+		TimeHorizon: 100,
+	},
+	{
+		Assessment: "AR6",
+		Factors: map[string]float64{
+			"CO2":        1,
+			"CH4":        27.9,
+			"CH4-fossil": 29.8,
+			"N2O":        273,
+			"HFC-23":     14600,
+			"HFC-32":     771,
+			"HFC-125":    3740,
+			"HFC-134a":   1530,
+			"HFC-143a":   5810,
+			"HFC-152a":   164,
+			"HFC-227ea":  3600,
+			"PFC-14":     7380,
+			"PFC-116":    12400,
+			"PFC-218":    9290,
+			"SF6":        24300,
+			"NF3":        17400,
+		},
+		ID:          "AR6-GWP100",
+		TimeHorizon: 100,
+	},
+}
+
+// InitGWPTables writes the default AR5 and AR6 100-year GWP tables to the ledger
+// Tables which already exist are left untouched, so this function can be invoked repeatedly
+func (s *SmartContract) InitGWPTables(ctx contractapi.TransactionContextInterface) error {
+	err := verifyClientIsAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range defaultGWPTables {
+		exists, err := s.GWPTableExists(ctx, table.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		err = putGWPTable(ctx, &table)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateGWPTable adds a new GWP table to the ledger
+// GWP tables are immutable, a revised set of values has to be published under a new ID
+func (s *SmartContract) CreateGWPTable(ctx contractapi.TransactionContextInterface, id string, assessment string, timeHorizon int, factors map[string]float64) error {
+	err := verifyClientIsAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(id) == 0 {
+		return fmt.Errorf("GWP table ID must be a non-empty string")
+	}
+	if len(assessment) == 0 {
+		return fmt.Errorf("assessment must be a non-empty string")
+	}
+	if timeHorizon <= 0 {
+		return fmt.Errorf("time horizon must be a positive number of years")
+	}
+	if gwp, ok := factors["CO2"]; !ok || gwp != 1 {
+		return fmt.Errorf("GWP table must define CO2 with a GWP of 1")
+	}
+	for gas, gwp := range factors {
+		if gwp <= 0 {
+			return fmt.Errorf("GWP of %s must be positive", gas)
+		}
+	}
+
+	exists, err := s.GWPTableExists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the GWP table with ID %s already exists", id)
+	}
+
+	table := GWPTable{
+		Assessment:  assessment,
+		Factors:     factors,
+		ID:          id,
+		TimeHorizon: timeHorizon,
+	}
+	return putGWPTable(ctx, &table)
+}
+
+// GetGWPTable returns the GWP table stored in the ledger with the given id
+func (s *SmartContract) GetGWPTable(ctx contractapi.TransactionContextInterface, id string) (*GWPTable, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(gwpTableObjectType, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	tableJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if tableJSON == nil {
+		return nil, fmt.Errorf("the GWP table with ID %s does not exist", id)
+	}
+
+	var table GWPTable
+	err = json.Unmarshal(tableJSON, &table)
+	if err != nil {
+		return nil, err
+	}
+
+	return &table, nil
+}
+
+// GetAllGWPTables returns all GWP tables stored in the ledger
+func (s *SmartContract) GetAllGWPTables(ctx contractapi.TransactionContextInterface) ([]*GWPTable, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(gwpTableObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var tables []*GWPTable
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var table GWPTable
+		err = json.Unmarshal(queryResponse.Value, &table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, &table)
+	}
+
+	return tables, nil
+}
+
+// GWPTableExists returns true when a GWP table with the given ID exists in the ledger
+func (s *SmartContract) GWPTableExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(gwpTableObjectType, []string{id})
+	if err != nil {
+		return false, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	tableJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+
+	return tableJSON != nil, nil
+}
+
+// GetEmissionsRecordGasBreakdown returns the per-gas emissions of the record with the given id
+// together with the GWP that was applied to each gas
+func (s *SmartContract) GetEmissionsRecordGasBreakdown(ctx contractapi.TransactionContextInterface, id string) ([]*GasEmissions, error) {
+	record, err := s.GetEmissionsRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records without a GWP table only contain CO2
+	factors := map[string]float64{"CO2": 1}
+	if len(record.GWPTableID) > 0 {
+		table, err := s.GetGWPTable(ctx, record.GWPTableID)
+		if err != nil {
+			return nil, err
+		}
+		factors = table.Factors
+	}
+
+	gases := record.Gases
+	if len(gases) == 0 {
+		if record.Calculation != nil {
+			return nil, fmt.Errorf("the emissions record with ID %s was calculated with a CO2e emission factor and has no per-gas breakdown", id)
+		}
+		gases = map[string]int{"CO2": record.KgCO2}
+	}
+
+	var breakdown []*GasEmissions
+	for _, gas := range sortedGases(gases) {
+		gwp, ok := factors[gas]
+		if !ok {
+			return nil, fmt.Errorf("gas %s is not defined in GWP table %s", gas, record.GWPTableID)
+		}
+		gwpRat, err := ratFromFloat(gwp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GWP of %s: %v", gas, err)
+		}
+		co2e, err := quantityFromRat(new(big.Rat).Mul(big.NewRat(int64(gases[gas]), 1), gwpRat), UnitKgCO2e)
+		if err != nil {
+			return nil, err
+		}
+		kgCO2e, err := wholeKgCO2e(co2e)
+		if err != nil {
+			return nil, err
+		}
+		breakdown = append(breakdown, &GasEmissions{
+			CO2e:   co2e,
+			GWP:    gwp,
+			Gas:    gas,
+			Kg:     gases[gas],
+			KgCO2e: kgCO2e,
+		})
+	}
+	return breakdown, nil
+}
+
+// HELPER FUNCTION calculateCO2e converts per-gas emissions into Kg of CO2 equivalents using the given GWP table
+func calculateCO2e(gases map[string]int, table *GWPTable) (Quantity, error) {
+	if len(gases) == 0 {
+		return Quantity{}, fmt.Errorf("emissions of at least one gas must be provided")
+	}
+
+	// The GWP values are multiplied as exact decimals, so every peer obtains the same result without floating-point arithmetic
+	total := new(big.Rat)
+	for _, gas := range sortedGases(gases) {
+		kg := gases[gas]
+		if kg < 0 {
+			return Quantity{}, fmt.Errorf("emissions of %s must not be negative", gas)
+		}
+		gwp, ok := table.Factors[gas]
+		if !ok {
+			return Quantity{}, fmt.Errorf("gas %s is not defined in GWP table %s", gas, table.ID)
+		}
+		gwpRat, err := ratFromFloat(gwp)
+		if err != nil {
+			return Quantity{}, fmt.Errorf("invalid GWP of %s: %v", gas, err)
+		}
+		total.Add(total, new(big.Rat).Mul(big.NewRat(int64(kg), 1), gwpRat))
+	}
+	co2e, err := quantityFromRat(total, UnitKgCO2e)
+	if err != nil {
+		return Quantity{}, err
+	}
+	_, err = wholeKgCO2e(co2e)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return co2e, nil
+}
+
+// HELPER FUNCTION sortedGases returns the gases of a per-gas emissions map in alphabetical order
+func sortedGases(gases map[string]int) []string {
+	names := make([]string, 0, len(gases))
+	for gas := range gases {
+		names = append(names, gas)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HELPER FUNCTION putGWPTable writes a GWP table to the ledger
+func putGWPTable(ctx contractapi.TransactionContextInterface, table *GWPTable) error {
+	key, err := ctx.GetStub().CreateCompositeKey(gwpTableObjectType, []string{table.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	tableJSON, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, tableJSON)
+}
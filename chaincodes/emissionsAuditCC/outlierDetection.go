@@ -0,0 +1,519 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const outlierPolicyObjectType = "outlierPolicy"
+
+// Outlier detection methods
+const (
+	MethodIQR      = "IQR"      // Tukey fences: outside [Q1 - k*IQR, Q3 + k*IQR]
+	MethodMAD      = "MAD"      // Modified z-score based on the median absolute deviation
+	MethodZScore   = "ZSCORE"   // Standard score based on mean and sample standard deviation
+	MethodSeasonal = "SEASONAL" // Relative deviation from the median of the same period last year
+)
+
+// Rules which can be applied instead of the configured method
+const (
+	RuleMedianTolerance  = "MEDIAN_TOLERANCE"  // Too few values for the configured method, relative deviation from the median is checked
+	RuleInsufficientData = "INSUFFICIENT_DATA" // No previous values, no outlier detection possible
+)
+
+// madScale converts the median absolute deviation into an estimate of the standard deviation of normally distributed data
+var madScale = big.NewRat(6745, 10000)
+
+// sqrtPrecision is the number of bits the standard deviation is calculated with, far more than the decimal places of the fences
+const sqrtPrecision = 128
+
+// defaultOutlierPolicy is applied when no policy is configured for the organization and product category.
+// It applies Tukey fences for 5 or more values, otherwise median +-50%.
+// The first record of an owner and product category has no history and is audited manually, so every owner and category
+// needs one record approved by an auditor before emissions are approved automatically. Policies with MinHistory 0 skip this
+var defaultOutlierPolicy = OutlierPolicy{
+	Method:     MethodIQR,
+	MinHistory: 1,
+	MinValues:  5,
+	Threshold:  "1.5",
+	Tolerance:  "0.5",
+}
+
+// OutlierPolicy configures the automated outlier detection of an organization and/or product category
+// An empty MSPID or ProductCategory makes the policy apply to all organizations or product categories
+// Threshold and Tolerance are decimals with up to 6 decimal places, so the policy is identical on every peer
+// Alphabetic order to achieve determinism accross languages
+type OutlierPolicy struct {
+	MSPID           string `json:"MSPID"`
+	Method          string `json:"Method"`
+	MinHistory      int    `json:"MinHistory"` // Minimum number of previous values for an automated approval, below an audit case is opened
+	MinValues       int    `json:"MinValues"`  // Minimum number of previous values for the method, below the median tolerance rule is applied
+	ProductCategory string `json:"ProductCategory"`
+	Threshold       string `json:"Threshold"`  // k for IQR, maximum modified z-score for MAD, maximum z-score for ZSCORE, maximum relative deviation for SEASONAL
+	Tolerance       string `json:"Tolerance"`  // Maximum relative deviation from the median if fewer than MinValues values are available
+	UpdatedAt       string `json:"UpdatedAt"`  // Time of the last change, empty for the built-in default
+	UpdatedBy       string `json:"UpdatedBy"`  // Identifier of the client who changed the policy, empty for the built-in default
+	WindowDays      int    `json:"WindowDays"` // SEASONAL only: days around the same date last year that form the comparison period
+}
+
+// OutlierDecision records how the automated audit judged the emissions of a record
+// The emissions are an outlier if Value is below LowerFence or above UpperFence, they are compared exactly as they are stored
+// Alphabetic order to achieve determinism accross languages
+type OutlierDecision struct {
+	AppliedRule           string    `json:"AppliedRule"`                               // Method or fallback rule that was actually applied
+	BaselineSize          int       `json:"BaselineSize"`                              // Number of previous values the decision is based on
+	LowerFence            *Quantity `json:"LowerFence,omitempty" metadata:",optional"` // Lowest accepted emissions in KgCO2e, not set if there are no previous values
+	Median                *Quantity `json:"Median,omitempty" metadata:",optional"`     // Median of the previous values in KgCO2e, not set if there are none
+	Method                string    `json:"Method"`                                    // Method configured in the policy
+	MinHistory            int       `json:"MinHistory"`
+	MinValues             int       `json:"MinValues"`
+	Outlier               bool      `json:"Outlier"`
+	PolicyMSPID           string    `json:"PolicyMSPID"`           // Organization of the applied policy, empty if it applies to all organizations
+	PolicyProductCategory string    `json:"PolicyProductCategory"` // Product category of the applied policy, empty if it applies to all categories
+	Threshold             string    `json:"Threshold"`
+	Tolerance             string    `json:"Tolerance"`
+	UpperFence            *Quantity `json:"UpperFence,omitempty" metadata:",optional"` // Highest accepted emissions in KgCO2e, not set if there are no previous values
+	Value                 Quantity  `json:"Value"`                                     // Audited emissions exactly as they were compared against the fences
+	WindowDays            int       `json:"WindowDays"`
+}
+
+// SetOutlierPolicy creates or replaces the outlier detection policy for an organization and product category
+// Leave mspID or productCategory empty to configure the default for all organizations or product categories
+// threshold and tolerance are decimals with up to 6 decimal places, e.g. 1.5
+func (s *SmartContract) SetOutlierPolicy(ctx contractapi.TransactionContextInterface, mspID string, productCategory string, method string, threshold string, minHistory int, minValues int, tolerance string, windowDays int) error {
+	err := verifyClientIsAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	policy := OutlierPolicy{
+		MSPID:           mspID,
+		Method:          method,
+		MinHistory:      minHistory,
+		MinValues:       minValues,
+		ProductCategory: productCategory,
+		Threshold:       threshold,
+		Tolerance:       tolerance,
+		WindowDays:      windowDays,
+	}
+	err = validateOutlierPolicy(&policy)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	clientID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+	policy.UpdatedAt = txTime.Format(time.RFC3339)
+	policy.UpdatedBy = clientID
+
+	key, err := outlierPolicyKey(ctx, mspID, productCategory)
+	if err != nil {
+		return err
+	}
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, policyJSON)
+}
+
+// DeleteOutlierPolicy removes the outlier detection policy of an organization and product category
+// Afterwards the next more general policy applies
+func (s *SmartContract) DeleteOutlierPolicy(ctx contractapi.TransactionContextInterface, mspID string, productCategory string) error {
+	err := verifyClientIsAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	policy, err := getOutlierPolicy(ctx, mspID, productCategory)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return fmt.Errorf("no outlier policy exists for organization \"%s\" and product category \"%s\"", mspID, productCategory)
+	}
+
+	key, err := outlierPolicyKey(ctx, mspID, productCategory)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// GetOutlierPolicy returns the outlier detection policy configured for exactly the given organization and product category
+func (s *SmartContract) GetOutlierPolicy(ctx contractapi.TransactionContextInterface, mspID string, productCategory string) (*OutlierPolicy, error) {
+	policy, err := getOutlierPolicy(ctx, mspID, productCategory)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("no outlier policy exists for organization \"%s\" and product category \"%s\"", mspID, productCategory)
+	}
+	return policy, nil
+}
+
+// GetEffectiveOutlierPolicy returns the outlier detection policy that applies to emissions of the given organization and product category
+// Policies are looked up from the most to the least specific, falling back to the built-in default
+func (s *SmartContract) GetEffectiveOutlierPolicy(ctx contractapi.TransactionContextInterface, mspID string, productCategory string) (*OutlierPolicy, error) {
+	return resolveOutlierPolicy(ctx, mspID, productCategory)
+}
+
+// GetAllOutlierPolicies returns all outlier detection policies stored in the ledger
+func (s *SmartContract) GetAllOutlierPolicies(ctx contractapi.TransactionContextInterface) ([]*OutlierPolicy, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(outlierPolicyObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var policies []*OutlierPolicy
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var policy OutlierPolicy
+		err = json.Unmarshal(queryResponse.Value, &policy)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, &policy)
+	}
+
+	return policies, nil
+}
+
+// HELPER FUNCTION resolveOutlierPolicy returns the most specific policy for the organization and product category:
+// organization and category, organization, category, channel-wide and finally the built-in default
+func resolveOutlierPolicy(ctx contractapi.TransactionContextInterface, mspID string, productCategory string) (*OutlierPolicy, error) {
+	candidates := [][2]string{
+		{mspID, productCategory},
+		{mspID, ""},
+		{"", productCategory},
+		{"", ""},
+	}
+	for _, candidate := range candidates {
+		policy, err := getOutlierPolicy(ctx, candidate[0], candidate[1])
+		if err != nil {
+			return nil, err
+		}
+		if policy != nil {
+			return policy, nil
+		}
+	}
+	policy := defaultOutlierPolicy
+	return &policy, nil
+}
+
+// HELPER FUNCTION getOutlierPolicy reads a policy from the ledger, it returns nil if the policy does not exist
+func getOutlierPolicy(ctx contractapi.TransactionContextInterface, mspID string, productCategory string) (*OutlierPolicy, error) {
+	key, err := outlierPolicyKey(ctx, mspID, productCategory)
+	if err != nil {
+		return nil, err
+	}
+	policyJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if policyJSON == nil {
+		return nil, nil
+	}
+
+	var policy OutlierPolicy
+	err = json.Unmarshal(policyJSON, &policy)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// HELPER FUNCTION outlierPolicyKey returns the composite key of the policy of an organization and product category
+func outlierPolicyKey(ctx contractapi.TransactionContextInterface, mspID string, productCategory string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(outlierPolicyObjectType, []string{mspID, productCategory})
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return key, nil
+}
+
+// HELPER FUNCTION validateOutlierPolicy checks that the method is known and its parameters are usable
+// Threshold and tolerance are brought into their canonical form
+func validateOutlierPolicy(policy *OutlierPolicy) error {
+	switch policy.Method {
+	case MethodIQR, MethodMAD, MethodZScore:
+		if policy.WindowDays != 0 {
+			return fmt.Errorf("window days can only be set for the %s method", MethodSeasonal)
+		}
+	case MethodSeasonal:
+		if policy.WindowDays <= 0 || policy.WindowDays > 182 {
+			return fmt.Errorf("window days must be between 1 and 182, got %d", policy.WindowDays)
+		}
+	default:
+		return fmt.Errorf("unknown outlier detection method %s, expected one of %s, %s, %s or %s", policy.Method, MethodIQR, MethodMAD, MethodZScore, MethodSeasonal)
+	}
+	threshold, err := parseDecimal(policy.Threshold)
+	if err != nil {
+		return fmt.Errorf("invalid threshold: %v", err)
+	}
+	if threshold.Sign() <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	tolerance, err := parseDecimal(policy.Tolerance)
+	if err != nil {
+		return fmt.Errorf("invalid tolerance: %v", err)
+	}
+	if tolerance.Sign() <= 0 {
+		return fmt.Errorf("tolerance must be positive")
+	}
+	policy.Threshold = formatDecimal(threshold)
+	policy.Tolerance = formatDecimal(tolerance)
+	if policy.MinHistory < 0 {
+		return fmt.Errorf("minimum history must not be negative")
+	}
+	if policy.MinValues < 1 {
+		return fmt.Errorf("minimum number of values must be at least 1")
+	}
+	// The standard deviation is undefined for a single value
+	if policy.Method == MethodZScore && policy.MinValues < 2 {
+		return fmt.Errorf("the %s method requires a minimum of at least 2 values", MethodZScore)
+	}
+	return nil
+}
+
+// HELPER FUNCTION evaluateOutlier judges the emissions of a record against the previous records of the owner with the given policy
+// The seasonal method only considers previous records audited within WindowDays around the same date one year before txTime
+// The statistics are calculated with the exact emissions in Kg of CO2 equivalents, so the emissions of small parts are not rounded away
+func evaluateOutlier(record *EmissionsRecord, previous []*EmissionsRecord, policy *OutlierPolicy, txTime time.Time) (*OutlierDecision, error) {
+	co2e, err := recordCO2e(record)
+	if err != nil {
+		return nil, err
+	}
+	decision := OutlierDecision{
+		Method:                policy.Method,
+		MinHistory:            policy.MinHistory,
+		MinValues:             policy.MinValues,
+		PolicyMSPID:           policy.MSPID,
+		PolicyProductCategory: policy.ProductCategory,
+		Threshold:             policy.Threshold,
+		Tolerance:             policy.Tolerance,
+		Value:                 co2e,
+		WindowDays:            policy.WindowDays,
+	}
+
+	var values []*big.Rat
+	for _, previousRecord := range previous {
+		if policy.Method == MethodSeasonal && !inSeasonalWindow(previousRecord, txTime, policy.WindowDays) {
+			continue
+		}
+		previousCO2e, err := recordCO2e(previousRecord)
+		if err != nil {
+			return nil, err
+		}
+		kgCO2e, err := previousCO2e.ratIn(UnitKgCO2e)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, kgCO2e)
+	}
+	decision.BaselineSize = len(values)
+
+	// No outlier detection is possible if there are no values
+	if len(values) == 0 {
+		decision.AppliedRule = RuleInsufficientData
+		return &decision, nil
+	}
+
+	median := calculateMedian(values)
+	var lowerFence, upperFence *big.Rat
+	if len(values) < policy.MinValues {
+		decision.AppliedRule = RuleMedianTolerance
+		tolerance, err := parseDecimal(policy.Tolerance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tolerance of the outlier policy: %v", err)
+		}
+		lowerFence = new(big.Rat).Mul(median, new(big.Rat).Sub(big.NewRat(1, 1), tolerance))
+		upperFence = new(big.Rat).Mul(median, new(big.Rat).Add(big.NewRat(1, 1), tolerance))
+	} else {
+		decision.AppliedRule = policy.Method
+		lowerFence, upperFence, err = calculateFences(values, policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The median and fences are stored in KgCO2e with 6 decimal places, the emissions are compared against the stored fences
+	decision.Median, err = fenceQuantity(median)
+	if err != nil {
+		return nil, err
+	}
+	decision.LowerFence, err = fenceQuantity(lowerFence)
+	if err != nil {
+		return nil, err
+	}
+	decision.UpperFence, err = fenceQuantity(upperFence)
+	if err != nil {
+		return nil, err
+	}
+	value, err := co2e.ratIn(UnitKgCO2e)
+	if err != nil {
+		return nil, err
+	}
+	lower, err := decision.LowerFence.rat()
+	if err != nil {
+		return nil, err
+	}
+	upper, err := decision.UpperFence.rat()
+	if err != nil {
+		return nil, err
+	}
+	decision.Outlier = value.Cmp(lower) < 0 || value.Cmp(upper) > 0
+	return &decision, nil
+}
+
+// HELPER FUNCTION fenceQuantity rounds a median or fence in Kg of CO2 equivalents to a quantity
+// Emissions are never negative, so a negative fence is stored as 0
+func fenceQuantity(value *big.Rat) (*Quantity, error) {
+	if value.Sign() < 0 {
+		value = new(big.Rat)
+	}
+	q, err := quantityFromRat(value, UnitKgCO2e)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// HELPER FUNCTION calculateFences returns the range of values the configured method accepts
+func calculateFences(values []*big.Rat, policy *OutlierPolicy) (*big.Rat, *big.Rat, error) {
+	threshold, err := parseDecimal(policy.Threshold)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid threshold of the outlier policy: %v", err)
+	}
+	switch policy.Method {
+	case MethodMAD:
+		// A value is an outlier if its modified z-score 0.6745 * (x - median) / MAD exceeds the threshold
+		median := calculateMedian(values)
+		mad := calculateMedianAbsoluteDeviation(values, median)
+		width := new(big.Rat).Quo(new(big.Rat).Mul(threshold, mad), madScale)
+		return new(big.Rat).Sub(median, width), new(big.Rat).Add(median, width), nil
+	case MethodZScore:
+		mean, stdDev := calculateMeanAndStdDev(values)
+		width := new(big.Rat).Mul(threshold, stdDev)
+		return new(big.Rat).Sub(mean, width), new(big.Rat).Add(mean, width), nil
+	case MethodSeasonal:
+		median := calculateMedian(values)
+		return new(big.Rat).Mul(median, new(big.Rat).Sub(big.NewRat(1, 1), threshold)),
+			new(big.Rat).Mul(median, new(big.Rat).Add(big.NewRat(1, 1), threshold)), nil
+	default:
+		// Tukey fences based on the first quartile (25th percentile) and the third quartile (75th percentile)
+		sortedValues := sortRats(values)
+		q1 := calculatePercentile(sortedValues, 25)
+		q3 := calculatePercentile(sortedValues, 75)
+		width := new(big.Rat).Mul(threshold, new(big.Rat).Sub(q3, q1))
+		return new(big.Rat).Sub(q1, width), new(big.Rat).Add(q3, width), nil
+	}
+}
+
+// HELPER FUNCTION inSeasonalWindow checks if a record was audited within windowDays around the same date one year before txTime
+// Records audited before timestamps were stored cannot be placed in a season and are ignored
+func inSeasonalWindow(record *EmissionsRecord, txTime time.Time, windowDays int) bool {
+	if len(record.Timestamp) == 0 {
+		return false
+	}
+	recordTime, err := time.Parse(time.RFC3339, record.Timestamp)
+	if err != nil {
+		return false
+	}
+	lastYear := txTime.AddDate(-1, 0, 0)
+	window := time.Duration(windowDays) * 24 * time.Hour
+	return !recordTime.Before(lastYear.Add(-window)) && !recordTime.After(lastYear.Add(window))
+}
+
+// HELPER FUNCTION calculatePercentile calculates the percentile of a sorted set of values
+// by linear interpolation between the closest ranks
+func calculatePercentile(sortedValues []*big.Rat, percentile int) *big.Rat {
+	length := len(sortedValues)
+	if length == 0 {
+		return new(big.Rat)
+	}
+	rank := big.NewRat(int64(percentile*(length-1)), 100)
+	lower := int(new(big.Int).Quo(rank.Num(), rank.Denom()).Int64())
+	if lower >= length-1 {
+		return new(big.Rat).Set(sortedValues[length-1])
+	}
+
+	lowerValue := sortedValues[lower]
+	upperValue := sortedValues[lower+1]
+	fraction := new(big.Rat).Sub(rank, big.NewRat(int64(lower), 1))
+
+	return new(big.Rat).Add(lowerValue, new(big.Rat).Mul(new(big.Rat).Sub(upperValue, lowerValue), fraction))
+}
+
+// HELPER FUNCTION calculateMedian calculates the median of a given set of values
+func calculateMedian(data []*big.Rat) *big.Rat {
+	sortedData := sortRats(data)
+
+	l := len(sortedData)
+	if l == 0 {
+		return new(big.Rat)
+	} else if l%2 == 0 {
+		median := new(big.Rat).Add(sortedData[l/2-1], sortedData[l/2])
+		return median.Quo(median, big.NewRat(2, 1))
+	}
+	return new(big.Rat).Set(sortedData[l/2])
+}
+
+// HELPER FUNCTION calculateMedianAbsoluteDeviation calculates the median of the absolute deviations from the median
+func calculateMedianAbsoluteDeviation(values []*big.Rat, median *big.Rat) *big.Rat {
+	deviations := make([]*big.Rat, len(values))
+	for i, value := range values {
+		deviations[i] = new(big.Rat).Abs(new(big.Rat).Sub(value, median))
+	}
+	return calculateMedian(deviations)
+}
+
+// HELPER FUNCTION calculateMeanAndStdDev calculates the mean and the sample standard deviation of a given set of values
+// The mean is exact, the standard deviation is the square root of the exact variance calculated with sqrtPrecision bits
+func calculateMeanAndStdDev(values []*big.Rat) (*big.Rat, *big.Rat) {
+	sum := new(big.Rat)
+	for _, value := range values {
+		sum.Add(sum, value)
+	}
+	mean := sum.Quo(sum, big.NewRat(int64(len(values)), 1))
+	if len(values) < 2 {
+		return mean, new(big.Rat)
+	}
+
+	squares := new(big.Rat)
+	for _, value := range values {
+		deviation := new(big.Rat).Sub(value, mean)
+		squares.Add(squares, deviation.Mul(deviation, deviation))
+	}
+	variance := squares.Quo(squares, big.NewRat(int64(len(values)-1), 1))
+	stdDev := new(big.Float).SetPrec(sqrtPrecision).SetRat(variance)
+	stdDev.Sqrt(stdDev)
+	result, _ := stdDev.Rat(nil)
+	return mean, result
+}
+
+// HELPER FUNCTION sortRats returns a sorted copy of a set of rational numbers
+func sortRats(values []*big.Rat) []*big.Rat {
+	sorted := make([]*big.Rat, len(values))
+	copy(sorted, values)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Cmp(sorted[b]) < 0
+	})
+	return sorted
+}
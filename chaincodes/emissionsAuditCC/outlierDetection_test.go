@@ -0,0 +1,236 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// ratTolerance is the maximum difference between calculated and expected results that are not exact
+var ratTolerance = big.NewRat(1, 1000000000)
+
+// rats parses decimals and fractions into rational numbers
+func rats(t *testing.T, values ...string) []*big.Rat {
+	result := make([]*big.Rat, len(values))
+	for i, value := range values {
+		rat, ok := new(big.Rat).SetString(value)
+		if !ok {
+			t.Fatalf("%s is no rational number", value)
+		}
+		result[i] = rat
+	}
+	return result
+}
+
+// closeTo checks that two rational numbers differ by at most ratTolerance
+func closeTo(a *big.Rat, b *big.Rat) bool {
+	difference := new(big.Rat).Sub(a, b)
+	return difference.Abs(difference).Cmp(ratTolerance) <= 0
+}
+
+func TestCalculatePercentile(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     []string
+		percentile int
+		want       string
+	}{
+		{name: "no values", values: []string{}, percentile: 25, want: "0"},
+		{name: "single value", values: []string{"7"}, percentile: 75, want: "7"},
+		{name: "exact rank", values: []string{"1", "2", "3", "4", "5"}, percentile: 25, want: "2"},
+		{name: "interpolated rank", values: []string{"1", "2", "3", "4"}, percentile: 25, want: "1.75"},
+		{name: "interpolated third quartile", values: []string{"10", "20", "30", "40"}, percentile: 75, want: "32.5"},
+		{name: "fractions of a Kg", values: []string{"0.4", "0.4", "0.5", "1.2"}, percentile: 75, want: "0.675"},
+		{name: "minimum", values: []string{"3", "6", "9"}, percentile: 0, want: "3"},
+		{name: "maximum", values: []string{"3", "6", "9"}, percentile: 100, want: "9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculatePercentile(rats(t, tt.values...), tt.percentile)
+			if got.Cmp(rats(t, tt.want)[0]) != 0 {
+				t.Errorf("calculatePercentile(%v, %d) = %v, want %v", tt.values, tt.percentile, got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateMedianAbsoluteDeviation(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{name: "odd number of values", values: []string{"1", "2", "3", "4", "100"}, want: "1"},
+		{name: "even number of values", values: []string{"1", "2", "4", "8"}, want: "1.5"},
+		{name: "equal values", values: []string{"5", "5", "5"}, want: "0"},
+		{name: "fractions of a Kg", values: []string{"0.4", "0.41", "0.5"}, want: "0.01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := rats(t, tt.values...)
+			got := calculateMedianAbsoluteDeviation(values, calculateMedian(values))
+			if got.Cmp(rats(t, tt.want)[0]) != 0 {
+				t.Errorf("calculateMedianAbsoluteDeviation(%v) = %v, want %v", tt.values, got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateFences(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []string
+		method    string
+		threshold string
+		wantLower string
+		wantUpper string
+	}{
+		{name: "IQR", values: []string{"100", "1", "4", "3", "2"}, method: MethodIQR, threshold: "1.5", wantLower: "-1", wantUpper: "7"},
+		{name: "MAD", values: []string{"1", "2", "3", "4", "100"}, method: MethodMAD, threshold: "3.5", wantLower: "-2953/1349", wantUpper: "11047/1349"},
+		{name: "MAD of equal values", values: []string{"5", "5", "5"}, method: MethodMAD, threshold: "3.5", wantLower: "5", wantUpper: "5"},
+		{name: "z-score", values: []string{"2", "4", "4", "4", "5", "5", "7", "9"}, method: MethodZScore, threshold: "2", wantLower: "0.7238201294", wantUpper: "9.2761798706"},
+		{name: "z-score of a single value", values: []string{"8"}, method: MethodZScore, threshold: "3", wantLower: "8", wantUpper: "8"},
+		{name: "seasonal", values: []string{"1", "3", "5"}, method: MethodSeasonal, threshold: "0.5", wantLower: "1.5", wantUpper: "4.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lower, upper, err := calculateFences(rats(t, tt.values...), &OutlierPolicy{Method: tt.method, Threshold: tt.threshold})
+			if err != nil {
+				t.Fatalf("calculateFences(%v, %s) failed: %v", tt.values, tt.method, err)
+			}
+			if !closeTo(lower, rats(t, tt.wantLower)[0]) || !closeTo(upper, rats(t, tt.wantUpper)[0]) {
+				t.Errorf("calculateFences(%v, %s) = [%v, %v], want [%v, %v]", tt.values, tt.method, lower.FloatString(10), upper.FloatString(10), tt.wantLower, tt.wantUpper)
+			}
+		})
+	}
+}
+
+func TestEvaluateOutlier(t *testing.T) {
+	kg := func(value string) *EmissionsRecord {
+		return &EmissionsRecord{CO2e: &Quantity{Unit: UnitKgCO2e, Value: value}}
+	}
+	fence := func(value string) *Quantity {
+		return &Quantity{Unit: UnitKgCO2e, Value: value}
+	}
+	tests := []struct {
+		name        string
+		record      *EmissionsRecord
+		previous    []*EmissionsRecord
+		wantRule    string
+		wantLower   *Quantity
+		wantUpper   *Quantity
+		wantOutlier bool
+	}{
+		{
+			name:     "no previous values",
+			record:   kg("12"),
+			wantRule: RuleInsufficientData,
+		},
+		{
+			name:      "median tolerance",
+			record:    &EmissionsRecord{CO2e: &Quantity{Unit: UnitGramCO2e, Value: "2250"}},
+			previous:  []*EmissionsRecord{kg("1"), kg("2")},
+			wantRule:  RuleMedianTolerance,
+			wantLower: fence("0.75"),
+			wantUpper: fence("2.25"),
+		},
+		{
+			name:        "grams above the upper fence",
+			record:      &EmissionsRecord{CO2e: &Quantity{Unit: UnitGramCO2e, Value: "2251"}},
+			previous:    []*EmissionsRecord{kg("1"), kg("2")},
+			wantRule:    RuleMedianTolerance,
+			wantLower:   fence("0.75"),
+			wantUpper:   fence("2.25"),
+			wantOutlier: true,
+		},
+		{
+			name:        "small parts are not rounded to whole Kg",
+			record:      kg("0.4004"),
+			previous:    []*EmissionsRecord{kg("0.4"), kg("0.4"), kg("0.4"), kg("0.4"), kg("0.4")},
+			wantRule:    MethodIQR,
+			wantLower:   fence("0.4"),
+			wantUpper:   fence("0.4"),
+			wantOutlier: true,
+		},
+		{
+			name:      "negative lower fence is stored as 0",
+			record:    kg("0"),
+			previous:  []*EmissionsRecord{kg("1"), kg("2"), kg("3"), kg("4"), kg("100")},
+			wantRule:  MethodIQR,
+			wantLower: fence("0"),
+			wantUpper: fence("7"),
+		},
+		{
+			name:        "records with whole Kg only",
+			record:      &EmissionsRecord{KgCO2: 8},
+			previous:    []*EmissionsRecord{{KgCO2: 1}, {KgCO2: 2}, {KgCO2: 3}, {KgCO2: 4}, {KgCO2: 100}},
+			wantRule:    MethodIQR,
+			wantLower:   fence("0"),
+			wantUpper:   fence("7"),
+			wantOutlier: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := defaultOutlierPolicy
+			decision, err := evaluateOutlier(tt.record, tt.previous, &policy, time.Unix(0, 0))
+			if err != nil {
+				t.Fatalf("evaluateOutlier failed: %v", err)
+			}
+			value, _ := recordCO2e(tt.record)
+			if decision.Value != value {
+				t.Errorf("Value = %v, want %v", decision.Value, value)
+			}
+			if decision.AppliedRule != tt.wantRule || decision.Outlier != tt.wantOutlier {
+				t.Errorf("AppliedRule, Outlier = %s, %v, want %s, %v", decision.AppliedRule, decision.Outlier, tt.wantRule, tt.wantOutlier)
+			}
+			if !equalQuantities(decision.LowerFence, tt.wantLower) || !equalQuantities(decision.UpperFence, tt.wantUpper) {
+				t.Errorf("fences = [%v, %v], want [%v, %v]", decision.LowerFence, decision.UpperFence, tt.wantLower, tt.wantUpper)
+			}
+		})
+	}
+}
+
+// equalQuantities compares optional quantities
+func equalQuantities(a *Quantity, b *Quantity) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestValidateOutlierPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     string
+		tolerance     string
+		wantThreshold string
+		wantTolerance string
+		wantErr       bool
+	}{
+		{name: "canonical decimals", threshold: "1.5", tolerance: "0.5", wantThreshold: "1.5", wantTolerance: "0.5"},
+		{name: "trailing zeros are removed", threshold: "3.000", tolerance: "0.250", wantThreshold: "3", wantTolerance: "0.25"},
+		{name: "zero threshold", threshold: "0", tolerance: "0.5", wantErr: true},
+		{name: "negative tolerance", threshold: "1.5", tolerance: "-0.5", wantErr: true},
+		{name: "exponent", threshold: "1e1", tolerance: "0.5", wantErr: true},
+		{name: "seven decimal places", threshold: "1.5", tolerance: "0.0000001", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := OutlierPolicy{Method: MethodIQR, MinValues: 5, Threshold: tt.threshold, Tolerance: tt.tolerance}
+			err := validateOutlierPolicy(&policy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("validateOutlierPolicy(%s, %s) succeeded, want error", tt.threshold, tt.tolerance)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateOutlierPolicy(%s, %s) failed: %v", tt.threshold, tt.tolerance, err)
+			}
+			if policy.Threshold != tt.wantThreshold || policy.Tolerance != tt.wantTolerance {
+				t.Errorf("validateOutlierPolicy(%s, %s) = %s, %s, want %s, %s", tt.threshold, tt.tolerance, policy.Threshold, policy.Tolerance, tt.wantThreshold, tt.wantTolerance)
+			}
+		})
+	}
+}
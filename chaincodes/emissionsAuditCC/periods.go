@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const reportingPeriodObjectType = "reportingPeriod"
+
+// Kinds of reporting periods
+const (
+	PeriodFiscalYear = "FISCAL_YEAR"
+	PeriodQuarter    = "QUARTER"
+)
+
+// Status of a reporting period
+const (
+	PeriodOpen   = "OPEN"   // New emissions can be assigned to the period
+	PeriodClosed = "CLOSED" // The period is locked, only approved amendments can change its records
+)
+
+// maxPeriodDays limits the length of a period of each kind, fiscal years may have 53 weeks
+var maxPeriodDays = map[string]int{
+	PeriodFiscalYear: 371,
+	PeriodQuarter:    98,
+}
+
+// ReportingPeriod describes a fiscal year or quarter of an organization, emissions records are assigned to it at audit time
+// Alphabetic order to achieve determinism accross languages
+type ReportingPeriod struct {
+	Attestation *Attestation `json:"Attestation,omitempty" metadata:",optional"` // Attestation of the inventory of the closed period by a verifier
+	BaseYear    bool         `json:"BaseYear"`                                   // Reference period emissions reductions are measured against
+	ClosedAt    string       `json:"ClosedAt,omitempty" metadata:",optional"`
+	ClosedBy    string       `json:"ClosedBy,omitempty" metadata:",optional"`
+	End         string       `json:"End"` // Last day of the period (YYYY-MM-DD)
+	ID          string       `json:"ID"`
+	Kind        string       `json:"Kind"`
+	MSPID       string       `json:"MSPID"`
+	Start       string       `json:"Start"` // First day of the period (YYYY-MM-DD)
+	Status      string       `json:"Status"`
+}
+
+// PeriodInventory describes the aggregated emissions of an organization in a reporting period
+// Alphabetic order to achieve determinism accross languages
+type PeriodInventory struct {
+	BaseYearCO2e     *Quantity          `json:"BaseYearCO2e,omitempty" metadata:",optional"`     // Exact total emissions of the base year, not set if no base year is designated
+	BaseYearKgCO2    int                `json:"BaseYearKgCO2"`                                   // Total emissions of the base year, 0 if no base year is designated
+	BaseYearPeriodID string             `json:"BaseYearPeriodID,omitempty" metadata:",optional"` // Not set if no base year is designated
+	ByCategory       []*ScopeAggregate  `json:"ByCategory"`
+	ByScope          []*ScopeAggregate  `json:"ByScope"`
+	Period           *ReportingPeriod   `json:"Period"`
+	RecordCount      int                `json:"RecordCount"`
+	Records          []*EmissionsRecord `json:"Records"`   // Latest revisions of the records assigned to the period
+	TotalCO2e        Quantity           `json:"TotalCO2e"` // Exact sum of the emissions in Kg of CO2 equivalents, in g if it cannot be expressed in Kg without rounding
+	TotalKgCO2       int                `json:"TotalKgCO2"`
+}
+
+// CreateReportingPeriod adds a fiscal year or quarter to the reporting periods of the invoking organization
+// Periods of an organization must not overlap, dates are given as YYYY-MM-DD
+func (s *SmartContract) CreateReportingPeriod(ctx contractapi.TransactionContextInterface, periodID string, kind string, start string, end string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+
+	if len(periodID) == 0 {
+		return fmt.Errorf("period ID must be a non-empty string")
+	}
+	maxDays, ok := maxPeriodDays[kind]
+	if !ok {
+		return fmt.Errorf("kind must be %s or %s, got %s", PeriodFiscalYear, PeriodQuarter, kind)
+	}
+	startDate, err := time.Parse(dateLayout, start)
+	if err != nil {
+		return fmt.Errorf("failed to parse start %s, expected YYYY-MM-DD: %v", start, err)
+	}
+	endDate, err := time.Parse(dateLayout, end)
+	if err != nil {
+		return fmt.Errorf("failed to parse end %s, expected YYYY-MM-DD: %v", end, err)
+	}
+	if endDate.Before(startDate) {
+		return fmt.Errorf("end %s must not be before start %s", end, start)
+	}
+	if days := int(endDate.Sub(startDate).Hours()/24) + 1; days > maxDays {
+		return fmt.Errorf("a period of kind %s must not exceed %d days, got %d", kind, maxDays, days)
+	}
+
+	periods, err := getReportingPeriods(ctx, clientMSPID)
+	if err != nil {
+		return err
+	}
+	for _, period := range periods {
+		if period.ID == periodID {
+			return fmt.Errorf("the reporting period %s already exists", periodID)
+		}
+		// Dates in the layout YYYY-MM-DD can be compared as strings
+		if start <= period.End && period.Start <= end {
+			return fmt.Errorf("the reporting period overlaps with %s (%s to %s)", period.ID, period.Start, period.End)
+		}
+	}
+
+	period := ReportingPeriod{
+		End:    end,
+		ID:     periodID,
+		Kind:   kind,
+		MSPID:  clientMSPID,
+		Start:  start,
+		Status: PeriodOpen,
+	}
+	return putReportingPeriod(ctx, &period)
+}
+
+// SetBaseYear designates a fiscal year of the invoking organization as its base year, replacing the previous base year
+func (s *SmartContract) SetBaseYear(ctx contractapi.TransactionContextInterface, periodID string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+
+	period, err := s.GetReportingPeriod(ctx, clientMSPID, periodID)
+	if err != nil {
+		return err
+	}
+	if period.Kind != PeriodFiscalYear {
+		return fmt.Errorf("only fiscal years can be base years, %s is a %s", periodID, period.Kind)
+	}
+
+	periods, err := getReportingPeriods(ctx, clientMSPID)
+	if err != nil {
+		return err
+	}
+	for _, other := range periods {
+		if other.BaseYear && other.ID != periodID {
+			other.BaseYear = false
+			err = putReportingPeriod(ctx, other)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	period.BaseYear = true
+	return putReportingPeriod(ctx, period)
+}
+
+// CloseReportingPeriod locks an ended reporting period of the invoking organization
+// No new emissions can be assigned to a closed period, its records can only be changed by approved amendments
+func (s *SmartContract) CloseReportingPeriod(ctx contractapi.TransactionContextInterface, periodID string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+
+	period, err := s.GetReportingPeriod(ctx, clientMSPID, periodID)
+	if err != nil {
+		return err
+	}
+	if period.Status != PeriodOpen {
+		return fmt.Errorf("the reporting period %s is already %s", periodID, period.Status)
+	}
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if txTime.Format(dateLayout) <= period.End {
+		return fmt.Errorf("the reporting period %s ends on %s and cannot be closed before", periodID, period.End)
+	}
+	clientID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+
+	period.ClosedAt = txTime.Format(time.RFC3339)
+	period.ClosedBy = clientID
+	period.Status = PeriodClosed
+	return putReportingPeriod(ctx, period)
+}
+
+// GetReportingPeriod returns a reporting period of an organization
+func (s *SmartContract) GetReportingPeriod(ctx contractapi.TransactionContextInterface, mspID string, periodID string) (*ReportingPeriod, error) {
+	return getReportingPeriod(ctx, mspID, periodID)
+}
+
+// GetReportingPeriods returns all reporting periods of an organization ordered by their start
+func (s *SmartContract) GetReportingPeriods(ctx contractapi.TransactionContextInterface, mspID string) ([]*ReportingPeriod, error) {
+	return getReportingPeriods(ctx, mspID)
+}
+
+// GetPeriodInventory returns the emissions of the invoking organization in a reporting period, summed up per scope and Scope 3 category
+// The records are read from the private data collection of the organization and include the records of all of its owners
+func (s *SmartContract) GetPeriodInventory(ctx contractapi.TransactionContextInterface, periodID string) (*PeriodInventory, error) {
+	err := verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetPeriodInventory cannot be performed: Error %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	period, err := s.GetReportingPeriod(ctx, clientMSPID, periodID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.getOrgRecords(ctx, map[string]string{"ReportingPeriod": periodID})
+	if err != nil {
+		return nil, err
+	}
+	byCategory, err := aggregateRecords(records, true)
+	if err != nil {
+		return nil, err
+	}
+	byScope, err := aggregateRecords(records, false)
+	if err != nil {
+		return nil, err
+	}
+	totalCO2e, err := sumRecordsCO2e(records)
+	if err != nil {
+		return nil, err
+	}
+	inventory := PeriodInventory{
+		ByCategory:  byCategory,
+		ByScope:     byScope,
+		Period:      period,
+		RecordCount: len(records),
+		Records:     records,
+		TotalCO2e:   totalCO2e,
+	}
+	for _, record := range records {
+		inventory.TotalKgCO2 += record.KgCO2
+	}
+
+	// Reductions are reported against the base year of the organization
+	periods, err := getReportingPeriods(ctx, clientMSPID)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range periods {
+		if !other.BaseYear {
+			continue
+		}
+		inventory.BaseYearPeriodID = other.ID
+		if other.ID == periodID {
+			inventory.BaseYearCO2e = &inventory.TotalCO2e
+			inventory.BaseYearKgCO2 = inventory.TotalKgCO2
+			break
+		}
+		baseRecords, err := s.getOrgRecords(ctx, map[string]string{"ReportingPeriod": other.ID})
+		if err != nil {
+			return nil, err
+		}
+		baseYearCO2e, err := sumRecordsCO2e(baseRecords)
+		if err != nil {
+			return nil, err
+		}
+		inventory.BaseYearCO2e = &baseYearCO2e
+		for _, record := range baseRecords {
+			inventory.BaseYearKgCO2 += record.KgCO2
+		}
+	}
+	return &inventory, nil
+}
+
+// HELPER FUNCTION assignReportingPeriod selects the reporting period of the organization new emissions are assigned to
+// By default this is the period the transaction falls into. Emissions of an earlier period can be submitted as long as it is open
+// Organizations without reporting periods do not assign records to periods
+// Transient Data: periodID string (optional)
+func assignReportingPeriod(ctx contractapi.TransactionContextInterface, mspID string, txTime time.Time) (string, error) {
+	periods, err := getReportingPeriods(ctx, mspID)
+	if err != nil {
+		return "", err
+	}
+	if len(periods) == 0 {
+		return "", nil
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("error getting transient: %v", err)
+	}
+	txDate := txTime.Format(dateLayout)
+	periodID, requested := transientMap["periodID"]
+	for _, period := range periods {
+		if requested && period.ID != string(periodID) {
+			continue
+		}
+		if !requested && (txDate < period.Start || txDate > period.End) {
+			continue
+		}
+		if period.Status != PeriodOpen {
+			return "", fmt.Errorf("the reporting period %s is %s, emissions can only be changed by amendments", period.ID, period.Status)
+		}
+		if txDate < period.Start {
+			return "", fmt.Errorf("the reporting period %s has not started yet", period.ID)
+		}
+		return period.ID, nil
+	}
+
+	if requested {
+		return "", fmt.Errorf("the reporting period %s of organization %s does not exist", periodID, mspID)
+	}
+	return "", fmt.Errorf("no reporting period of organization %s covers %s", mspID, txDate)
+}
+
+// HELPER FUNCTION verifyReportingPeriodOpen checks that new emissions can still be added to the period of a record
+func verifyReportingPeriodOpen(ctx contractapi.TransactionContextInterface, mspID string, record *EmissionsRecord) error {
+	if len(record.ReportingPeriod) == 0 {
+		return nil
+	}
+	period, err := getReportingPeriod(ctx, mspID, record.ReportingPeriod)
+	if err != nil {
+		return err
+	}
+	if period.Status != PeriodOpen {
+		return fmt.Errorf("the reporting period %s of the emissions record %s is %s", period.ID, record.ID, period.Status)
+	}
+	return nil
+}
+
+// HELPER FUNCTION getOrgRecords returns the latest revisions of the records of the invoking organization whose private details match the selector
+func (s *SmartContract) getOrgRecords(ctx contractapi.TransactionContextInterface, selector map[string]string) ([]*EmissionsRecord, error) {
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	queryJSON, err := json.Marshal(map[string]interface{}{
+		"selector": selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(orgCollection, string(queryJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the private data query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	records := []*EmissionsRecord{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate over private data query results: %v", err)
+		}
+		var details EmissionsRecordPrivateDetails
+		err = json.Unmarshal(queryResponse.Value, &details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal struct JSON: %v", err)
+		}
+		record, err := s.GetEmissionsRecord(ctx, details.ID)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// HELPER FUNCTION getReportingPeriod reads a reporting period of an organization from the ledger
+func getReportingPeriod(ctx contractapi.TransactionContextInterface, mspID string, periodID string) (*ReportingPeriod, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(reportingPeriodObjectType, []string{mspID, periodID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	periodJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if periodJSON == nil {
+		return nil, fmt.Errorf("the reporting period %s of organization %s does not exist", periodID, mspID)
+	}
+
+	var period ReportingPeriod
+	err = json.Unmarshal(periodJSON, &period)
+	if err != nil {
+		return nil, err
+	}
+	return &period, nil
+}
+
+// HELPER FUNCTION getReportingPeriods reads all reporting periods of an organization ordered by their start
+func getReportingPeriods(ctx contractapi.TransactionContextInterface, mspID string) ([]*ReportingPeriod, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(reportingPeriodObjectType, []string{mspID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	periods := []*ReportingPeriod{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var period ReportingPeriod
+		err = json.Unmarshal(queryResponse.Value, &period)
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, &period)
+	}
+
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Start < periods[j].Start
+	})
+	return periods, nil
+}
+
+// HELPER FUNCTION putReportingPeriod writes a reporting period to the ledger
+func putReportingPeriod(ctx contractapi.TransactionContextInterface, period *ReportingPeriod) error {
+	key, err := ctx.GetStub().CreateCompositeKey(reportingPeriodObjectType, []string{period.MSPID, period.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	periodJSON, err := json.Marshal(period)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, periodJSON)
+}
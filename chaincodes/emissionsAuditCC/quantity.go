@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// quantityDecimals is the number of decimal places of a quantity, values are calculated in millionths of their unit
+const quantityDecimals = 6
+
+// Units of quantities
+const (
+	UnitGramCO2e  = "gCO2e"
+	UnitKgCO2e    = "kgCO2e"
+	UnitTonneCO2e = "tCO2e"
+	UnitKg        = "kg"
+	UnitTonne     = "t"
+	UnitPiece     = "pcs"
+	UnitKWh       = "kWh"
+	UnitMWh       = "MWh"
+	UnitLitre     = "l"
+	UnitCubicM    = "m3"
+	UnitKm        = "km"
+	UnitTonneKm   = "tkm"
+)
+
+// quantityUnit describes what a unit measures and its size as power of 1000 of the smallest unit of the same dimension
+type quantityUnit struct {
+	dimension string
+	exponent  int
+}
+
+// quantityUnits lists all units a quantity can be given in, only units of the same dimension can be converted into each other
+var quantityUnits = map[string]quantityUnit{
+	UnitGramCO2e:  {dimension: "CO2e", exponent: 0},
+	UnitKgCO2e:    {dimension: "CO2e", exponent: 1},
+	UnitTonneCO2e: {dimension: "CO2e", exponent: 2},
+	UnitKg:        {dimension: "mass", exponent: 0},
+	UnitTonne:     {dimension: "mass", exponent: 1},
+	UnitPiece:     {dimension: "count", exponent: 0},
+	UnitKWh:       {dimension: "energy", exponent: 0},
+	UnitMWh:       {dimension: "energy", exponent: 1},
+	UnitLitre:     {dimension: "volume", exponent: 0},
+	UnitCubicM:    {dimension: "volume", exponent: 1},
+	UnitKm:        {dimension: "distance", exponent: 0},
+	UnitTonneKm:   {dimension: "transport", exponent: 0},
+}
+
+// quantityValuePattern matches non-negative decimals with up to quantityDecimals decimal places
+var quantityValuePattern = regexp.MustCompile(`^(0|[1-9][0-9]*)(\.[0-9]{1,6})?$`)
+
+// Quantity is a non-negative fixed-point decimal with an explicit unit, e.g. 12.5 kgCO2e
+// The value is kept as a decimal string, so it is exact and identical in every language. No floating-point arithmetic is used on it
+// The JSON names are the same as in the transferAssets chaincode, so quantities can be passed between both chaincodes unchanged
+// Alphabetic order to achieve determinism accross languages
+type Quantity struct {
+	Unit  string `json:"unit"`
+	Value string `json:"value"` // Decimal with up to 6 decimal places and without trailing zeros, e.g. 12.5
+}
+
+// HELPER FUNCTION parseQuantity checks a decimal value and unit and returns the quantity in its canonical form
+func parseQuantity(value string, unit string) (Quantity, error) {
+	q := Quantity{Unit: unit, Value: value}
+	units, err := q.millionths()
+	if err != nil {
+		return Quantity{}, err
+	}
+	return newQuantity(units, unit)
+}
+
+// HELPER FUNCTION parseDecimal checks a non-negative decimal with up to quantityDecimals decimal places, e.g. a parameter of a method,
+// and returns it as exact rational number
+func parseDecimal(value string) (*big.Rat, error) {
+	if !quantityValuePattern.MatchString(value) {
+		return nil, fmt.Errorf("%s must be a non-negative decimal with at most %d decimal places", value, quantityDecimals)
+	}
+	rat, _ := new(big.Rat).SetString(value)
+	return rat, nil
+}
+
+// HELPER FUNCTION quantityFromInt returns a whole number of a unit as quantity
+func quantityFromInt(value int, unit string) (Quantity, error) {
+	if value < 0 {
+		return Quantity{}, fmt.Errorf("quantity must not be negative, got %d %s", value, unit)
+	}
+	return parseQuantity(strconv.Itoa(value), unit)
+}
+
+// HELPER FUNCTION quantityFromRat rounds a rational number half up to quantityDecimals decimal places and returns it as quantity
+func quantityFromRat(value *big.Rat, unit string) (Quantity, error) {
+	if value.Sign() < 0 {
+		return Quantity{}, fmt.Errorf("quantity must not be negative, got %s %s", value.FloatString(quantityDecimals), unit)
+	}
+	scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(pow10(quantityDecimals)))
+	return newQuantity(roundHalfUp(scaled), unit)
+}
+
+// HELPER FUNCTION ratFromFloat converts a float64 into the decimal it is displayed as, e.g. 0.1 into exactly 1/10
+// The shortest decimal representation of a float64 is unique, so every peer obtains the same rational number
+func ratFromFloat(value float64) (*big.Rat, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%v is not a number", value)
+	}
+	rat, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("failed to convert %v into a decimal", value)
+	}
+	return rat, nil
+}
+
+// HELPER FUNCTION formatDecimal rounds a non-negative rational number half up to quantityDecimals decimal places and formats it
+func formatDecimal(value *big.Rat) string {
+	scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(pow10(quantityDecimals)))
+	return formatMillionths(roundHalfUp(scaled))
+}
+
+// HELPER FUNCTION newQuantity formats a number of millionths of a unit as quantity, it fails if the number is out of range
+func newQuantity(units *big.Int, unit string) (Quantity, error) {
+	if _, ok := quantityUnits[unit]; !ok {
+		return Quantity{}, fmt.Errorf("unknown unit %s", unit)
+	}
+	if units.Sign() < 0 {
+		return Quantity{}, fmt.Errorf("quantity must not be negative")
+	}
+	if !units.IsInt64() {
+		return Quantity{}, fmt.Errorf("quantity exceeds the supported range of %s", unit)
+	}
+
+	return Quantity{Unit: unit, Value: formatMillionths(units)}, nil
+}
+
+// HELPER FUNCTION formatMillionths formats a non-negative number of millionths as decimal without trailing zeros
+func formatMillionths(units *big.Int) string {
+	digits := units.String()
+	if len(digits) <= quantityDecimals {
+		digits = strings.Repeat("0", quantityDecimals-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-quantityDecimals]
+	fraction := strings.TrimRight(digits[len(digits)-quantityDecimals:], "0")
+	if len(fraction) == 0 {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+// HELPER FUNCTION millionths returns the value of the quantity in millionths of its unit
+func (q Quantity) millionths() (*big.Int, error) {
+	if _, ok := quantityUnits[q.Unit]; !ok {
+		return nil, fmt.Errorf("unknown unit %s", q.Unit)
+	}
+	if !quantityValuePattern.MatchString(q.Value) {
+		return nil, fmt.Errorf("quantity %s must be a non-negative decimal with at most %d decimal places", q.Value, quantityDecimals)
+	}
+
+	whole, fraction, _ := strings.Cut(q.Value, ".")
+	fraction += strings.Repeat("0", quantityDecimals-len(fraction))
+	units, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok || !units.IsInt64() {
+		return nil, fmt.Errorf("quantity %s exceeds the supported range of %s", q.Value, q.Unit)
+	}
+	return units, nil
+}
+
+// HELPER FUNCTION rat returns the value of the quantity as exact rational number in its unit
+func (q Quantity) rat() (*big.Rat, error) {
+	units, err := q.millionths()
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).SetFrac(units, pow10(quantityDecimals)), nil
+}
+
+// HELPER FUNCTION add returns the sum of two quantities of the same dimension in the unit of q
+// If the sum has more decimal places than a quantity can hold in that unit, it is returned in the smaller unit of other instead of rounding it
+func (q Quantity) add(other Quantity) (Quantity, error) {
+	a, err := q.baseMillionths()
+	if err != nil {
+		return Quantity{}, err
+	}
+	b, err := other.baseMillionths()
+	if err != nil {
+		return Quantity{}, err
+	}
+	if quantityUnits[q.Unit].dimension != quantityUnits[other.Unit].dimension {
+		return Quantity{}, fmt.Errorf("%s cannot be added to %s", other.Unit, q.Unit)
+	}
+
+	sum := a.Add(a, b)
+	factor := new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(quantityUnits[q.Unit].exponent)), nil)
+	units, remainder := new(big.Int).QuoRem(sum, factor, new(big.Int))
+	if remainder.Sign() == 0 || quantityUnits[other.Unit].exponent >= quantityUnits[q.Unit].exponent {
+		return newQuantity(units, q.Unit)
+	}
+	factor = new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(quantityUnits[other.Unit].exponent)), nil)
+	return newQuantity(sum.Quo(sum, factor), other.Unit)
+}
+
+// HELPER FUNCTION equal returns true if both quantities describe the same amount, regardless of their units
+func (q Quantity) equal(other Quantity) (bool, error) {
+	if quantityUnits[q.Unit].dimension != quantityUnits[other.Unit].dimension {
+		return false, fmt.Errorf("%s cannot be compared with %s", other.Unit, q.Unit)
+	}
+	a, err := q.baseMillionths()
+	if err != nil {
+		return false, err
+	}
+	b, err := other.baseMillionths()
+	if err != nil {
+		return false, err
+	}
+	return a.Cmp(b) == 0, nil
+}
+
+// HELPER FUNCTION ratIn returns the exact value of the quantity converted into another unit of the same dimension
+func (q Quantity) ratIn(unit string) (*big.Rat, error) {
+	to, ok := quantityUnits[unit]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %s", unit)
+	}
+	if quantityUnits[q.Unit].dimension != to.dimension {
+		return nil, fmt.Errorf("%s cannot be converted into %s", q.Unit, unit)
+	}
+	units, err := q.baseMillionths()
+	if err != nil {
+		return nil, err
+	}
+	factor := new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(to.exponent)), nil)
+	return new(big.Rat).SetFrac(units, factor.Mul(factor, pow10(quantityDecimals))), nil
+}
+
+// HELPER FUNCTION baseMillionths returns the value of the quantity in millionths of the smallest unit of its dimension
+func (q Quantity) baseMillionths() (*big.Int, error) {
+	units, err := q.millionths()
+	if err != nil {
+		return nil, err
+	}
+	factor := new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(quantityUnits[q.Unit].exponent)), nil)
+	return units.Mul(units, factor), nil
+}
+
+// HELPER FUNCTION wholeKgCO2e rounds emissions half up to whole Kg of CO2 equivalents
+func wholeKgCO2e(q Quantity) (int, error) {
+	kg, err := roundCO2e(q, UnitKgCO2e)
+	if err != nil {
+		return 0, err
+	}
+	if kg > math.MaxInt32 {
+		return 0, fmt.Errorf("total emissions of %s %s exceed the supported range", q.Value, q.Unit)
+	}
+	return int(kg), nil
+}
+
+// HELPER FUNCTION roundCO2e rounds emissions half up to whole units of gCO2e, kgCO2e or tCO2e
+func roundCO2e(q Quantity, unit string) (int64, error) {
+	from := quantityUnits[q.Unit]
+	to := quantityUnits[unit]
+	if from.dimension != "CO2e" || to.dimension != "CO2e" {
+		return 0, fmt.Errorf("emissions must be given in %s, %s or %s, got %s", UnitGramCO2e, UnitKgCO2e, UnitTonneCO2e, q.Unit)
+	}
+	units, err := q.millionths()
+	if err != nil {
+		return 0, err
+	}
+	// Millionths of the unit of the quantity are scaled to the target unit
+	scale := new(big.Rat).SetFrac(
+		new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(from.exponent)), nil),
+		new(big.Int).Mul(pow10(quantityDecimals), new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(to.exponent)), nil)),
+	)
+	rounded := roundHalfUp(new(big.Rat).Mul(new(big.Rat).SetInt(units), scale))
+	if !rounded.IsInt64() {
+		return 0, fmt.Errorf("total emissions of %s %s exceed the supported range", q.Value, q.Unit)
+	}
+	return rounded.Int64(), nil
+}
+
+// HELPER FUNCTION roundHalfUp rounds a non-negative rational number to the nearest integer, halves are rounded up
+func roundHalfUp(value *big.Rat) *big.Int {
+	numerator := new(big.Int).Mul(value.Num(), big.NewInt(2))
+	numerator.Add(numerator, value.Denom())
+	denominator := new(big.Int).Mul(value.Denom(), big.NewInt(2))
+	return numerator.Quo(numerator, denominator)
+}
+
+// HELPER FUNCTION pow10 returns 10 to the power of n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		unit    string
+		want    Quantity
+		wantErr bool
+	}{
+		{name: "whole number", value: "12", unit: UnitKgCO2e, want: Quantity{Unit: UnitKgCO2e, Value: "12"}},
+		{name: "trailing zeros are removed", value: "12.500", unit: UnitGramCO2e, want: Quantity{Unit: UnitGramCO2e, Value: "12.5"}},
+		{name: "zero fraction is removed", value: "3.000000", unit: UnitTonneCO2e, want: Quantity{Unit: UnitTonneCO2e, Value: "3"}},
+		{name: "six decimal places", value: "0.000001", unit: UnitKWh, want: Quantity{Unit: UnitKWh, Value: "0.000001"}},
+		{name: "activity unit", value: "1250.5", unit: UnitLitre, want: Quantity{Unit: UnitLitre, Value: "1250.5"}},
+		{name: "seven decimal places", value: "0.0000001", unit: UnitKgCO2e, wantErr: true},
+		{name: "negative", value: "-1", unit: UnitKgCO2e, wantErr: true},
+		{name: "leading zero", value: "007", unit: UnitKgCO2e, wantErr: true},
+		{name: "exponent", value: "1e3", unit: UnitKgCO2e, wantErr: true},
+		{name: "unknown unit", value: "1", unit: "lbCO2e", wantErr: true},
+		{name: "out of range", value: "9223372036855", unit: UnitKgCO2e, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseQuantity(tt.value, tt.unit)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseQuantity(%s, %s) = %v, want error", tt.value, tt.unit, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseQuantity(%s, %s) failed: %v", tt.value, tt.unit, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseQuantity(%s, %s) = %v, want %v", tt.value, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       Quantity
+		b       Quantity
+		want    Quantity
+		wantErr bool
+	}{
+		{name: "same unit", a: Quantity{Unit: UnitKgCO2e, Value: "1.5"}, b: Quantity{Unit: UnitKgCO2e, Value: "2.25"}, want: Quantity{Unit: UnitKgCO2e, Value: "3.75"}},
+		{name: "larger unit is converted", a: Quantity{Unit: UnitKgCO2e, Value: "1"}, b: Quantity{Unit: UnitTonneCO2e, Value: "0.5"}, want: Quantity{Unit: UnitKgCO2e, Value: "501"}},
+		{name: "smaller unit fits", a: Quantity{Unit: UnitKgCO2e, Value: "1"}, b: Quantity{Unit: UnitGramCO2e, Value: "250"}, want: Quantity{Unit: UnitKgCO2e, Value: "1.25"}},
+		{name: "smaller unit is kept instead of rounding", a: Quantity{Unit: UnitTonneCO2e, Value: "1"}, b: Quantity{Unit: UnitGramCO2e, Value: "0.5"}, want: Quantity{Unit: UnitGramCO2e, Value: "1000000.5"}},
+		{name: "different dimensions", a: Quantity{Unit: UnitKgCO2e, Value: "1"}, b: Quantity{Unit: UnitKg, Value: "1"}, wantErr: true},
+		{name: "invalid value", a: Quantity{Unit: UnitKgCO2e, Value: "1"}, b: Quantity{Unit: UnitKgCO2e, Value: "x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.add(tt.b)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("%v + %v = %v, want error", tt.a, tt.b, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v + %v failed: %v", tt.a, tt.b, err)
+			}
+			if got != tt.want {
+				t.Errorf("%v + %v = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityEqual(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       Quantity
+		b       Quantity
+		want    bool
+		wantErr bool
+	}{
+		{name: "same value", a: Quantity{Unit: UnitKgCO2e, Value: "2.5"}, b: Quantity{Unit: UnitKgCO2e, Value: "2.5"}, want: true},
+		{name: "same amount in other units", a: Quantity{Unit: UnitKgCO2e, Value: "2.5"}, b: Quantity{Unit: UnitGramCO2e, Value: "2500"}, want: true},
+		{name: "different amount", a: Quantity{Unit: UnitTonneCO2e, Value: "1"}, b: Quantity{Unit: UnitKgCO2e, Value: "999.999999"}, want: false},
+		{name: "volume units", a: Quantity{Unit: UnitCubicM, Value: "1.2"}, b: Quantity{Unit: UnitLitre, Value: "1200"}, want: true},
+		{name: "different dimensions", a: Quantity{Unit: UnitKWh, Value: "1"}, b: Quantity{Unit: UnitKg, Value: "1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.equal(tt.b)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("%v == %v = %v, want error", tt.a, tt.b, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v == %v failed: %v", tt.a, tt.b, err)
+			}
+			if got != tt.want {
+				t.Errorf("%v == %v = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundCO2e(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       Quantity
+		unit    string
+		want    int64
+		wantErr bool
+	}{
+		{name: "half is rounded up", q: Quantity{Unit: UnitGramCO2e, Value: "1500"}, unit: UnitKgCO2e, want: 2},
+		{name: "below half is rounded down", q: Quantity{Unit: UnitGramCO2e, Value: "1499.999999"}, unit: UnitKgCO2e, want: 1},
+		{name: "tonnes into kg", q: Quantity{Unit: UnitTonneCO2e, Value: "0.0125"}, unit: UnitKgCO2e, want: 13},
+		{name: "kg into grams", q: Quantity{Unit: UnitKgCO2e, Value: "0.000499"}, unit: UnitGramCO2e, want: 0},
+		{name: "kg into tonnes", q: Quantity{Unit: UnitKgCO2e, Value: "2500"}, unit: UnitTonneCO2e, want: 3},
+		{name: "no emissions", q: Quantity{Unit: UnitKWh, Value: "1"}, unit: UnitKgCO2e, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := roundCO2e(tt.q, tt.unit)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("roundCO2e(%v, %s) = %v, want error", tt.q, tt.unit, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("roundCO2e(%v, %s) failed: %v", tt.q, tt.unit, err)
+			}
+			if got != tt.want {
+				t.Errorf("roundCO2e(%v, %s) = %v, want %v", tt.q, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityFromRat(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   *big.Rat
+		want    Quantity
+		wantErr bool
+	}{
+		{name: "exact", value: big.NewRat(5, 4), want: Quantity{Unit: UnitKgCO2e, Value: "1.25"}},
+		{name: "rounded half up", value: big.NewRat(1, 2000000), want: Quantity{Unit: UnitKgCO2e, Value: "0.000001"}},
+		{name: "rounded down", value: big.NewRat(1, 3), want: Quantity{Unit: UnitKgCO2e, Value: "0.333333"}},
+		{name: "negative", value: big.NewRat(-1, 2), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := quantityFromRat(tt.value, UnitKgCO2e)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("quantityFromRat(%v) = %v, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("quantityFromRat(%v) failed: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("quantityFromRat(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityRatIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       Quantity
+		unit    string
+		want    *big.Rat
+		wantErr bool
+	}{
+		{name: "same unit", q: Quantity{Unit: UnitKgCO2e, Value: "1.25"}, unit: UnitKgCO2e, want: big.NewRat(5, 4)},
+		{name: "grams into kg", q: Quantity{Unit: UnitGramCO2e, Value: "0.000001"}, unit: UnitKgCO2e, want: big.NewRat(1, 1000000000)},
+		{name: "tonnes into kg", q: Quantity{Unit: UnitTonneCO2e, Value: "0.0125"}, unit: UnitKgCO2e, want: big.NewRat(25, 2)},
+		{name: "different dimensions", q: Quantity{Unit: UnitKg, Value: "1"}, unit: UnitKgCO2e, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.q.ratIn(tt.unit)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("%v in %s = %v, want error", tt.q, tt.unit, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v in %s failed: %v", tt.q, tt.unit, err)
+			}
+			if got.Cmp(tt.want) != 0 {
+				t.Errorf("%v in %s = %v, want %v", tt.q, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// emissionsRecordDocType marks emissions records in the world state, so rich queries skip all other objects
+const emissionsRecordDocType = "emissionsRecord"
+
+// maxPageSize limits the number of records returned by a single query
+const maxPageSize = 1000
+
+// EmissionsRecordsPage describes one page of the results of an emissions record query
+// Alphabetic order to achieve determinism accross languages
+type EmissionsRecordsPage struct {
+	Bookmark     string             `json:"Bookmark"`     // Pass to the next call to fetch the following page, empty on the last page
+	FetchedCount int32              `json:"FetchedCount"` // Number of records read for this page, including skipped superseded revisions
+	Records      []*EmissionsRecord `json:"Records"`
+	TotalCount   int                `json:"TotalCount"` // Number of records matching the query, -1 if it was not requested
+}
+
+// QueryEmissionsRecords returns one page of the emissions records matching the given filters
+// Filters with a zero value are ignored: scope and category 0, an empty product category, fromDate and toDate (YYYY-MM-DD)
+// and minKgCO2 and maxKgCO2 0. Superseded revisions are skipped, so a page may contain fewer than pageSize records.
+// Counting the total requires reading all matching records and should only be requested for the first page.
+// The total includes superseded revisions
+func (s *SmartContract) QueryEmissionsRecords(ctx contractapi.TransactionContextInterface, scope int, category int, productCategory string, fromDate string, toDate string, minKgCO2 int, maxKgCO2 int, pageSize int32, bookmark string, withTotal bool) (*EmissionsRecordsPage, error) {
+	err := verifyClientHasRole(ctx, RoleReader)
+	if err != nil {
+		return nil, err
+	}
+	err = validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]interface{}{"DocType": emissionsRecordDocType}
+	if scope != 0 {
+		selector["Scope"] = scope
+	}
+	if category != 0 {
+		selector["Category"] = category
+	}
+	if len(productCategory) > 0 {
+		selector["ProductCategory"] = productCategory
+	}
+
+	// Timestamps are stored as RFC3339 in UTC, so they can be compared as strings
+	period := map[string]string{}
+	if len(fromDate) > 0 {
+		from, err := time.Parse(dateLayout, fromDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fromDate %s, expected YYYY-MM-DD: %v", fromDate, err)
+		}
+		period["$gte"] = from.Format(time.RFC3339)
+	}
+	if len(toDate) > 0 {
+		to, err := time.Parse(dateLayout, toDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse toDate %s, expected YYYY-MM-DD: %v", toDate, err)
+		}
+		period["$lt"] = to.AddDate(0, 0, 1).Format(time.RFC3339)
+	}
+	if len(period) > 0 {
+		selector["Timestamp"] = period
+	}
+
+	if minKgCO2 < 0 || maxKgCO2 < 0 {
+		return nil, fmt.Errorf("emissions limits must not be negative")
+	}
+	if maxKgCO2 != 0 && minKgCO2 > maxKgCO2 {
+		return nil, fmt.Errorf("minKgCO2 %d must not exceed maxKgCO2 %d", minKgCO2, maxKgCO2)
+	}
+	emissionsRange := map[string]int{}
+	if minKgCO2 != 0 {
+		emissionsRange["$gte"] = minKgCO2
+	}
+	if maxKgCO2 != 0 {
+		emissionsRange["$lte"] = maxKgCO2
+	}
+	if len(emissionsRange) > 0 {
+		selector["KgCO2"] = emissionsRange
+	}
+
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, err
+	}
+	queryString := string(queryJSON)
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	page := EmissionsRecordsPage{
+		Bookmark:     metadata.Bookmark,
+		FetchedCount: metadata.FetchedRecordsCount,
+		Records:      []*EmissionsRecord{},
+		TotalCount:   -1,
+	}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record EmissionsRecord
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, err
+		}
+		// Only the latest revision of an amended record is returned
+		latest, err := s.resolveLatestRevision(ctx, &record)
+		if err != nil {
+			return nil, err
+		}
+		if latest.ID != record.ID {
+			continue
+		}
+		page.Records = append(page.Records, &record)
+	}
+	// CouchDB returns a bookmark even if the last page was read
+	if page.FetchedCount < pageSize {
+		page.Bookmark = ""
+	}
+
+	if withTotal {
+		page.TotalCount, err = countQueryResults(ctx, queryString)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &page, nil
+}
+
+// QueryEmissionsRecordsOfOwner returns one page of the latest revisions of the records of the invoking owner, ordered by ID
+// Private data queries cannot be paginated by the peer, the bookmark is the ID of the last record of the previous page
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) QueryEmissionsRecordsOfOwner(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string, withTotal bool) (*EmissionsRecordsPage, error) {
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	ownerID, err := getOwnerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := map[string]interface{}{"Owner": ownerID}
+	if len(bookmark) > 0 {
+		selector["ID"] = map[string]string{"$gt": bookmark}
+	}
+	queryJSON, err := json.Marshal(map[string]interface{}{
+		"selector": selector,
+		// The sort has to follow the fields of the Owner index of the collection
+		"sort": []map[string]string{{"Owner": "asc"}, {"ID": "asc"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(orgCollection, string(queryJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute the private data query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	page := EmissionsRecordsPage{
+		Records:    []*EmissionsRecord{},
+		TotalCount: -1,
+	}
+	for page.FetchedCount < pageSize && resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate over private data query results: %v", err)
+		}
+
+		var details EmissionsRecordPrivateDetails
+		err = json.Unmarshal(queryResponse.Value, &details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal struct JSON: %v", err)
+		}
+		record, err := s.GetEmissionsRecord(ctx, details.ID)
+		if err != nil {
+			return nil, err
+		}
+		page.Records = append(page.Records, record)
+		page.FetchedCount++
+		page.Bookmark = details.ID
+	}
+	// There is no next page if all results were read
+	if !resultsIterator.HasNext() {
+		page.Bookmark = ""
+	}
+
+	if withTotal {
+		recordsDetails, err := queryEmissionsRecordsOfOwner(ctx, orgCollection, ownerID, nil)
+		if err != nil {
+			return nil, err
+		}
+		page.TotalCount = len(recordsDetails)
+	}
+	return &page, nil
+}
+
+// HELPER FUNCTION validatePageSize checks that the page size is positive and does not exceed maxPageSize
+func validatePageSize(pageSize int32) error {
+	if pageSize <= 0 || pageSize > maxPageSize {
+		return fmt.Errorf("page size must be between 1 and %d, got %d", maxPageSize, pageSize)
+	}
+	return nil
+}
+
+// HELPER FUNCTION countQueryResults returns the number of world state entries matching a rich query
+func countQueryResults(ctx contractapi.TransactionContextInterface, queryString string) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute the query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		_, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// latestRevisionObjectType points from the first revision of a record to its latest revision
+const latestRevisionObjectType = "latestRevision"
+
+// Amendment describes how a revision of an emissions record came about
+// Revisions are separate records, the superseded record is never changed
+// Alphabetic order to achieve determinism accross languages
+type Amendment struct {
+	ApprovedBy string `json:"ApprovedBy"` // Identity of the auditor who approved the amendment
+	Reason     string `json:"Reason"`
+	Revision   int    `json:"Revision"`   // Revision number, the original record is revision 1
+	RootID     string `json:"RootID"`     // ID of the original record, identifies the revision chain
+	Supersedes string `json:"Supersedes"` // ID of the revision this revision replaces
+}
+
+// EmissionsRecordHistoryEntry describes a single modification of an emissions record key
+// Alphabetic order to achieve determinism accross languages
+type EmissionsRecordHistoryEntry struct {
+	IsDelete  bool             `json:"IsDelete"`
+	Record    *EmissionsRecord `json:"Record,omitempty" metadata:",optional"` // Not set for deletions
+	Timestamp string           `json:"Timestamp"`
+	TxID      string           `json:"TxID"`
+}
+
+// AmendEmissionsRecord requests a new revision of an emissions record with corrected per-gas emissions
+// An empty gwpTableID only allows CO2. The amendment opens an audit case and becomes the latest revision once an auditor approves it
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) AmendEmissionsRecord(ctx contractapi.TransactionContextInterface, id string, revisionID string, gases map[string]int, gwpTableID string, scope int, category int, reason string) error {
+	// Records without a GWP table only contain CO2
+	table := &GWPTable{Factors: map[string]float64{"CO2": 1}}
+	if len(gwpTableID) > 0 {
+		var err error
+		table, err = s.GetGWPTable(ctx, gwpTableID)
+		if err != nil {
+			return err
+		}
+	}
+	co2e, err := calculateCO2e(gases, table)
+	if err != nil {
+		return fmt.Errorf("failed to calculate CO2 equivalents: %v", err)
+	}
+
+	record := EmissionsRecord{
+		Category:   category,
+		GWPTableID: table.ID,
+		Gases:      gases,
+		ID:         revisionID,
+		Scope:      scope,
+	}
+	err = setRecordEmissions(&record, co2e)
+	if err != nil {
+		return err
+	}
+	return s.requestAmendment(ctx, id, &record, reason)
+}
+
+// AmendActivityEmissionsRecord requests a new revision of an emissions record recalculated from activity data,
+// e.g. after the emission factor was superseded. The current version of the referenced emission factor is used
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) AmendActivityEmissionsRecord(ctx contractapi.TransactionContextInterface, id string, revisionID string, activityAmount string, activityUnit string, factorID string, scope int, category int, reason string) error {
+	factor, err := s.usableEmissionFactor(ctx, factorID)
+	if err != nil {
+		return err
+	}
+
+	calculation, err := newActivityCalculation(activityAmount, activityUnit, factor)
+	if err != nil {
+		return err
+	}
+	co2e, err := calculateActivityEmissions(calculation, factor)
+	if err != nil {
+		return err
+	}
+
+	record := EmissionsRecord{
+		Calculation: calculation,
+		Category:    category,
+		ID:          revisionID,
+		Scope:       scope,
+	}
+	err = setRecordEmissions(&record, co2e)
+	if err != nil {
+		return err
+	}
+	return s.requestAmendment(ctx, id, &record, reason)
+}
+
+// GetEmissionsRecordRevisions returns all revisions of an emissions record, starting with the original record
+// Any revision of the chain can be passed as id
+func (s *SmartContract) GetEmissionsRecordRevisions(ctx contractapi.TransactionContextInterface, id string) ([]*EmissionsRecord, error) {
+	record, err := s.GetEmissionsRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Follow the chain from the latest revision back to the original record
+	revisions := []*EmissionsRecord{record}
+	for record.Amendment != nil {
+		record, err = s.GetEmissionsRecordRevision(ctx, record.Amendment.Supersedes)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, record)
+	}
+
+	for i, j := 0, len(revisions)-1; i < j; i, j = i+1, j-1 {
+		revisions[i], revisions[j] = revisions[j], revisions[i]
+	}
+	return revisions, nil
+}
+
+// GetEmissionsRecordHistory returns every modification of the ledger key of exactly the given revision
+func (s *SmartContract) GetEmissionsRecordHistory(ctx contractapi.TransactionContextInterface, id string) ([]*EmissionsRecordHistoryEntry, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the history of %s: %v", id, err)
+	}
+	defer resultsIterator.Close()
+
+	var history []*EmissionsRecordHistoryEntry
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := EmissionsRecordHistoryEntry{
+			IsDelete:  modification.IsDelete,
+			Timestamp: modification.Timestamp.AsTime().UTC().Format(time.RFC3339),
+			TxID:      modification.TxId,
+		}
+		if !modification.IsDelete {
+			var record EmissionsRecord
+			err = json.Unmarshal(modification.Value, &record)
+			if err != nil {
+				return nil, err
+			}
+			entry.Record = &record
+		}
+		history = append(history, &entry)
+	}
+
+	return history, nil
+}
+
+// HELPER FUNCTION requestAmendment checks that the invoking owner owns the record and opens an audit case for the new revision
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) requestAmendment(ctx contractapi.TransactionContextInterface, id string, revision *EmissionsRecord, reason string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	if len(reason) == 0 {
+		return fmt.Errorf("reason must be a non-empty string")
+	}
+	err = validateScope(revision.Scope, revision.Category)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.GetEmissionsRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	rootID := current.ID
+	number := 1
+	if current.Amendment != nil {
+		rootID = current.Amendment.RootID
+		number = current.Amendment.Revision
+	}
+
+	// Only the owner of the record may amend it, the private details are kept under the ID of the original record
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("AmendEmissionsRecord cannot be performed: Error %v", err)
+	}
+	ownerID, err := getOwnerID(ctx)
+	if err != nil {
+		return err
+	}
+	details, err := s.GetEmissionsRecordPrivateDetails(ctx, rootID)
+	if err != nil {
+		return err
+	}
+	if details == nil || details.Owner != ownerID {
+		return fmt.Errorf("the emissions record with ID %s is not owned by the invoking owner", id)
+	}
+
+	exists, err := s.EmissionsRecordExists(ctx, revision.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the Emissions Record with ID %s already exists", revision.ID)
+	}
+	exists, err = s.AuditCaseExists(ctx, revision.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("an audit case for the Emissions Record with ID %s already exists", revision.ID)
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	revision.Amendment = &Amendment{
+		Reason:     reason,
+		Revision:   number + 1,
+		RootID:     rootID,
+		Supersedes: current.ID,
+	}
+	// The product category, facility and reporting period decide which history and inventories a record belongs to and cannot be amended
+	revision.FacilityID = current.FacilityID
+	revision.ProductCategory = current.ProductCategory
+	revision.ReportingPeriod = current.ReportingPeriod
+	revision.Timestamp = txTime.Format(time.RFC3339)
+
+	caseReason := fmt.Sprintf("amendment of emissions record %s: %s", current.ID, reason)
+	err = createAuditReport(ctx, revision, []string{}, reason, ReportManual, caseReason)
+	if err != nil {
+		return err
+	}
+	return s.openAuditCase(ctx, CaseKindAmendment, revision, []string{}, reason, caseReason)
+}
+
+// HELPER FUNCTION approveAmendment writes an approved revision to the ledger and makes it the latest revision of its chain
+func (s *SmartContract) approveAmendment(ctx contractapi.TransactionContextInterface, revision *EmissionsRecord, auditor string) error {
+	latest, err := s.GetEmissionsRecord(ctx, revision.Amendment.RootID)
+	if err != nil {
+		return err
+	}
+	// Another amendment may have been approved since this one was requested
+	if latest.ID != revision.Amendment.Supersedes {
+		return fmt.Errorf("the emissions record %s was superseded by %s in the meantime, the amendment has to be requested again", revision.Amendment.Supersedes, latest.ID)
+	}
+
+	revision.Amendment.ApprovedBy = auditor
+	err = putEmissionsRecord(ctx, revision)
+	if err != nil {
+		return fmt.Errorf("failed to create emissions record: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(latestRevisionObjectType, []string{revision.Amendment.RootID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(key, []byte(revision.ID))
+	if err != nil {
+		return err
+	}
+	// The tokens of the chain follow the emissions of the latest revision
+	return adjustEmissionsTokens(ctx, revision)
+}
+
+// HELPER FUNCTION resolveLatestRevision returns the latest revision of the chain the given record belongs to
+func (s *SmartContract) resolveLatestRevision(ctx contractapi.TransactionContextInterface, record *EmissionsRecord) (*EmissionsRecord, error) {
+	rootID := record.ID
+	if record.Amendment != nil {
+		rootID = record.Amendment.RootID
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(latestRevisionObjectType, []string{rootID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	latestID, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	// Records which were never amended have no pointer
+	if latestID == nil || string(latestID) == record.ID {
+		return record, nil
+	}
+	return s.GetEmissionsRecordRevision(ctx, string(latestID))
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const roleAssignmentObjectType = "roleAssignment"
+
+// rolesAttribute is the attribute of a client certificate that restricts the client to some of the roles of its organization
+const rolesAttribute = "emissionsRoles"
+
+// identityTypeAttribute is the attribute of a client certificate holding the identity type registered at the Fabric CA
+const identityTypeAttribute = "hf.Type"
+
+// Roles of the emissions contract
+const (
+	RoleSubmitter   = "submitter"    // Submits emissions for audit and requests amendments
+	RoleAuditor     = "auditor"      // Performs manual re-audits and may create records directly
+	RoleFactorAdmin = "factor-admin" // Maintains the emission factor registry
+	RoleReader      = "reader"       // Runs queries over all records, audit reports and cases
+	RoleRoleAdmin   = "role-admin"   // Manages the role registry, together with CA admins of the admin org
+)
+
+// validRoles lists all roles that can be assigned
+var validRoles = map[string]bool{
+	RoleSubmitter:   true,
+	RoleAuditor:     true,
+	RoleFactorAdmin: true,
+	RoleReader:      true,
+	RoleRoleAdmin:   true,
+}
+
+// defaultOrgRoles are the roles of an organization as long as no organization-wide assignment is stored in the ledger
+var defaultOrgRoles = map[string][]string{
+	"Org1MSP": {RoleSubmitter, RoleFactorAdmin, RoleReader},
+	"Org2MSP": {RoleSubmitter, RoleReader},
+	"Org3MSP": {RoleAuditor, RoleReader},
+}
+
+// RoleAssignment describes the roles granted to an organization or a single identity of an organization
+// Alphabetic order to achieve determinism accross languages
+type RoleAssignment struct {
+	GrantedAt string   `json:"GrantedAt"`
+	GrantedBy string   `json:"GrantedBy"`
+	MSPID     string   `json:"MSPID"`
+	Roles     []string `json:"Roles"`
+	Subject   string   `json:"Subject"` // Client identifier (MSPID::ID) of the identity, empty for the whole organization
+}
+
+// SetRoleAssignment grants roles to an organization (empty subject) or to a single identity of it
+// An organization-wide assignment replaces the default roles of the organization, an empty list revokes all of them
+// The auditor role is never granted within the organization of the invoking admin while that organization submits emissions
+func (s *SmartContract) SetRoleAssignment(ctx contractapi.TransactionContextInterface, mspID string, subject string, roles []string) error {
+	err := verifyClientIsRoleAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(mspID) == 0 {
+		return fmt.Errorf("MSPID must be a non-empty string")
+	}
+	if len(subject) > 0 && !strings.HasPrefix(subject, mspID+"::") {
+		return fmt.Errorf("subject %s is not an identity of organization %s", subject, mspID)
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	for _, role := range roles {
+		if !validRoles[role] {
+			return fmt.Errorf("unknown role %s", role)
+		}
+	}
+	sort.Strings(roles)
+	err = verifyAuditorSeparation(ctx, mspID, subject, roles)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	clientID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+	assignment := RoleAssignment{
+		GrantedAt: txTime.Format(time.RFC3339),
+		GrantedBy: clientID,
+		MSPID:     mspID,
+		Roles:     roles,
+		Subject:   subject,
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(roleAssignmentObjectType, []string{mspID, subject})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	assignmentJSON, err := json.Marshal(assignment)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, assignmentJSON)
+}
+
+// DeleteRoleAssignment removes a role assignment, deleting an organization-wide assignment restores the default roles
+func (s *SmartContract) DeleteRoleAssignment(ctx contractapi.TransactionContextInterface, mspID string, subject string) error {
+	err := verifyClientIsRoleAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	assignment, err := getRoleAssignment(ctx, mspID, subject)
+	if err != nil {
+		return err
+	}
+	if assignment == nil {
+		return fmt.Errorf("no role assignment exists for organization \"%s\" and subject \"%s\"", mspID, subject)
+	}
+	if len(subject) == 0 {
+		// The default roles of the organization apply again
+		err = verifyAuditorSeparation(ctx, mspID, subject, defaultOrgRoles[mspID])
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(roleAssignmentObjectType, []string{mspID, subject})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// GetAllRoleAssignments returns all role assignments stored in the ledger
+func (s *SmartContract) GetAllRoleAssignments(ctx contractapi.TransactionContextInterface) ([]*RoleAssignment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(roleAssignmentObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var assignments []*RoleAssignment
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var assignment RoleAssignment
+		err = json.Unmarshal(queryResponse.Value, &assignment)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, &assignment)
+	}
+
+	return assignments, nil
+}
+
+// GetClientRoles returns the roles of the invoking client
+func (s *SmartContract) GetClientRoles(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	return getClientRoles(ctx)
+}
+
+// HELPER FUNCTION getClientRoles collects the roles of the invoking client
+// The roles of its organization are restricted to those named in the emissionsRoles certificate attribute if present,
+// roles granted to the identity itself in the ledger are always added
+func getClientRoles(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	clientID, err := getClientIdentifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orgRoles, err := getOrgRoles(ctx, clientMSPID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificate authority of an organization can only narrow down the roles of the organization, not extend them
+	attributeRoles, found, err := ctx.GetClientIdentity().GetAttributeValue(rolesAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the %s attribute: %v", rolesAttribute, err)
+	}
+	allowed := map[string]bool{}
+	if found {
+		for _, role := range strings.Split(attributeRoles, ",") {
+			allowed[strings.TrimSpace(role)] = true
+		}
+	}
+
+	roles := map[string]bool{}
+	for _, role := range orgRoles {
+		if !found || allowed[role] {
+			roles[role] = true
+		}
+	}
+	identityAssignment, err := getRoleAssignment(ctx, clientMSPID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if identityAssignment != nil {
+		for _, role := range identityAssignment.Roles {
+			roles[role] = true
+		}
+	}
+
+	result := make([]string, 0, len(roles))
+	for role := range roles {
+		result = append(result, role)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// HELPER FUNCTION verifyClientHasRole checks that the invoking client holds the given role
+func verifyClientHasRole(ctx contractapi.TransactionContextInterface, role string) error {
+	roles, err := getClientRoles(ctx)
+	if err != nil {
+		return err
+	}
+	if containsRole(roles, role) {
+		return nil
+	}
+	return fmt.Errorf("client does not hold the %s role", role)
+}
+
+// HELPER FUNCTION getOrgRoles returns the roles of an organization, the default roles apply as long as no organization-wide assignment exists
+func getOrgRoles(ctx contractapi.TransactionContextInterface, mspID string) ([]string, error) {
+	orgAssignment, err := getRoleAssignment(ctx, mspID, "")
+	if err != nil {
+		return nil, err
+	}
+	if orgAssignment != nil {
+		return orgAssignment.Roles, nil
+	}
+	return defaultOrgRoles[mspID], nil
+}
+
+// HELPER FUNCTION verifyClientIsRoleAdmin checks that the client may manage the role registry
+// Membership in the admin org is not sufficient, the client has to be registered as admin at the CA of the org (hf.Type=admin
+// in the certificate) or hold the role-admin role
+func verifyClientIsRoleAdmin(ctx contractapi.TransactionContextInterface) error {
+	err := verifyClientIsAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	identityType, found, err := ctx.GetClientIdentity().GetAttributeValue(identityTypeAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to read the %s attribute: %v", identityTypeAttribute, err)
+	}
+	if found && identityType == "admin" {
+		return nil
+	}
+	err = verifyClientHasRole(ctx, RoleRoleAdmin)
+	if err != nil {
+		return fmt.Errorf("client is neither a CA admin (%s=admin) nor holds the %s role: %v", identityTypeAttribute, RoleRoleAdmin, err)
+	}
+	return nil
+}
+
+// HELPER FUNCTION verifyAuditorSeparation checks that a role assignment does not let the organization of the invoking admin
+// audit its own emissions. Within that organization the submitter and auditor roles must not be held at the same time,
+// neither by the organization nor by single identities while the organization holds submitter
+// roles are the roles the assignment of mspID and subject will hold
+func verifyAuditorSeparation(ctx contractapi.TransactionContextInterface, mspID string, subject string, roles []string) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	if mspID != clientMSPID {
+		return nil
+	}
+
+	orgRoles := roles
+	if len(subject) > 0 {
+		orgRoles, err = getOrgRoles(ctx, mspID)
+		if err != nil {
+			return err
+		}
+	}
+	if !containsRole(orgRoles, RoleSubmitter) {
+		return nil
+	}
+	if containsRole(orgRoles, RoleAuditor) || containsRole(roles, RoleAuditor) {
+		return fmt.Errorf("the %s role cannot be granted within organization %s of the invoking admin, as it holds the %s role", RoleAuditor, mspID, RoleSubmitter)
+	}
+
+	// Identities of the organization which already hold auditor would audit the emissions of their organization
+	if len(subject) == 0 {
+		resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(roleAssignmentObjectType, []string{mspID})
+		if err != nil {
+			return err
+		}
+		defer resultsIterator.Close()
+
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				return err
+			}
+			var assignment RoleAssignment
+			err = json.Unmarshal(queryResponse.Value, &assignment)
+			if err != nil {
+				return err
+			}
+			if len(assignment.Subject) > 0 && containsRole(assignment.Roles, RoleAuditor) {
+				return fmt.Errorf("the %s role cannot be granted to organization %s of the invoking admin, as identity %s holds the %s role", RoleSubmitter, mspID, assignment.Subject, RoleAuditor)
+			}
+		}
+	}
+	return nil
+}
+
+// HELPER FUNCTION containsRole returns true if the role is in the list
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HELPER FUNCTION getRoleAssignment reads a role assignment from the ledger, it returns nil if the assignment does not exist
+func getRoleAssignment(ctx contractapi.TransactionContextInterface, mspID string, subject string) (*RoleAssignment, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(roleAssignmentObjectType, []string{mspID, subject})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	assignmentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if assignmentJSON == nil {
+		return nil, nil
+	}
+
+	var assignment RoleAssignment
+	err = json.Unmarshal(assignmentJSON, &assignment)
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
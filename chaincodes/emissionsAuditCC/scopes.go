@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// GHG Protocol scopes
+const (
+	Scope1 = 1 // Direct emissions from owned or controlled sources
+	Scope2 = 2 // Indirect emissions from purchased energy
+	Scope3 = 3 // All other indirect emissions in the value chain
+)
+
+// scope3Categories lists the 15 upstream (1-8) and downstream (9-15) Scope 3 categories of the GHG Protocol
+var scope3Categories = map[int]string{
+	1:  "Purchased goods and services",
+	2:  "Capital goods",
+	3:  "Fuel- and energy-related activities",
+	4:  "Upstream transportation and distribution",
+	5:  "Waste generated in operations",
+	6:  "Business travel",
+	7:  "Employee commuting",
+	8:  "Upstream leased assets",
+	9:  "Downstream transportation and distribution",
+	10: "Processing of sold products",
+	11: "Use of sold products",
+	12: "End-of-life treatment of sold products",
+	13: "Downstream leased assets",
+	14: "Franchises",
+	15: "Investments",
+}
+
+// ScopeAggregate describes the summed emissions of an owner within one scope or Scope 3 category
+// Alphabetic order to achieve determinism accross languages
+type ScopeAggregate struct {
+	CO2e         Quantity `json:"CO2e"`     // Exact sum of the emissions in Kg of CO2 equivalents, in g if it cannot be expressed in Kg without rounding
+	Category     int      `json:"Category"` // Scope 3 category, 0 for Scope 1 and 2 or when aggregating whole scopes
+	CategoryName string   `json:"CategoryName"`
+	KgCO2        int      `json:"KgCO2"` // Summed emissions in whole Kg of CO2 equivalents of the records
+	RecordCount  int      `json:"RecordCount"`
+	Scope        int      `json:"Scope"`
+}
+
+// GetEmissionsOfOwnerByScope returns the emissions of the invoking owner summed up per scope
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) GetEmissionsOfOwnerByScope(ctx contractapi.TransactionContextInterface) ([]*ScopeAggregate, error) {
+	return s.aggregateEmissionsOfOwner(ctx, false)
+}
+
+// GetEmissionsOfOwnerByCategory returns the emissions of the invoking owner summed up per scope and Scope 3 category
+// Transient Data: ownerID string (optional, delegates only)
+func (s *SmartContract) GetEmissionsOfOwnerByCategory(ctx contractapi.TransactionContextInterface) ([]*ScopeAggregate, error) {
+	return s.aggregateEmissionsOfOwner(ctx, true)
+}
+
+// HELPER FUNCTION aggregateEmissionsOfOwner sums up the public emissions records of the owner found in the private data collection
+func (s *SmartContract) aggregateEmissionsOfOwner(ctx contractapi.TransactionContextInterface, byCategory bool) ([]*ScopeAggregate, error) {
+	recordsDetails, err := s.GetEmissionsRecordsOfOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*EmissionsRecord{}
+	for _, details := range recordsDetails {
+		record, err := s.GetEmissionsRecord(ctx, details.ID)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return aggregateRecords(records, byCategory)
+}
+
+// HELPER FUNCTION aggregateRecords sums up emissions records per scope and, if byCategory is set, per Scope 3 category
+func aggregateRecords(records []*EmissionsRecord, byCategory bool) ([]*ScopeAggregate, error) {
+	aggregates := make(map[[2]int]*ScopeAggregate)
+	for _, record := range records {
+		category := 0
+		if byCategory {
+			category = record.Category
+		}
+		key := [2]int{record.Scope, category}
+		aggregate, ok := aggregates[key]
+		if !ok {
+			aggregate = &ScopeAggregate{
+				CO2e:         Quantity{Unit: UnitKgCO2e, Value: "0"},
+				Category:     category,
+				CategoryName: scope3Categories[category],
+				Scope:        record.Scope,
+			}
+			aggregates[key] = aggregate
+		}
+		co2e, err := recordCO2e(record)
+		if err != nil {
+			return nil, err
+		}
+		aggregate.CO2e, err = aggregate.CO2e.add(co2e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sum up the emissions of scope %d: %v", record.Scope, err)
+		}
+		aggregate.KgCO2 += record.KgCO2
+		aggregate.RecordCount++
+	}
+
+	// Map iteration order is random, sort the results to return a deterministic response
+	results := []*ScopeAggregate{}
+	for _, aggregate := range aggregates {
+		results = append(results, aggregate)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Scope != results[j].Scope {
+			return results[i].Scope < results[j].Scope
+		}
+		return results[i].Category < results[j].Category
+	})
+	return results, nil
+}
+
+// HELPER FUNCTION sumRecordsCO2e returns the exact sum of the emissions of records in Kg of CO2 equivalents, in g if it cannot be expressed in Kg without rounding
+func sumRecordsCO2e(records []*EmissionsRecord) (Quantity, error) {
+	total := Quantity{Unit: UnitKgCO2e, Value: "0"}
+	for _, record := range records {
+		co2e, err := recordCO2e(record)
+		if err != nil {
+			return Quantity{}, err
+		}
+		total, err = total.add(co2e)
+		if err != nil {
+			return Quantity{}, fmt.Errorf("failed to sum up the emissions of the records: %v", err)
+		}
+	}
+	return total, nil
+}
+
+// HELPER FUNCTION validateScope checks that the scope and category follow the GHG Protocol classification
+// Scope 1 and 2 emissions have no category, Scope 3 emissions must name one of the 15 categories
+func validateScope(scope int, category int) error {
+	switch scope {
+	case Scope1, Scope2:
+		if category != 0 {
+			return fmt.Errorf("scope %d emissions must not have a category, got %d", scope, category)
+		}
+	case Scope3:
+		if _, ok := scope3Categories[category]; !ok {
+			return fmt.Errorf("scope 3 category must be between 1 and 15, got %d", category)
+		}
+	default:
+		return fmt.Errorf("scope must be 1, 2 or 3, got %d", scope)
+	}
+	return nil
+}
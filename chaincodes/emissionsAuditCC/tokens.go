@@ -0,0 +1,760 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const (
+	tokenAccountObjectType          = "tokenAccount"
+	tokenGoodsObjectType            = "tokenGoods"
+	tokenIssuanceObjectType         = "tokenIssuance"
+	tokenTransactionObjectType      = "tokenTransaction"
+	tokenTransactionByOrgObjectType = "tokenTransactionByOrg"
+)
+
+// assetsChaincodeName is the name the asset transfer chaincode is deployed with on the same channel
+const assetsChaincodeName = "transferAssets"
+
+// Kinds of token transactions
+const (
+	TokenMint     = "MINT"     // Tokens issued for audited emissions or an amendment which increased them
+	TokenBurn     = "BURN"     // Tokens removed after an amendment decreased the audited emissions
+	TokenTransfer = "TRANSFER" // Tokens passed on to another organization together with goods
+	TokenRetire   = "RETIRE"   // Tokens taken out of circulation when a final product is sold
+)
+
+// TokenAccount describes the emissions tokens held by an organization, one token equals 1 Kg of CO2 equivalents
+// Balance always equals Minted - Burned + Received - Sent - Retired
+// Alphabetic order to achieve determinism accross languages
+type TokenAccount struct {
+	Balance  int    `json:"Balance"`
+	Burned   int    `json:"Burned"`
+	MSPID    string `json:"MSPID"`
+	Minted   int    `json:"Minted"`
+	Received int    `json:"Received"`
+	Retired  int    `json:"Retired"`
+	Sent     int    `json:"Sent"`
+}
+
+// TokenIssuance describes the tokens issued for the revision chain of an emissions record
+// Alphabetic order to achieve determinism accross languages
+type TokenIssuance struct {
+	Amount   int    `json:"Amount"`   // Equals the KgCO2 of the latest revision
+	MSPID    string `json:"MSPID"`    // Organization the tokens were minted to
+	RecordID string `json:"RecordID"` // Latest revision the tokens were issued for
+	RootID   string `json:"RootID"`
+}
+
+// TokenTransaction describes a single mint, burn, transfer or retirement of emissions tokens
+// Alphabetic order to achieve determinism accross languages
+type TokenTransaction struct {
+	Amount    int    `json:"Amount"`
+	From      string `json:"From,omitempty" metadata:",optional"` // Not set for mints
+	Kind      string `json:"Kind"`
+	RecordID  string `json:"RecordID,omitempty" metadata:",optional"`  // Emissions record of mints and burns
+	Reference string `json:"Reference,omitempty" metadata:",optional"` // Goods of a transfer or final product of a retirement
+	Timestamp string `json:"Timestamp"`
+	To        string `json:"To,omitempty" metadata:",optional"` // Not set for burns and retirements
+	TxID      string `json:"TxID"`
+}
+
+// TokenSupply describes the emissions tokens of all organizations
+// Alphabetic order to achieve determinism accross languages
+type TokenSupply struct {
+	Burned      int `json:"Burned"`
+	Circulating int `json:"Circulating"` // Tokens held by organizations, equals Minted - Burned - Retired
+	Minted      int `json:"Minted"`
+	Retired     int `json:"Retired"`
+}
+
+// tokenGoods describes the tokens moved with a shipping or retired for a final product of the asset transfer chaincode
+// Alphabetic order to achieve determinism accross languages
+type tokenGoods struct {
+	Amount    int    `json:"Amount"`
+	Kind      string `json:"Kind"`
+	Reference string `json:"Reference"` // Shipping ID of transfers, asset ID of the final product of retirements
+}
+
+// ShippedEmissionsShare is a weighted reference of the asset transfer chaincode to an emissions record embodied in a shipping
+type ShippedEmissionsShare struct {
+	ID    string `json:"emissionsID"`
+	Share string `json:"share"` // Exact fraction of the emissions record, e.g. "7/10"
+}
+
+// assetFinalProduct holds the fields of a final product of the asset transfer chaincode that are needed here
+type assetFinalProduct struct {
+	GHG               int    `json:"GHG"` // Cradle-to-gate footprint in KgCO2e when the product was created
+	ID                string `json:"assetID"`
+	ManufacturerMSPID string `json:"manufacturerMSPID"`
+}
+
+// TokenReconciliation describes the result of comparing the token accounts with the audited emissions records
+// Alphabetic order to achieve determinism accross languages
+type TokenReconciliation struct {
+	Accounts   []*TokenAccount `json:"Accounts"`
+	Issues     []string        `json:"Issues"`
+	Reconciled bool            `json:"Reconciled"` // True if no issues were found
+	Supply     *TokenSupply    `json:"Supply"`
+}
+
+// TransferShippingTokens passes the tokens of the emissions embodied in a shipping from the seller to the buyer claiming it
+// It is invoked by ClaimShipping of the asset transfer chaincode with the weighted emissions records of the claimed assets,
+// the invoking organization is the buyer. The amount is the exact CO2e of the latest revisions of the records weighted
+// with their shares and rounded half up. Tokens that were never minted to the seller, e.g. for records audited before
+// the token ledger was introduced, cannot be passed on, so at most the balance of the seller is transferred
+func (s *SmartContract) TransferShippingTokens(ctx contractapi.TransactionContextInterface, shippingID string, sellerMSPID string, shares []ShippedEmissionsShare) error {
+	err := verifyInvokedByClaimShipping(ctx)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	if len(shippingID) == 0 {
+		return fmt.Errorf("shippingID must be a non-empty string")
+	}
+	if len(sellerMSPID) == 0 {
+		return fmt.Errorf("seller MSPID must be a non-empty string")
+	}
+	if sellerMSPID == clientMSPID {
+		return fmt.Errorf("tokens cannot be transferred to the own organization")
+	}
+	goods, err := getTokenGoods(ctx, TokenTransfer, shippingID)
+	if err != nil {
+		return err
+	}
+	if goods != nil {
+		return fmt.Errorf("%d tokens were already transferred with shipping %s", goods.Amount, shippingID)
+	}
+
+	total := new(big.Rat)
+	for _, share := range shares {
+		weighted, err := s.weighShippedEmissions(ctx, share)
+		if err != nil {
+			return err
+		}
+		total.Add(total, weighted)
+	}
+	amount := int(roundHalfUp(total).Int64())
+
+	sender, err := getTokenAccount(ctx, sellerMSPID)
+	if err != nil {
+		return err
+	}
+	if sender.Balance < amount {
+		amount = sender.Balance
+	}
+	if amount <= 0 {
+		return nil
+	}
+	recipient, err := getTokenAccount(ctx, clientMSPID)
+	if err != nil {
+		return err
+	}
+
+	sender.Balance -= amount
+	sender.Sent += amount
+	recipient.Balance += amount
+	recipient.Received += amount
+	err = putTokenAccount(ctx, sender)
+	if err != nil {
+		return err
+	}
+	err = putTokenAccount(ctx, recipient)
+	if err != nil {
+		return err
+	}
+	err = putTokenGoods(ctx, &tokenGoods{Amount: amount, Kind: TokenTransfer, Reference: shippingID})
+	if err != nil {
+		return err
+	}
+
+	_, err = putTokenTransaction(ctx, TokenTransaction{
+		Amount:    amount,
+		From:      sellerMSPID,
+		Kind:      TokenTransfer,
+		Reference: shippingID,
+		To:        clientMSPID,
+	})
+	return err
+}
+
+// RetireEmissionsTokens takes tokens of the invoking organization out of circulation when the final product is sold
+// The product must be a final product the invoking organization created in the asset transfer chaincode,
+// at most the footprint of the product is retired for it
+func (s *SmartContract) RetireEmissionsTokens(ctx contractapi.TransactionContextInterface, amount int, productID string) error {
+	err := verifyClientHasRole(ctx, RoleSubmitter)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive, got %d", amount)
+	}
+	if len(productID) == 0 {
+		return fmt.Errorf("productID must be a non-empty string")
+	}
+	product, err := getAssetFinalProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if product.ManufacturerMSPID != clientMSPID {
+		return fmt.Errorf("the final product %s was not created by organization %s", productID, clientMSPID)
+	}
+	goods, err := getTokenGoods(ctx, TokenRetire, productID)
+	if err != nil {
+		return err
+	}
+	if goods == nil {
+		goods = &tokenGoods{Kind: TokenRetire, Reference: productID}
+	}
+	if goods.Amount+amount > product.GHG {
+		return fmt.Errorf("the final product %s has a footprint of %d KgCO2e, %d tokens were already retired for it", productID, product.GHG, goods.Amount)
+	}
+
+	account, err := getTokenAccount(ctx, clientMSPID)
+	if err != nil {
+		return err
+	}
+	if account.Balance < amount {
+		return fmt.Errorf("insufficient tokens: organization %s holds %d, %d requested", clientMSPID, account.Balance, amount)
+	}
+	account.Balance -= amount
+	account.Retired += amount
+	err = putTokenAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+	goods.Amount += amount
+	err = putTokenGoods(ctx, goods)
+	if err != nil {
+		return err
+	}
+
+	_, err = putTokenTransaction(ctx, TokenTransaction{
+		Amount:    amount,
+		From:      clientMSPID,
+		Kind:      TokenRetire,
+		Reference: productID,
+	})
+	return err
+}
+
+// GetTokenAccount returns the token account of an organization, accounts of other organizations require the reader role
+func (s *SmartContract) GetTokenAccount(ctx contractapi.TransactionContextInterface, mspID string) (*TokenAccount, error) {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	if mspID != clientMSPID {
+		err = verifyClientHasRole(ctx, RoleReader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return getTokenAccount(ctx, mspID)
+}
+
+// GetTokenSupply returns the number of minted, burned, retired and circulating tokens of all organizations
+func (s *SmartContract) GetTokenSupply(ctx contractapi.TransactionContextInterface) (*TokenSupply, error) {
+	accounts, err := getAllTokenAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return calculateTokenSupply(accounts), nil
+}
+
+// GetTokenTransactions returns the token transactions of an organization in chronological order
+// Transactions of other organizations require the reader role
+func (s *SmartContract) GetTokenTransactions(ctx contractapi.TransactionContextInterface, mspID string) ([]*TokenTransaction, error) {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	if mspID != clientMSPID {
+		err = verifyClientHasRole(ctx, RoleReader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tokenTransactionByOrgObjectType, []string{mspID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	transactions := []*TokenTransaction{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		key, err := ctx.GetStub().CreateCompositeKey(tokenTransactionObjectType, []string{attributes[2]})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create composite key: %v", err)
+		}
+		transactionJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from ledger: %v", err)
+		}
+		if transactionJSON == nil {
+			return nil, fmt.Errorf("the token transaction %s does not exist", attributes[2])
+		}
+		var transaction TokenTransaction
+		err = json.Unmarshal(transactionJSON, &transaction)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, &transaction)
+	}
+
+	return transactions, nil
+}
+
+// GetTokenIssuance returns the tokens issued for an emissions record, any revision of the chain can be passed
+func (s *SmartContract) GetTokenIssuance(ctx contractapi.TransactionContextInterface, id string) (*TokenIssuance, error) {
+	record, err := s.GetEmissionsRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rootID := record.ID
+	if record.Amendment != nil {
+		rootID = record.Amendment.RootID
+	}
+	issuance, err := getTokenIssuance(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+	if issuance == nil {
+		return nil, fmt.Errorf("no tokens were issued for the emissions record with ID %s", id)
+	}
+	return issuance, nil
+}
+
+// ReconcileTokenAccounts checks that the tokens issued match the latest revisions of the audited records
+// and that the balance of every organization matches its minted, burned, transferred and retired tokens
+func (s *SmartContract) ReconcileTokenAccounts(ctx contractapi.TransactionContextInterface) (*TokenReconciliation, error) {
+	err := verifyClientHasRole(ctx, RoleReader)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := getAllTokenAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reconciliation := TokenReconciliation{
+		Accounts: accounts,
+		Issues:   []string{},
+		Supply:   calculateTokenSupply(accounts),
+	}
+
+	// Tokens issued per organization according to the audited records
+	issued := map[string]int{}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tokenIssuanceObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var issuance TokenIssuance
+		err = json.Unmarshal(queryResponse.Value, &issuance)
+		if err != nil {
+			return nil, err
+		}
+		issued[issuance.MSPID] += issuance.Amount
+
+		latest, err := s.GetEmissionsRecord(ctx, issuance.RootID)
+		if err != nil {
+			reconciliation.Issues = append(reconciliation.Issues, fmt.Sprintf("tokens were issued for the missing emissions record %s", issuance.RootID))
+			continue
+		}
+		if latest.ID != issuance.RecordID || latest.KgCO2 != issuance.Amount {
+			reconciliation.Issues = append(reconciliation.Issues, fmt.Sprintf("%d tokens were issued for revision %s of emissions record %s, the latest revision %s has %d KgCO2",
+				issuance.Amount, issuance.RecordID, issuance.RootID, latest.ID, latest.KgCO2))
+		}
+	}
+
+	sent, received := 0, 0
+	for _, account := range accounts {
+		sent += account.Sent
+		received += account.Received
+		if account.Minted-account.Burned != issued[account.MSPID] {
+			reconciliation.Issues = append(reconciliation.Issues, fmt.Sprintf("organization %s was minted %d net tokens, but %d were issued for its records",
+				account.MSPID, account.Minted-account.Burned, issued[account.MSPID]))
+		}
+		expected := account.Minted - account.Burned + account.Received - account.Sent - account.Retired
+		if account.Balance != expected {
+			reconciliation.Issues = append(reconciliation.Issues, fmt.Sprintf("organization %s holds %d tokens, %d expected from its transactions",
+				account.MSPID, account.Balance, expected))
+		}
+		if account.Balance < 0 {
+			reconciliation.Issues = append(reconciliation.Issues, fmt.Sprintf("organization %s has a negative balance", account.MSPID))
+		}
+		delete(issued, account.MSPID)
+	}
+	for mspID, amount := range issued {
+		if amount != 0 {
+			reconciliation.Issues = append(reconciliation.Issues, fmt.Sprintf("%d tokens were issued for records of organization %s, which has no token account", amount, mspID))
+		}
+	}
+	if sent != received {
+		reconciliation.Issues = append(reconciliation.Issues, fmt.Sprintf("%d tokens were sent, but %d received", sent, received))
+	}
+
+	reconciliation.Reconciled = len(reconciliation.Issues) == 0
+	return &reconciliation, nil
+}
+
+// HELPER FUNCTION mintEmissionsTokens issues tokens for the KgCO2 of a newly audited record to the organization of its owner
+func mintEmissionsTokens(ctx contractapi.TransactionContextInterface, mspID string, record *EmissionsRecord) error {
+	issuance := TokenIssuance{
+		Amount:   record.KgCO2,
+		MSPID:    mspID,
+		RecordID: record.ID,
+		RootID:   record.ID,
+	}
+	err := putTokenIssuance(ctx, &issuance)
+	if err != nil {
+		return err
+	}
+	return changeTokenBalance(ctx, mspID, record.ID, record.KgCO2)
+}
+
+// HELPER FUNCTION adjustEmissionsTokens updates the tokens issued for a revision chain to the KgCO2 of an approved revision
+// A decrease burns tokens, so the organization has to hold enough tokens for the correction
+// Records audited before the token ledger was introduced have no issuance, they are skipped
+func adjustEmissionsTokens(ctx contractapi.TransactionContextInterface, revision *EmissionsRecord) error {
+	issuance, err := getTokenIssuance(ctx, revision.Amendment.RootID)
+	if err != nil {
+		return err
+	}
+	if issuance == nil {
+		return nil
+	}
+
+	delta := revision.KgCO2 - issuance.Amount
+	issuance.Amount = revision.KgCO2
+	issuance.RecordID = revision.ID
+	err = putTokenIssuance(ctx, issuance)
+	if err != nil {
+		return err
+	}
+	if delta == 0 {
+		return nil
+	}
+	return changeTokenBalance(ctx, issuance.MSPID, revision.ID, delta)
+}
+
+// HELPER FUNCTION changeTokenBalance mints a positive or burns a negative amount of tokens for an emissions record
+func changeTokenBalance(ctx contractapi.TransactionContextInterface, mspID string, recordID string, amount int) error {
+	account, err := getTokenAccount(ctx, mspID)
+	if err != nil {
+		return err
+	}
+
+	transaction := TokenTransaction{RecordID: recordID}
+	if amount >= 0 {
+		account.Balance += amount
+		account.Minted += amount
+		transaction.Amount = amount
+		transaction.Kind = TokenMint
+		transaction.To = mspID
+	} else {
+		if account.Balance < -amount {
+			return fmt.Errorf("insufficient tokens: organization %s holds %d, %d have to be burned for the correction of %s",
+				mspID, account.Balance, -amount, recordID)
+		}
+		account.Balance += amount
+		account.Burned -= amount
+		transaction.Amount = -amount
+		transaction.Kind = TokenBurn
+		transaction.From = mspID
+	}
+
+	err = putTokenAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+	_, err = putTokenTransaction(ctx, transaction)
+	return err
+}
+
+// HELPER FUNCTION calculateTokenSupply sums up the token accounts of all organizations
+func calculateTokenSupply(accounts []*TokenAccount) *TokenSupply {
+	supply := TokenSupply{}
+	for _, account := range accounts {
+		supply.Burned += account.Burned
+		supply.Circulating += account.Balance
+		supply.Minted += account.Minted
+		supply.Retired += account.Retired
+	}
+	return &supply
+}
+
+// HELPER FUNCTION getTokenAccount reads the token account of an organization, organizations without tokens get an empty account
+func getTokenAccount(ctx contractapi.TransactionContextInterface, mspID string) (*TokenAccount, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenAccountObjectType, []string{mspID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	accountJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if accountJSON == nil {
+		return &TokenAccount{MSPID: mspID}, nil
+	}
+
+	var account TokenAccount
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// HELPER FUNCTION getAllTokenAccounts reads the token accounts of all organizations
+func getAllTokenAccounts(ctx contractapi.TransactionContextInterface) ([]*TokenAccount, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tokenAccountObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	accounts := []*TokenAccount{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var account TokenAccount
+		err = json.Unmarshal(queryResponse.Value, &account)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, &account)
+	}
+	return accounts, nil
+}
+
+// HELPER FUNCTION putTokenAccount writes the token account of an organization to the ledger
+func putTokenAccount(ctx contractapi.TransactionContextInterface, account *TokenAccount) error {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenAccountObjectType, []string{account.MSPID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, accountJSON)
+}
+
+// HELPER FUNCTION verifyInvokedByClaimShipping checks that the transaction proposal invokes ClaimShipping of the asset transfer chaincode,
+// so tokens only move with the claim of a shipping and never by invoking this chaincode directly
+func verifyInvokedByClaimShipping(ctx contractapi.TransactionContextInterface) error {
+	signedProposal, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return fmt.Errorf("failed to get signed proposal: %v", err)
+	}
+	var proposal peer.Proposal
+	err = proto.Unmarshal(signedProposal.GetProposalBytes(), &proposal)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal proposal: %v", err)
+	}
+	var payload peer.ChaincodeProposalPayload
+	err = proto.Unmarshal(proposal.GetPayload(), &payload)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal proposal payload: %v", err)
+	}
+	var invocation peer.ChaincodeInvocationSpec
+	err = proto.Unmarshal(payload.GetInput(), &invocation)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal chaincode invocation: %v", err)
+	}
+
+	chaincodeName := invocation.GetChaincodeSpec().GetChaincodeId().GetName()
+	args := invocation.GetChaincodeSpec().GetInput().GetArgs()
+	// The function may be prefixed with the name of the contract
+	function := ""
+	if len(args) > 0 {
+		function = string(args[0])
+		function = function[strings.LastIndex(function, ":")+1:]
+	}
+	if chaincodeName != assetsChaincodeName || function != "ClaimShipping" {
+		return fmt.Errorf("tokens can only be transferred by ClaimShipping of the %s chaincode", assetsChaincodeName)
+	}
+	return nil
+}
+
+// HELPER FUNCTION weighShippedEmissions returns the exact KgCO2e of the latest revision of a shipped emissions record weighted with its share
+func (s *SmartContract) weighShippedEmissions(ctx contractapi.TransactionContextInterface, share ShippedEmissionsShare) (*big.Rat, error) {
+	fraction, ok := new(big.Rat).SetString(share.Share)
+	if !ok || fraction.Sign() <= 0 || fraction.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("share %q of emissions record %s must be a fraction larger than 0 and at most 1", share.Share, share.ID)
+	}
+	record, err := s.GetEmissionsRecord(ctx, share.ID)
+	if err != nil {
+		return nil, err
+	}
+	co2e, err := recordCO2e(record)
+	if err != nil {
+		return nil, err
+	}
+	kgCO2e, err := co2e.ratIn(UnitKgCO2e)
+	if err != nil {
+		return nil, err
+	}
+	return fraction.Mul(fraction, kgCO2e), nil
+}
+
+// HELPER FUNCTION getAssetFinalProduct reads a final product with the footprint it was created with from the asset transfer chaincode
+func getAssetFinalProduct(ctx contractapi.TransactionContextInterface, productID string) (*assetFinalProduct, error) {
+	args := [][]byte{[]byte("ReadStoredFinalProduct"), []byte(productID)}
+	response := ctx.GetStub().InvokeChaincode(assetsChaincodeName, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to read final product from %s: %s", assetsChaincodeName, response.Message)
+	}
+
+	var product assetFinalProduct
+	err := json.Unmarshal(response.Payload, &product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// HELPER FUNCTION getTokenGoods reads the tokens moved for a shipping or final product, it returns nil if none were moved
+func getTokenGoods(ctx contractapi.TransactionContextInterface, kind string, reference string) (*tokenGoods, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenGoodsObjectType, []string{kind, reference})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	goodsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if goodsJSON == nil {
+		return nil, nil
+	}
+
+	var goods tokenGoods
+	err = json.Unmarshal(goodsJSON, &goods)
+	if err != nil {
+		return nil, err
+	}
+	return &goods, nil
+}
+
+// HELPER FUNCTION putTokenGoods writes the tokens moved for a shipping or final product to the ledger
+func putTokenGoods(ctx contractapi.TransactionContextInterface, goods *tokenGoods) error {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenGoodsObjectType, []string{goods.Kind, goods.Reference})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	goodsJSON, err := json.Marshal(goods)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, goodsJSON)
+}
+
+// HELPER FUNCTION getTokenIssuance reads the tokens issued for a revision chain, it returns nil if no tokens were issued
+func getTokenIssuance(ctx contractapi.TransactionContextInterface, rootID string) (*TokenIssuance, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenIssuanceObjectType, []string{rootID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	issuanceJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from ledger: %v", err)
+	}
+	if issuanceJSON == nil {
+		return nil, nil
+	}
+
+	var issuance TokenIssuance
+	err = json.Unmarshal(issuanceJSON, &issuance)
+	if err != nil {
+		return nil, err
+	}
+	return &issuance, nil
+}
+
+// HELPER FUNCTION putTokenIssuance writes the tokens issued for a revision chain to the ledger
+func putTokenIssuance(ctx contractapi.TransactionContextInterface, issuance *TokenIssuance) error {
+	key, err := ctx.GetStub().CreateCompositeKey(tokenIssuanceObjectType, []string{issuance.RootID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	issuanceJSON, err := json.Marshal(issuance)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, issuanceJSON)
+}
+
+// HELPER FUNCTION putTokenTransaction writes a token transaction under the ID of the Fabric transaction
+// and indexes it for every organization involved, so the history of an organization can be read in chronological order
+// A Fabric transaction contains at most one token transaction
+func putTokenTransaction(ctx contractapi.TransactionContextInterface, transaction TokenTransaction) (*TokenTransaction, error) {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transaction.Timestamp = txTime.Format(time.RFC3339)
+	transaction.TxID = ctx.GetStub().GetTxID()
+
+	key, err := ctx.GetStub().CreateCompositeKey(tokenTransactionObjectType, []string{transaction.TxID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	transactionJSON, err := json.Marshal(transaction)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(key, transactionJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mspID := range []string{transaction.From, transaction.To} {
+		if len(mspID) == 0 {
+			continue
+		}
+		indexKey, err := ctx.GetStub().CreateCompositeKey(tokenTransactionByOrgObjectType, []string{mspID, transaction.Timestamp, transaction.TxID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create composite key: %v", err)
+		}
+		// The index only needs the key, the value must not be empty to be stored
+		err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &transaction, nil
+}
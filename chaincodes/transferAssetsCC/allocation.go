@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Allocation methods of the GHG Protocol for processes with several products
+const (
+	AllocationMass     = "MASS"     // Shares follow the physical mass of the products
+	AllocationEconomic = "ECONOMIC" // Shares follow the economic value of the products
+	AllocationUnit     = "UNIT"     // Every produced piece bears the same share
+)
+
+// fullShare is the share of an emissions record that is referenced without allocation
+const fullShare = "1"
+
+// Allocation describes how the emissions of a manufacturing run are shared between the product of a recipe and its co-products and by-products
+type Allocation struct {
+	Method  string             `json:"method"`
+	Outputs []AllocationOutput `json:"outputs"` // All products of a run, including the product of the recipe
+}
+
+// AllocationOutput is the declared share of one product of a manufacturing run
+type AllocationOutput struct {
+	Product  string   `json:"product"`
+	Quantity Quantity `json:"quantity"`                                // Pieces of the product produced per run
+	Fraction string   `json:"fraction,omitempty" metadata:",optional"` // Share of the run allocated to each piece, e.g. "0.7" or "1/3". Derived from the pieces for UNIT
+}
+
+// EmissionsShare is a weighted reference to an emissions record
+type EmissionsShare struct {
+	ID    string `json:"emissionsID"`
+	Share string `json:"share"` // Exact fraction of the emissions record, e.g. "7/10"
+}
+
+// coProductInput is an asset created by a manufacturing run in addition to the product of the recipe
+type coProductInput struct {
+	Name string `json:"assetName"`
+	ID   string `json:"assetID"`
+}
+
+// parseAllocation checks the allocation rules of a recipe and stores the fractions in their canonical form
+// The fractions of all produced pieces must add up to exactly 100% of the run, so no emissions are lost or counted twice
+func parseAllocation(allocation *Allocation, product string) error {
+	if allocation.Method != AllocationMass && allocation.Method != AllocationEconomic && allocation.Method != AllocationUnit {
+		return fmt.Errorf("allocation method must be %v, %v or %v", AllocationMass, AllocationEconomic, AllocationUnit)
+	}
+	if len(allocation.Outputs) == 0 {
+		return fmt.Errorf("allocation outputs must be a non-empty list")
+	}
+
+	var err error
+	products := make(map[string]bool)
+	pieces := make([]int, len(allocation.Outputs))
+	totalPieces := 0
+	for i, output := range allocation.Outputs {
+		if len(output.Product) == 0 {
+			return fmt.Errorf("product of allocation output %v must be a non-empty string", i)
+		}
+		if products[output.Product] {
+			return fmt.Errorf("product %v is listed more than once in the allocation outputs", output.Product)
+		}
+		products[output.Product] = true
+
+		allocation.Outputs[i].Quantity, err = parseQuantity(output.Quantity)
+		if err != nil {
+			return fmt.Errorf("invalid quantity of product %v: %v", output.Product, err)
+		}
+		pieces[i], err = allocation.Outputs[i].Quantity.pieces()
+		if err != nil {
+			return fmt.Errorf("invalid quantity of product %v: %v", output.Product, err)
+		}
+		totalPieces += pieces[i]
+	}
+	if !products[product] {
+		return fmt.Errorf("the product %v of the recipe must be one of the allocation outputs", product)
+	}
+
+	total := new(big.Rat)
+	for i, output := range allocation.Outputs {
+		if allocation.Method == AllocationUnit {
+			unitShare := big.NewRat(1, int64(totalPieces))
+			if len(output.Fraction) > 0 {
+				fraction, err := parseShare(output.Fraction)
+				if err != nil {
+					return fmt.Errorf("invalid fraction of product %v: %v", output.Product, err)
+				}
+				if fraction.Cmp(unitShare) != 0 {
+					return fmt.Errorf("fraction of product %v must be %v for %v allocation", output.Product, unitShare.RatString(), AllocationUnit)
+				}
+			}
+			allocation.Outputs[i].Fraction = unitShare.RatString()
+		}
+
+		fraction, err := parseShare(allocation.Outputs[i].Fraction)
+		if err != nil {
+			return fmt.Errorf("invalid fraction of product %v: %v", output.Product, err)
+		}
+		allocation.Outputs[i].Fraction = fraction.RatString()
+		total.Add(total, new(big.Rat).Mul(fraction, big.NewRat(int64(pieces[i]), 1)))
+	}
+	if total.Cmp(big.NewRat(1, 1)) != 0 {
+		return fmt.Errorf("the fractions of all produced pieces add up to %v instead of 1", total.RatString())
+	}
+	return nil
+}
+
+// allocateEmissions checks that a manufacturing run produces exactly the products declared by the allocation rules of its recipe
+// and returns the weighted emissions references of every produced asset, together they add up to the emissions of the run
+func allocateEmissions(recipe *Recipe, outputs []coProductInput, runShares []EmissionsShare) ([][]EmissionsShare, error) {
+	if recipe.Allocation == nil {
+		if len(outputs) != 1 {
+			return nil, fmt.Errorf("the recipe %v has no allocation rules, it cannot produce co-products", recipe.ID)
+		}
+		return [][]EmissionsShare{runShares}, nil
+	}
+
+	fractions := make(map[string]*big.Rat)
+	declared := make(map[string]int)
+	for _, output := range recipe.Allocation.Outputs {
+		fraction, err := parseShare(output.Fraction)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fraction of product %v: %v", output.Product, err)
+		}
+		fractions[output.Product] = fraction
+		declared[output.Product], err = output.Quantity.pieces()
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity of product %v: %v", output.Product, err)
+		}
+	}
+
+	produced := make(map[string]int)
+	allocated := make([][]EmissionsShare, len(outputs))
+	for i, output := range outputs {
+		fraction, ok := fractions[output.Name]
+		if !ok {
+			return nil, fmt.Errorf("the product %v is not an output of the recipe %v", output.Name, recipe.ID)
+		}
+		produced[output.Name]++
+		allocated[i] = scaleShares(runShares, fraction)
+	}
+	for product, pieces := range declared {
+		if produced[product] != pieces {
+			return nil, fmt.Errorf("the recipe %v produces %v pieces of %v per run, got %v", recipe.ID, pieces, product, produced[product])
+		}
+	}
+	return allocated, nil
+}
+
+// getAssetShares returns the weighted emissions references of an asset
+// Assets received with a shipping only carry the emissions IDs, their shares are kept with the public asset
+func getAssetShares(ctx contractapi.TransactionContextInterface, asset *Asset) ([]EmissionsShare, error) {
+	shares := asset.EmissionsShares
+	if shares == nil {
+		publicAssetJSON, err := ctx.GetStub().GetState(asset.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read asset %v from world state: %v", asset.ID, err)
+		}
+		if publicAssetJSON != nil {
+			var publicAsset *PublicAsset
+			err = json.Unmarshal(publicAssetJSON, &publicAsset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+			}
+			shares = publicAsset.EmissionsShares
+		}
+	}
+
+	known := make(map[string]string)
+	for _, share := range shares {
+		known[share.ID] = share.Share
+	}
+	// Emissions IDs without a share, e.g. transport emissions added by CreateShipping, belong to the asset entirely
+	assetShares := []EmissionsShare{}
+	seen := make(map[string]bool)
+	for _, id := range asset.EmissionsIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		share, ok := known[id]
+		if !ok {
+			share = fullShare
+		}
+		assetShares = append(assetShares, EmissionsShare{ID: id, Share: share})
+	}
+	return mergeShares(assetShares)
+}
+
+// sharesOfIDs returns references to the whole emissions records with the given IDs
+func sharesOfIDs(ids []string) []EmissionsShare {
+	shares := []EmissionsShare{}
+	for _, id := range ids {
+		shares = append(shares, EmissionsShare{ID: id, Share: fullShare})
+	}
+	return shares
+}
+
+// mergeShares adds the shares of emissions records referenced more than once
+// Pieces created with the same record without allocation each reference it as a whole, so whole references of a record count once.
+// Partial shares are added to them, the shares of a record must not exceed the whole record
+func mergeShares(shares []EmissionsShare) ([]EmissionsShare, error) {
+	merged := []EmissionsShare{}
+	sums := make(map[string]*big.Rat)
+	whole := make(map[string]bool)
+	for _, share := range shares {
+		value, err := parseShare(share.Share)
+		if err != nil {
+			return nil, fmt.Errorf("invalid share of emissions record %v: %v", share.ID, err)
+		}
+		sum, ok := sums[share.ID]
+		if !ok {
+			sum = new(big.Rat)
+			sums[share.ID] = sum
+			merged = append(merged, EmissionsShare{ID: share.ID})
+		}
+		if value.Cmp(big.NewRat(1, 1)) == 0 {
+			whole[share.ID] = true
+		} else {
+			sum.Add(sum, value)
+		}
+	}
+	for i := range merged {
+		sum := sums[merged[i].ID]
+		if whole[merged[i].ID] {
+			sum.Add(sum, big.NewRat(1, 1))
+		}
+		if sum.Cmp(big.NewRat(1, 1)) > 0 {
+			return nil, fmt.Errorf("the shares of emissions record %v add up to %v, more than the whole record", merged[i].ID, sum.RatString())
+		}
+		merged[i].Share = sum.RatString()
+	}
+	return merged, nil
+}
+
+// scaleShares returns the shares multiplied by the fraction allocated to a product
+func scaleShares(shares []EmissionsShare, fraction *big.Rat) []EmissionsShare {
+	scaled := []EmissionsShare{}
+	for _, share := range shares {
+		value, _ := new(big.Rat).SetString(share.Share)
+		scaled = append(scaled, EmissionsShare{ID: share.ID, Share: value.Mul(value, fraction).RatString()})
+	}
+	return scaled
+}
+
+// partialShares returns the shares if at least one record is not referenced entirely, otherwise nil
+// Assets without allocation keep their previous JSON form
+func partialShares(shares []EmissionsShare) []EmissionsShare {
+	for _, share := range shares {
+		if share.Share != fullShare {
+			return shares
+		}
+	}
+	return nil
+}
+
+// parseShare reads a fraction given as decimal or ratio, e.g. "0.7" or "7/10", it must be larger than 0 and at most 1
+func parseShare(share string) (*big.Rat, error) {
+	value, ok := new(big.Rat).SetString(share)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a fraction", share)
+	}
+	if value.Sign() <= 0 || value.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("fraction %v must be larger than 0 and at most 1", share)
+	}
+	return value, nil
+}
+
+// sumEmissionsShares returns the KgCO2e of the given weighted references to emissions records, rounded half up
+func sumEmissionsShares(ctx contractapi.TransactionContextInterface, shares []EmissionsShare) (int, error) {
+	values, _, err := weighEmissionsShares(ctx, shares)
+	if err != nil {
+		return 0, err
+	}
+	total := new(big.Rat)
+	for _, value := range values {
+		total.Add(total, value)
+	}
+	return roundHalfUp(total), nil
+}
+
+// weighEmissionsShares returns the exact KgCO2e of every referenced emissions record weighted with its share, keyed by the ID of the original record,
+// and the ID of the original record of every referenced ID. Revisions of a record are one record, their shares are merged like those of a single ID
+func weighEmissionsShares(ctx contractapi.TransactionContextInterface, shares []EmissionsShare) (map[string]*big.Rat, map[string]string, error) {
+	merged, err := mergeShares(shares)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make(map[string]*big.Rat)
+	roots := make(map[string]string)
+	if len(merged) == 0 {
+		return values, roots, nil
+	}
+
+	ids := []string{}
+	for _, share := range merged {
+		ids = append(ids, share.ID)
+	}
+	records, err := getEmissionsRecords(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) != len(ids) {
+		return nil, nil, fmt.Errorf("expected %v emissions records from %v, got %v", len(ids), emissionsChaincodeName, len(records))
+	}
+	// Amended records are returned as their latest revision, which is matched by its own ID, the ID of the original record
+	// or the ID of the revision it supersedes
+	byID := make(map[string]*EmissionsRecord)
+	for _, record := range records {
+		byID[record.ID] = record
+		if record.Amendment != nil {
+			byID[record.Amendment.RootID] = record
+			byID[record.Amendment.Supersedes] = record
+		}
+	}
+	latest := make(map[string]*EmissionsRecord)
+	chainShares := []EmissionsShare{}
+	for _, share := range merged {
+		record, ok := byID[share.ID]
+		// Older revisions of longer revision chains are read one by one
+		if !ok {
+			record, err = getEmissionsRecord(ctx, share.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		rootID := record.ID
+		if record.Amendment != nil {
+			rootID = record.Amendment.RootID
+		}
+		roots[share.ID] = rootID
+		latest[rootID] = record
+		chainShares = append(chainShares, EmissionsShare{ID: rootID, Share: share.Share})
+	}
+	chainShares, err = mergeShares(chainShares)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, share := range chainShares {
+		kgCO2e, err := latest[share.ID].kgCO2e()
+		if err != nil {
+			return nil, nil, err
+		}
+		value, _ := new(big.Rat).SetString(share.Share)
+		values[share.ID] = value.Mul(value, kgCO2e)
+	}
+	return values, roots, nil
+}
+
+// roundHalfUp rounds a non-negative rational number to the nearest integer, halves are rounded up
+func roundHalfUp(value *big.Rat) int {
+	numerator := new(big.Int).Mul(value.Num(), big.NewInt(2))
+	numerator.Add(numerator, value.Denom())
+	denominator := new(big.Int).Mul(value.Denom(), big.NewInt(2))
+	return int(numerator.Quo(numerator, denominator).Int64())
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAllocation(t *testing.T) {
+	pcs := func(value string) Quantity { return Quantity{Unit: UnitPiece, Value: value} }
+	tests := []struct {
+		name       string
+		allocation Allocation
+		product    string
+		want       []string // Canonical fractions of the outputs
+		wantErr    bool
+	}{
+		{
+			name: "mass allocation",
+			allocation: Allocation{Method: AllocationMass, Outputs: []AllocationOutput{
+				{Product: "Cathode", Quantity: pcs("1"), Fraction: "0.7"},
+				{Product: "Slag", Quantity: pcs("3"), Fraction: "0.1"},
+			}},
+			product: "Cathode",
+			want:    []string{"7/10", "1/10"},
+		},
+		{
+			name: "economic allocation given as ratios",
+			allocation: Allocation{Method: AllocationEconomic, Outputs: []AllocationOutput{
+				{Product: "Cathode", Quantity: pcs("1"), Fraction: "2/3"},
+				{Product: "Slag", Quantity: pcs("1"), Fraction: "1/3"},
+			}},
+			product: "Cathode",
+			want:    []string{"2/3", "1/3"},
+		},
+		{
+			name: "unit allocation derives the fractions",
+			allocation: Allocation{Method: AllocationUnit, Outputs: []AllocationOutput{
+				{Product: "Cell", Quantity: pcs("2")},
+				{Product: "Scrap", Quantity: pcs("1")},
+			}},
+			product: "Cell",
+			want:    []string{"1/3", "1/3"},
+		},
+		{
+			name: "unit allocation rejects other fractions",
+			allocation: Allocation{Method: AllocationUnit, Outputs: []AllocationOutput{
+				{Product: "Cell", Quantity: pcs("2"), Fraction: "0.4"},
+				{Product: "Scrap", Quantity: pcs("1")},
+			}},
+			product: "Cell",
+			wantErr: true,
+		},
+		{
+			name: "fractions below 100%",
+			allocation: Allocation{Method: AllocationMass, Outputs: []AllocationOutput{
+				{Product: "Cathode", Quantity: pcs("1"), Fraction: "0.7"},
+				{Product: "Slag", Quantity: pcs("1"), Fraction: "0.2"},
+			}},
+			product: "Cathode",
+			wantErr: true,
+		},
+		{
+			name: "fractions above 100%",
+			allocation: Allocation{Method: AllocationMass, Outputs: []AllocationOutput{
+				{Product: "Cathode", Quantity: pcs("2"), Fraction: "0.5"},
+				{Product: "Slag", Quantity: pcs("1"), Fraction: "0.1"},
+			}},
+			product: "Cathode",
+			wantErr: true,
+		},
+		{
+			name: "product of the recipe missing",
+			allocation: Allocation{Method: AllocationMass, Outputs: []AllocationOutput{
+				{Product: "Slag", Quantity: pcs("1"), Fraction: "1"},
+			}},
+			product: "Cathode",
+			wantErr: true,
+		},
+		{
+			name: "product listed twice",
+			allocation: Allocation{Method: AllocationMass, Outputs: []AllocationOutput{
+				{Product: "Cathode", Quantity: pcs("1"), Fraction: "0.5"},
+				{Product: "Cathode", Quantity: pcs("1"), Fraction: "0.5"},
+			}},
+			product: "Cathode",
+			wantErr: true,
+		},
+		{
+			name: "fraction of a piece",
+			allocation: Allocation{Method: AllocationMass, Outputs: []AllocationOutput{
+				{Product: "Cathode", Quantity: pcs("0.5"), Fraction: "1"},
+			}},
+			product: "Cathode",
+			wantErr: true,
+		},
+		{
+			name:       "unknown method",
+			allocation: Allocation{Method: "VOLUME", Outputs: []AllocationOutput{{Product: "Cathode", Quantity: pcs("1"), Fraction: "1"}}},
+			product:    "Cathode",
+			wantErr:    true,
+		},
+		{
+			name:       "no outputs",
+			allocation: Allocation{Method: AllocationMass},
+			product:    "Cathode",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseAllocation(&tt.allocation, tt.product)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAllocation(%+v) succeeded, want error", tt.allocation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAllocation(%+v) failed: %v", tt.allocation, err)
+			}
+			got := []string{}
+			for _, output := range tt.allocation.Outputs {
+				got = append(got, output.Fraction)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAllocation fractions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeShares(t *testing.T) {
+	tests := []struct {
+		name    string
+		shares  []EmissionsShare
+		want    []EmissionsShare
+		wantErr bool
+	}{
+		{
+			name:   "no shares",
+			shares: []EmissionsShare{},
+			want:   []EmissionsShare{},
+		},
+		{
+			name:   "distinct records keep their order",
+			shares: []EmissionsShare{{ID: "E2", Share: "1"}, {ID: "E1", Share: "0.3"}},
+			want:   []EmissionsShare{{ID: "E2", Share: "1"}, {ID: "E1", Share: "3/10"}},
+		},
+		{
+			name:   "shares of the same record are added",
+			shares: []EmissionsShare{{ID: "E1", Share: "1/3"}, {ID: "E2", Share: "1"}, {ID: "E1", Share: "1/6"}},
+			want:   []EmissionsShare{{ID: "E1", Share: "1/2"}, {ID: "E2", Share: "1"}},
+		},
+		{
+			name:   "whole references of a record count once",
+			shares: []EmissionsShare{{ID: "E1", Share: "1"}, {ID: "E2", Share: "1/2"}, {ID: "E1", Share: "1"}},
+			want:   []EmissionsShare{{ID: "E1", Share: "1"}, {ID: "E2", Share: "1/2"}},
+		},
+		{
+			name:   "partial shares add up to the whole record",
+			shares: []EmissionsShare{{ID: "E1", Share: "7/10"}, {ID: "E1", Share: "0.3"}},
+			want:   []EmissionsShare{{ID: "E1", Share: "1"}},
+		},
+		{
+			name:    "partial shares exceed the whole record",
+			shares:  []EmissionsShare{{ID: "E1", Share: "7/10"}, {ID: "E1", Share: "7/10"}},
+			wantErr: true,
+		},
+		{
+			name:    "whole reference and partial share",
+			shares:  []EmissionsShare{{ID: "E1", Share: "1"}, {ID: "E1", Share: "1"}, {ID: "E1", Share: "0.5"}},
+			wantErr: true,
+		},
+		{
+			name:    "zero share",
+			shares:  []EmissionsShare{{ID: "E1", Share: "0"}},
+			wantErr: true,
+		},
+		{
+			name:    "share above one",
+			shares:  []EmissionsShare{{ID: "E1", Share: "3/2"}},
+			wantErr: true,
+		},
+		{
+			name:    "share that is no fraction",
+			shares:  []EmissionsShare{{ID: "E1", Share: "half"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeShares(tt.shares)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("mergeShares(%v) = %v, want error", tt.shares, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeShares(%v) failed: %v", tt.shares, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeShares(%v) = %v, want %v", tt.shares, got, tt.want)
+			}
+		})
+	}
+}
@@ -30,11 +30,12 @@ type ShippingPublic struct {
 
 type ShippingPrivate struct {
 	ID 			string `json:"shippingID"`
-	Quantity 	int `json:"quantity"`
+	Quantity 	Quantity `json:"quantity"` // Number of shipped assets in pieces
 	List_ID 	[]string `json:"list_ID"`
 	Name		string `json:"assetName"`
 	Date 		string `json:"date"`
 	EmissionsIDs [][]string `json:"emissionsIDs"`
+	Origins		[][]MaterialOrigin `json:"origins,omitempty" metadata:",optional"` // Origin summaries of the shipped assets, set if one of them has a mine origin
 }
 
 type Asset struct {
@@ -42,26 +43,34 @@ type Asset struct {
 	ID 				string `json:"assetID"`
 	EmissionsIDs 	[]string `json:"emissionsIDs"`
 	Dir 			string `json:"Direction"`
+	FacilityID		string `json:"facilityID,omitempty" metadata:",optional"` // Facility registered in the emissions audit chaincode the asset was produced at
+	EmissionsShares	[]EmissionsShare `json:"emissionsShares,omitempty" metadata:",optional"` // Set if the asset bears only a share of some emissions records, e.g. co-products
+	Origins			[]MaterialOrigin `json:"origins,omitempty" metadata:",optional"` // Origin of the raw materials of all mine inputs of the asset
 }
 
 type PublicAsset struct {
 	ID 				string `json:"assetID"`
 	EmissionsIDs 	[]string `json:"emissionsIDs"`
 	BasedOn			[]string `json:"BasedOn"`
+	EmissionsShares	[]EmissionsShare `json:"emissionsShares,omitempty" metadata:",optional"` // Set if the asset bears only a share of some emissions records, e.g. co-products
 }
 
 type FinalAsset struct {
 	ID 				string `json:"assetID"`
 	EmissionsIDs 	[]string `json:"emissionsIDs"`
-	GHG			 	int `json:"GHG"`
+	GHG			 	int `json:"GHG"` // Cradle-to-gate footprint in KgCO2e of all emissions records of the lineage
 	BasedOn			[]string `json:"BasedOn"`
+	EmissionsShares	[]EmissionsShare `json:"emissionsShares,omitempty" metadata:",optional"` // Set if the product bears only a share of some emissions records
+	Stages			[]*FootprintStage `json:"stages"` // Footprint added at the product itself and at every asset of its lineage
+	ManufacturerMSPID	string `json:"manufacturerMSPID,omitempty" metadata:",optional"` // Organization that created the final product, older products without it cannot get a battery passport
 }
 
 type Recipe struct {
 	ID 			string `json:"recipeID"`
 	Product		string `json:"product"`
 	Ingredients []string `json:"ingredients"`
-	Quantity 	[]int `json:"quantity"`
+	Quantity 	[]Quantity `json:"quantity"` // Pieces of each ingredient, plain integers of older recipes are read as pieces
+	Allocation	*Allocation `json:"allocation,omitempty" metadata:",optional"` // Shares of the product and its co-products, the product bears all emissions if not set
 }
 
 type DeletionShippingList struct {
@@ -235,6 +244,8 @@ func (s *SmartContract) CreateAssetIn(ctx contractapi.TransactionContextInterfac
 		Name 	string `json:"assetName"`
 		ID 		string `json:"assetID"`
 		EmissionsIDs []string `json:"emissionsIDs"`
+		FacilityID	string `json:"facilityID"`
+		Origin		*MineOrigin `json:"origin"` // Origin and due diligence of the mine, kept private
 	}
 
 	var assetInput assetTransient
@@ -351,6 +362,31 @@ func (s *SmartContract) CreateAssetIn(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("this asset already exists: " + assetInput.ID)
 	}
 
+	//check that the facility belongs to the org
+	if len(assetInput.FacilityID) > 0 {
+		err = verifyFacility(ctx, assetInput.FacilityID)
+		if err != nil {
+			return err
+		}
+	}
+
+	//check that the emissions records passed the audit and belong to the org
+	err = verifyOwnedEmissions(ctx, assetInput.EmissionsIDs)
+	if err != nil {
+		return err
+	}
+
+	//check the origin of the mine, only its summary is passed on with the asset
+	var origins []MaterialOrigin
+	if assetInput.Origin != nil {
+		assetInput.Origin.AssetID = assetInput.ID
+		err = parseMineOrigin(assetInput.Origin)
+		if err != nil {
+			return fmt.Errorf("invalid origin: %v", err)
+		}
+		origins = summarizeOrigin(assetInput.Origin)
+	}
+
 	//create the public asset for tracking
 	publicAsset := PublicAsset{
 		ID: 			assetInput.ID,
@@ -375,6 +411,8 @@ func (s *SmartContract) CreateAssetIn(ctx contractapi.TransactionContextInterfac
 		ID:    	assetInput.ID,
 		EmissionsIDs: 	assetInput.EmissionsIDs,
 		Dir: 	"in",
+		FacilityID: 	assetInput.FacilityID,
+		Origins: 	origins,
 	}
 	assetJSONasBytes, err := json.Marshal(asset)
 	if err != nil {
@@ -388,6 +426,13 @@ func (s *SmartContract) CreateAssetIn(ctx contractapi.TransactionContextInterfac
 	if err != nil {
 		return fmt.Errorf("failed to put asset into private data collecton: %v", err)
 	}
+
+	if assetInput.Origin != nil {
+		err = putOrgOriginRecord(ctx, orgCollection, mineOriginObjectType, assetInput.ID, assetInput.Origin)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -417,8 +462,9 @@ func (s *SmartContract) CreateRecipe(ctx contractapi.TransactionContextInterface
 		ID 			string 	`json:"recipeID"`
 		Product		string 	`json:"Product"`
 		Ingredients []string `json:"Ingredients"`
-		Quantity 	[]int `json:"Quantity"`
+		Quantity 	[]Quantity `json:"Quantity"`
 		Collection 	string `json:"Collection"`
+		Allocation	*Allocation `json:"Allocation"`
 	}
 
 	var recipeInput recipeTransient
@@ -442,6 +488,23 @@ func (s *SmartContract) CreateRecipe(ctx contractapi.TransactionContextInterface
 	if len(recipeInput.Quantity) != len(recipeInput.Ingredients){
 		return fmt.Errorf("Lists parameters must have the same length")
 	}
+	for i, quantity := range recipeInput.Quantity{
+		recipeInput.Quantity[i], err = parseQuantity(quantity)
+		if err != nil {
+			return fmt.Errorf("invalid quantity of ingredient %v: %v", recipeInput.Ingredients[i], err)
+		}
+		// Assets are counted individually, so ingredients can only be given in whole pieces
+		_, err = recipeInput.Quantity[i].pieces()
+		if err != nil {
+			return fmt.Errorf("invalid quantity of ingredient %v: %v", recipeInput.Ingredients[i], err)
+		}
+	}
+	if recipeInput.Allocation != nil {
+		err = parseAllocation(recipeInput.Allocation, recipeInput.Product)
+		if err != nil {
+			return fmt.Errorf("invalid allocation rules: %v", err)
+		}
+	}
 
 	// Get ID of submitting client identity
 	clientID, err := submittingClientIdentity(ctx)
@@ -520,6 +583,7 @@ func (s *SmartContract) CreateRecipe(ctx contractapi.TransactionContextInterface
 		Product:		recipeInput.Product,
 		Ingredients: 	recipeInput.Ingredients,
 		Quantity: 		recipeInput.Quantity,
+		Allocation: 	recipeInput.Allocation,
 	}
 	recipeJSONasBytes, err := json.Marshal(recipe)
 	if err != nil {
@@ -563,6 +627,8 @@ func (s *SmartContract) ManufactureAsset(ctx contractapi.TransactionContextInter
 		ID 			string `json:"assetID"`
 		EmissionsIDs []string `json:"emissionsIDs"`
 		Assets  	[]string `json:"assets"`
+		FacilityID	string `json:"facilityID"`
+		CoProducts	[]coProductInput `json:"coProducts"` // Only for recipes with allocation rules
 	}
 
 	//get data and check it 
@@ -653,6 +719,42 @@ func (s *SmartContract) ManufactureAsset(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("this asset already exists: " + dataInput.ID)
 	}
 
+	//check the co-products, all products of the run are created together
+	outputs := append([]coProductInput{{Name: dataInput.Name, ID: dataInput.ID}}, dataInput.CoProducts...)
+	outputIDs := make(map[string]bool)
+	for _, output := range outputs{
+		if len(output.Name) == 0 || len(output.ID) == 0 {
+			return fmt.Errorf("assetName and assetID of the co-products must be non-empty strings")
+		}
+		if output.ID == "RIGHTS" {
+			return fmt.Errorf("not allowed to set ID to RIGHTS")
+		}
+		if outputIDs[output.ID] {
+			return fmt.Errorf("the assetID %v is used more than once", output.ID)
+		}
+		outputIDs[output.ID] = true
+		assetAsBytes, err := ctx.GetStub().GetState(output.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get asset: %v", err)
+		} else if assetAsBytes != nil {
+			return fmt.Errorf("this asset already exists: " + output.ID)
+		}
+	}
+
+	//check that the facility belongs to the org
+	if len(dataInput.FacilityID) > 0 {
+		err = verifyFacility(ctx, dataInput.FacilityID)
+		if err != nil {
+			return err
+		}
+	}
+
+	//check that the emissions records passed the audit and belong to the org
+	err = verifyOwnedEmissions(ctx, dataInput.EmissionsIDs)
+	if err != nil {
+		return err
+	}
+
 	// Get Recipe
 	var recipe *Recipe
 	recipeDetailsJSON, err := ctx.GetStub().GetPrivateData(orgCollection, dataInput.RecipeID)
@@ -681,6 +783,8 @@ func (s *SmartContract) ManufactureAsset(ctx contractapi.TransactionContextInter
 	var count map[string]int
 	count = make(map[string]int)
 	var total_emissionsIDs []string 
+	var run_shares []EmissionsShare
+	var total_origins []MaterialOrigin
 	for _, s := range dataInput.Assets{
 		//get asset info
 		var asset *Asset
@@ -699,6 +803,14 @@ func (s *SmartContract) ManufactureAsset(ctx contractapi.TransactionContextInter
 		count[asset.Name] = x+1
 
 		total_emissionsIDs = append(total_emissionsIDs, asset.EmissionsIDs...) // Check if that is properly working
+
+		//inputs that are co-products only carry a share of their emissions
+		asset_shares, err := getAssetShares(ctx, asset)
+		if err != nil {
+			return err
+		}
+		run_shares = append(run_shares, asset_shares...)
+		total_origins = append(total_origins, asset.Origins...)
 	}	
 	
 	//check if ingredients match the recipe 
@@ -706,10 +818,18 @@ func (s *SmartContract) ManufactureAsset(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("Number of ingredients does not match recipe")
 	} 
 
+	pieces := make([]int, len(recipe.Quantity))
+	for j, quantity := range recipe.Quantity{
+		pieces[j], err = quantity.pieces()
+		if err != nil {
+			return fmt.Errorf("invalid quantity of ingredient %v: %v", recipe.Ingredients[j], err)
+		}
+	}
+
 	i := 0
 	for k, v  := range count{
 		for j, ingredient := range recipe.Ingredients{
-			if (k == ingredient) && (v==recipe.Quantity[j]){
+			if (k == ingredient) && (v==pieces[j]){
 				i++
 				break
 			}
@@ -720,6 +840,16 @@ func (s *SmartContract) ManufactureAsset(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("The number of correct ingredients is not provided")
 	}
 
+	//share the emissions of the run between the product and its co-products according to the recipe
+	run_shares, err = mergeShares(append(run_shares, sharesOfIDs(dataInput.EmissionsIDs)...))
+	if err != nil {
+		return err
+	}
+	allocated_shares, err := allocateEmissions(recipe, outputs, run_shares)
+	if err != nil {
+		return err
+	}
+
 	//All necessary checks have been carried out. Item can be created. Used assets are deleted
 	//delete used assets
 	for _, s := range dataInput.Assets{
@@ -729,43 +859,52 @@ func (s *SmartContract) ManufactureAsset(ctx contractapi.TransactionContextInter
 		}
 	}
 
-	//Create the public asset
-	publicAsset := PublicAsset{
-		ID:    			dataInput.ID,
-		EmissionsIDs: 	append(total_emissionsIDs, dataInput.EmissionsIDs...),
-		BasedOn: 		dataInput.Assets,
-	}
-	publicAssetJSONasBytes, err := json.Marshal(publicAsset)
+	output_emissionsIDs := append(total_emissionsIDs, dataInput.EmissionsIDs...)
+	output_origins, err := mergeOrigins(total_origins)
 	if err != nil {
-		return fmt.Errorf("failed to marshal asset_out into JSON: %v", err)
+		return err
 	}
+	for j, output := range outputs{
+		//Create the public asset
+		publicAsset := PublicAsset{
+			ID:    			output.ID,
+			EmissionsIDs: 	output_emissionsIDs,
+			BasedOn: 		dataInput.Assets,
+			EmissionsShares: partialShares(allocated_shares[j]),
+		}
+		publicAssetJSONasBytes, err := json.Marshal(publicAsset)
+		if err != nil {
+			return fmt.Errorf("failed to marshal asset_out into JSON: %v", err)
+		}
 
-	log.Printf("CreateAsset Put PublicAsset: ID %v", dataInput.ID)
-
-	err = ctx.GetStub().PutState(dataInput.ID, publicAssetJSONasBytes)
-	if err != nil {
-		return fmt.Errorf("failed to put asset onto world state: %v", err)
-	}
-	
+		log.Printf("CreateAsset Put PublicAsset: ID %v", output.ID)
 
+		err = ctx.GetStub().PutState(output.ID, publicAssetJSONasBytes)
+		if err != nil {
+			return fmt.Errorf("failed to put asset onto world state: %v", err)
+		}
 
-	// Mark Asset as outgoing
-	asset_out := Asset{
-		Name:  	dataInput.Name,
-		ID:    	dataInput.ID,
-		EmissionsIDs: 	append(total_emissionsIDs, dataInput.EmissionsIDs...),
-		Dir: 	"out",
-	}
-	assetJSONasBytes, err := json.Marshal(asset_out)
-	if err != nil {
-		return fmt.Errorf("failed to marshal asset_out into JSON: %v", err)
-	}
+		// Mark Asset as outgoing
+		asset_out := Asset{
+			Name:  	output.Name,
+			ID:    	output.ID,
+			EmissionsIDs: 	output_emissionsIDs,
+			Dir: 	"out",
+			FacilityID: 	dataInput.FacilityID,
+			EmissionsShares: partialShares(allocated_shares[j]),
+			Origins: 	output_origins,
+		}
+		assetJSONasBytes, err := json.Marshal(asset_out)
+		if err != nil {
+			return fmt.Errorf("failed to marshal asset_out into JSON: %v", err)
+		}
 
-	log.Printf("CreateAsset Put: collection %v, ID %v", orgCollection, dataInput.ID)
+		log.Printf("CreateAsset Put: collection %v, ID %v", orgCollection, output.ID)
 
-	err = ctx.GetStub().PutPrivateData(orgCollection, dataInput.ID, assetJSONasBytes)
-	if err != nil {
-		return fmt.Errorf("failed to put asset into private data collecton: %v", err)
+		err = ctx.GetStub().PutPrivateData(orgCollection, output.ID, assetJSONasBytes)
+		if err != nil {
+			return fmt.Errorf("failed to put asset into private data collecton: %v", err)
+		}
 	}
 	return nil
 }
@@ -837,6 +976,12 @@ func (s *SmartContract) FinalProduct(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("CreateAsset cannot be performed: Error %v", err)
 	}
 
+	//check that the emissions records passed the audit and belong to the org
+	err = verifyOwnedEmissions(ctx, dataInput.EmissionsIDs)
+	if err != nil {
+		return err
+	}
+
 	//get Owner Private Collection
 	orgCollection, err := getCollectionName(ctx) // get owner collection from caller identity
 	if err != nil {
@@ -952,11 +1097,18 @@ func (s *SmartContract) FinalProduct(ctx contractapi.TransactionContextInterface
 	if recipe.Product != dataInput.Name{
 		return fmt.Errorf("The name of the new product does not match the recipe")
 	}
+
+	//final products bear all emissions of their inputs
+	if recipe.Allocation != nil{
+		return fmt.Errorf("Final products cannot have co-products, use a recipe without allocation rules")
+	}
 	
 	//check if the Assets exist and if the quanitity and ingredients match
 	var count map[string]int
 	count = make(map[string]int)
 	var total_emissionsIDs []string
+	var run_shares []EmissionsShare
+	var total_origins []MaterialOrigin
 	for _, s := range dataInput.Assets{
 		//get asset info
 		var asset *Asset
@@ -975,6 +1127,14 @@ func (s *SmartContract) FinalProduct(ctx contractapi.TransactionContextInterface
 		count[asset.Name] = x+1
 
 		total_emissionsIDs = append(total_emissionsIDs, asset.EmissionsIDs...)
+
+		//inputs that are co-products only carry a share of their emissions
+		asset_shares, err := getAssetShares(ctx, asset)
+		if err != nil {
+			return err
+		}
+		run_shares = append(run_shares, asset_shares...)
+		total_origins = append(total_origins, asset.Origins...)
 	}	
 	
 	//check if ingredients match the recipe 
@@ -982,10 +1142,18 @@ func (s *SmartContract) FinalProduct(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("Number of ingredients does not match recipe")
 	} 
 
+	pieces := make([]int, len(recipe.Quantity))
+	for j, quantity := range recipe.Quantity{
+		pieces[j], err = quantity.pieces()
+		if err != nil {
+			return fmt.Errorf("invalid quantity of ingredient %v: %v", recipe.Ingredients[j], err)
+		}
+	}
+
 	i := 0
 	for k, v  := range count{
 		for j, ingredient := range recipe.Ingredients{
-			if (k == ingredient) && (v==recipe.Quantity[j]){
+			if (k == ingredient) && (v==pieces[j]){
 				i++
 				break
 			}
@@ -1005,23 +1173,53 @@ func (s *SmartContract) FinalProduct(ctx contractapi.TransactionContextInterface
 		}
 	}
 
+	run_shares, err = mergeShares(append(run_shares, sharesOfIDs(dataInput.EmissionsIDs)...))
+	if err != nil {
+		return err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+
 	// Mark Asset as finished
-	publicAsset := PublicAsset{
+	finalAsset := FinalAsset{
 		ID:    			dataInput.ID,
+		ManufacturerMSPID: clientMSPID,
 		EmissionsIDs: 	append(total_emissionsIDs, dataInput.EmissionsIDs...),
 		BasedOn: 		dataInput.Assets,
+		EmissionsShares: partialShares(run_shares),
 	}
-	publicAssetJSONasBytes, err := json.Marshal(publicAsset)
+
+	//sum up the emissions of the whole lineage
+	err = resolveFootprint(ctx, &finalAsset)
+	if err != nil {
+		return err
+	}
+	publicAssetJSONasBytes, err := json.Marshal(finalAsset)
 	if err != nil {
 		return fmt.Errorf("failed to marshal asset_out into JSON: %v", err)
 	}
 
-	log.Printf("CreateAsset Put: World Stage ID %v",dataInput.ID)
+	log.Printf("CreateAsset Put: World Stage ID %v, GHG %v",dataInput.ID, finalAsset.GHG)
 
 	err = ctx.GetStub().PutState(dataInput.ID, publicAssetJSONasBytes)
 	if err != nil {
 		return fmt.Errorf("failed to put asset onto world stage: %v", err)
 	}
+
+	//keep the origin of the raw materials for the OEM, the inputs are deleted
+	product_origins, err := mergeOrigins(total_origins)
+	if err != nil {
+		return err
+	}
+	if product_origins != nil {
+		err = putOrgOriginRecord(ctx, orgCollection, productOriginObjectType, dataInput.ID, product_origins)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -1049,7 +1247,7 @@ func (s *SmartContract) CreateShipping(ctx contractapi.TransactionContextInterfa
 	
 	type shippingTransient struct {
 		ID 			string `json:"shippingID"`
-		Quantity 	int `json:"quantity"`
+		Quantity 	Quantity `json:"quantity"`
 		List_ID 	[]string `json:"list_ID"`
 		Name 		string `json:"assetName"`
 		Date 		string `json:"date"`
@@ -1065,8 +1263,14 @@ func (s *SmartContract) CreateShipping(ctx contractapi.TransactionContextInterfa
 	if len(shippingInput.ID) == 0 {
 		return fmt.Errorf("ShippingID field must be a non-empty string")
 	}
-	if shippingInput.Quantity <= 0 {
-		return fmt.Errorf("Quantity field must be a non-empty, positive integer")
+	// The quantity is stored in its canonical form, so the buyer's claim hashes to the same value
+	shippingInput.Quantity, err = parseQuantity(shippingInput.Quantity)
+	if err != nil {
+		return fmt.Errorf("invalid quantity: %v", err)
+	}
+	shippedPieces, err := shippingInput.Quantity.pieces()
+	if err != nil {
+		return fmt.Errorf("invalid quantity: %v", err)
 	}
 	if len(shippingInput.List_ID) == 0 {
 		return fmt.Errorf("List_ID slice must be non-empty")
@@ -1095,6 +1299,12 @@ func (s *SmartContract) CreateShipping(ctx contractapi.TransactionContextInterfa
 		return fmt.Errorf("CreateAsset cannot be performed: Error %v", err)
 	}
 
+	//check that the emissions records passed the audit and belong to the org
+	err = verifyOwnedEmissions(ctx, shippingInput.ShippedEmissionsIDs)
+	if err != nil {
+		return err
+	}
+
 	//get Owner Private Collection
 	orgCollection, err := getCollectionName(ctx) // get owner collection from caller identity
 	if err != nil {
@@ -1185,6 +1395,8 @@ func (s *SmartContract) CreateShipping(ctx contractapi.TransactionContextInterfa
 	//check if the Assets all have the same Name 
 	var_name := "name"
 	var total_EmissionsIDs [][]string
+	var total_Origins [][]MaterialOrigin
+	has_Origins := false
 	for i, s := range shippingInput.List_ID{
 		//get asset info
 		var asset *Asset
@@ -1210,10 +1422,14 @@ func (s *SmartContract) CreateShipping(ctx contractapi.TransactionContextInterfa
 			return fmt.Errorf("Asset %v is not meant to be shipped out", s)
 		}
 		total_EmissionsIDs = append(total_EmissionsIDs, asset.EmissionsIDs)
+		total_Origins = append(total_Origins, asset.Origins)
+		if asset.Origins != nil{
+			has_Origins = true
+		}
 	}	
 
 	//check if the List_ID matches the quantity
-	if len(shippingInput.List_ID) != shippingInput.Quantity{
+	if len(shippingInput.List_ID) != shippedPieces{
 		return fmt.Errorf("Number of Asset IDs in List_ID must match Quantity")
 	}
 
@@ -1231,6 +1447,10 @@ func (s *SmartContract) CreateShipping(ctx contractapi.TransactionContextInterfa
 	for i, s := range total_EmissionsIDs{
 		s = append(s, shippingInput.ShippedEmissionsIDs[i])
 	}
+	//shippings without mine origins keep their previous form, so they are claimed as before
+	if !has_Origins{
+		total_Origins = nil
+	}
 	// Create the Private Shipping struct
 	shippingPrivate := ShippingPrivate{
 		ID:    		shippingInput.ID,
@@ -1239,6 +1459,7 @@ func (s *SmartContract) CreateShipping(ctx contractapi.TransactionContextInterfa
 		Name: 		shippingInput.Name, 
 		Date: 		shippingInput.Date,
 		EmissionsIDs: total_EmissionsIDs,
+		Origins: 	total_Origins,
 	}
 	shippingPrivateJSONasBytes, err := json.Marshal(shippingPrivate)
 	if err != nil {
@@ -1303,11 +1524,12 @@ func (s *SmartContract) ClaimShipping(ctx contractapi.TransactionContextInterfac
 	
 	type shippingTransient struct {
 		ID 			string `json:"shippingID"`
-		Quantity 	int `json:"quantity"`
+		Quantity 	Quantity `json:"quantity"`
 		List_ID 	[]string `json:"list_ID"`
 		Name		string `json:"assetName"`
 		Date 		string `json:"date"`
 		EmissionsIDs [][]string `json:"emissionsIDs"`
+		Origins		[][]MaterialOrigin `json:"origins,omitempty"` // Must be passed as stored by the seller, it is part of the hash
 	}
 
 	//get data and check it 
@@ -1319,8 +1541,10 @@ func (s *SmartContract) ClaimShipping(ctx contractapi.TransactionContextInterfac
 	if len(shippingInput.ID) == 0 {
 		return fmt.Errorf("ShippingID field must be a non-empty string")
 	}
-	if shippingInput.Quantity <= 0 {
-		return fmt.Errorf("Quantity field must be a non-empty, positive integer")
+	// The seller stored the quantity in its canonical form, so it has to be hashed in the same form
+	shippingInput.Quantity, err = parseQuantity(shippingInput.Quantity)
+	if err != nil {
+		return fmt.Errorf("invalid quantity: %v", err)
 	}
 	if len(shippingInput.List_ID) == 0 {
 		return fmt.Errorf("List_ID slice must be non-empty")
@@ -1334,6 +1558,9 @@ func (s *SmartContract) ClaimShipping(ctx contractapi.TransactionContextInterfac
 	if len(shippingInput.EmissionsIDs) <= 0 {
 		return fmt.Errorf("EmissionsID List must be a non-empty list")
 	}
+	if len(shippingInput.Origins) > 0 && len(shippingInput.Origins) != len(shippingInput.List_ID) {
+		return fmt.Errorf("Origins must be given for every asset of List_ID")
+	}
 
 	// Get ID of submitting client identity
 	clientID, err := submittingClientIdentity(ctx)
@@ -1465,6 +1692,35 @@ func (s *SmartContract) ClaimShipping(ctx contractapi.TransactionContextInterfac
 	sha := sha256.Sum256(shippingJsonAsBytes)
 	buyer_hash := hex.EncodeToString(sha[:])
 
+	// Shippings created before quantities had a unit stored the number of pieces as plain integer and have no origins,
+	// their hash is compared in that form. They can be claimed as before, a migration is not needed
+	pieces, isPieces := shippingInput.Quantity.legacyPieces()
+	if buyer_hash != seller_hash && isPieces && len(shippingInput.Origins) == 0 {
+		legacyShipping := struct {
+			ID 			string `json:"shippingID"`
+			Quantity 	int `json:"quantity"`
+			List_ID 	[]string `json:"list_ID"`
+			Name		string `json:"assetName"`
+			Date 		string `json:"date"`
+			EmissionsIDs [][]string `json:"emissionsIDs"`
+		}{
+			ID: 			shippingInput.ID,
+			Quantity: 		pieces,
+			List_ID: 		shippingInput.List_ID,
+			Name: 			shippingInput.Name,
+			Date: 			shippingInput.Date,
+			EmissionsIDs: 	shippingInput.EmissionsIDs,
+		}
+		legacyJsonAsBytes, err := json.Marshal(legacyShipping)
+		if err != nil{
+			return fmt.Errorf("Failed to marshal legacy shipping: %v", err)
+		}
+		legacySha := sha256.Sum256(legacyJsonAsBytes)
+		if hex.EncodeToString(legacySha[:]) == seller_hash {
+			buyer_hash = seller_hash
+		}
+	}
+
 	// Verify that the two hashes match if not create flag
 	if buyer_hash != seller_hash {
 		//Find ID for the flag
@@ -1500,6 +1756,24 @@ func (s *SmartContract) ClaimShipping(ctx contractapi.TransactionContextInterfac
 		return nil
 	}
 	
+	//the buyer takes over the emissions tokens of the shipped assets from the seller
+	var shipped_shares []EmissionsShare
+	for i, IDS := range shippingInput.List_ID{
+		asset_shares, err := getAssetShares(ctx, &Asset{ID: IDS, EmissionsIDs: shippingInput.EmissionsIDs[i]})
+		if err != nil {
+			return err
+		}
+		shipped_shares = append(shipped_shares, asset_shares...)
+	}
+	shipped_shares, err = mergeShares(shipped_shares)
+	if err != nil {
+		return err
+	}
+	err = transferShippingTokens(ctx, shippingInput.ID, shippingPublic.SellerID, shipped_shares)
+	if err != nil {
+		return err
+	}
+	
 	//////////////////////////////////////////////////////////////////////////////////////////
 	//All necessary checks have been carried out. Item can be created. Used assets are deleted
 	//////////////////////////////////////////////////////////////////////////////////////////
@@ -1569,6 +1843,9 @@ func (s *SmartContract) ClaimShipping(ctx contractapi.TransactionContextInterfac
 			EmissionsIDs: 		shippingInput.EmissionsIDs[i],
 			Dir: 		"in",
 		}
+		if len(shippingInput.Origins) > 0{
+			asset.Origins = shippingInput.Origins[i]
+		}
 		
 		assetPrivateJSONasBytes, err := json.Marshal(asset)
 		if err != nil {
@@ -1690,8 +1967,8 @@ func submittingClientIdentity(ctx contractapi.TransactionContextInterface) (stri
 	return string(decodeID), nil
 }
 
-//read asset from the chain
-func (s *SmartContract) CustomerGetAsset(ctx contractapi.TransactionContextInterface, assetID string) (*PublicAsset, error) {
+//read asset from the chain together with its gross footprint and the footprint net of retired credits
+func (s *SmartContract) CustomerGetAsset(ctx contractapi.TransactionContextInterface, assetID string) (*CustomerAsset, error) {
 
 	log.Printf("Read Asset from world stage ID: %v", assetID)
 	assetJSON, err := ctx.GetStub().GetState(assetID) //get the shipping from chaincode state
@@ -1710,10 +1987,7 @@ func (s *SmartContract) CustomerGetAsset(ctx contractapi.TransactionContextInter
 		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
 	}
 
-
-
-///////
-	return asset, nil
+	return getCustomerAsset(ctx, asset)
 }
 
 
@@ -1783,7 +2057,7 @@ func (s *SmartContract) GetAllPrivateShippings(ctx contractapi.TransactionContex
 			continue
 		}
 
-		if (shipping.ID == "") || (shipping.Quantity == 0) {
+		if (shipping.ID == "") || (shipping.Quantity == Quantity{}) {
 			continue
 		}
 
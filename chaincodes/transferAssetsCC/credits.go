@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const creditObjectType = "credit"
+const creditByAssetObjectType = "creditByAsset"
+const creditByInventoryObjectType = "creditByInventory"
+
+// Kinds of credits, avoidance and removal credits are reported separately
+const (
+	CreditAvoidance = "AVOIDANCE" // Emissions avoided or reduced elsewhere, e.g. renewable energy or cookstoves
+	CreditRemoval   = "REMOVAL"   // CO2 removed from the atmosphere, e.g. afforestation or direct air capture
+)
+
+// Status of a credit
+const (
+	CreditActive  = "ACTIVE"
+	CreditRetired = "RETIRED"
+)
+
+// kgCO2ePerCredit is the quantity of one credit, registries issue one credit per tonne of CO2e
+const kgCO2ePerCredit = 1000
+
+// creditRegistryAttribute must be set to the registry, e.g. VERRA, in the certificate of clients registering credits on behalf of the registry
+const creditRegistryAttribute = "creditRegistry"
+
+// serialNumberPattern splits a serial into its prefix and the number of the first credit of the block, e.g. VCS-1234-2021-000101
+var serialNumberPattern = regexp.MustCompile(`^(.*?)([0-9]+)$`)
+
+// Credit describes a block of carbon offset or removal credits issued by a registry like Verra or Gold Standard
+// The registry and serial number identify the credit, so the same credits cannot be registered twice
+type Credit struct {
+	Registry    string            `json:"registry"`
+	Serial      string            `json:"serial"`
+	ProjectID   string            `json:"projectID"`
+	ProjectType string            `json:"projectType"`
+	Kind        string            `json:"kind"`
+	Vintage     int               `json:"vintage"`
+	Quantity    int               `json:"quantity"` // Number of credits, one credit equals one tonne of CO2e
+	Owner       string            `json:"owner"`    // MSPID of the organization holding the credits
+	Issuer      string            `json:"issuer"`   // MSPID of the registry client that registered the credits
+	Status      string            `json:"status"`
+	Retirement  *CreditRetirement `json:"retirement,omitempty" metadata:",optional"`
+}
+
+// CreditRetirement describes what retired credits were claimed against, either an asset or the inventory of a period
+type CreditRetirement struct {
+	AssetID     string `json:"assetID,omitempty" metadata:",optional"`
+	Period      string `json:"period,omitempty" metadata:",optional"`
+	Beneficiary string `json:"beneficiary"` // MSPID of the organization claiming the credits
+	Timestamp   string `json:"timestamp"`
+	TxID        string `json:"txID"`
+}
+
+// CustomerAsset is the view of a public asset for customers, with the gross footprint and the footprint net of retired credits
+type CustomerAsset struct {
+	ID           string    `json:"assetID"`
+	EmissionsIDs []string  `json:"emissionsIDs"`
+	BasedOn      []string  `json:"BasedOn"`
+	GrossGHG     int       `json:"grossGHG"`   // KgCO2e of all referenced emissions records, weighted with the shares of co-products
+	AvoidedGHG   int       `json:"avoidedGHG"` // KgCO2e of retired avoidance credits
+	RemovedGHG   int       `json:"removedGHG"` // KgCO2e of retired removal credits
+	NetGHG       int       `json:"netGHG"`     // Gross footprint minus all retired credits
+	Credits      []*Credit `json:"credits"`
+}
+
+// RegisterCredit adds credits issued by a registry to the ledger, the organization of the buyer becomes the owner
+// Only clients holding the creditRegistry attribute of the registry can register its credits
+// The serial is the serial number of the first credit of the block, the block covers quantity consecutive serial numbers
+// and must not overlap with a block of the same registry that is already registered
+func (s *SmartContract) RegisterCredit(ctx contractapi.TransactionContextInterface, registry string, serial string, projectID string, projectType string, kind string, vintage int, quantity int, ownerMSPID string) error {
+	if len(registry) == 0 {
+		return fmt.Errorf("registry must be a non-empty string")
+	}
+	err := ctx.GetClientIdentity().AssertAttributeValue(creditRegistryAttribute, registry)
+	if err != nil {
+		return fmt.Errorf("only clients of the registry %v can register its credits: %v", registry, err)
+	}
+	if len(serial) == 0 {
+		return fmt.Errorf("serial must be a non-empty string")
+	}
+	if len(projectID) == 0 {
+		return fmt.Errorf("projectID must be a non-empty string")
+	}
+	if len(projectType) == 0 {
+		return fmt.Errorf("projectType must be a non-empty string")
+	}
+	if kind != CreditAvoidance && kind != CreditRemoval {
+		return fmt.Errorf("kind must be %v or %v", CreditAvoidance, CreditRemoval)
+	}
+	if vintage < 1990 || vintage > 9999 {
+		return fmt.Errorf("vintage must be a year, got %v", vintage)
+	}
+	if quantity <= 0 {
+		return fmt.Errorf("quantity must be positive, got %v", quantity)
+	}
+	if len(ownerMSPID) == 0 {
+		return fmt.Errorf("ownerMSPID must be a non-empty string")
+	}
+
+	credit, err := getCredit(ctx, registry, serial)
+	if err != nil {
+		return err
+	}
+	if credit != nil {
+		return fmt.Errorf("the credit %v of registry %v is already registered", serial, registry)
+	}
+	err = verifySerialRangeIsFree(ctx, registry, serial, quantity)
+	if err != nil {
+		return err
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	credit = &Credit{
+		Registry:    registry,
+		Serial:      serial,
+		ProjectID:   projectID,
+		ProjectType: projectType,
+		Kind:        kind,
+		Vintage:     vintage,
+		Quantity:    quantity,
+		Owner:       ownerMSPID,
+		Issuer:      clientMSPID,
+		Status:      CreditActive,
+	}
+
+	log.Printf("RegisterCredit Put: registry %v, serial %v", registry, serial)
+	return putCredit(ctx, credit)
+}
+
+// TransferCredit passes active credits of the invoking organization on to another organization
+func (s *SmartContract) TransferCredit(ctx contractapi.TransactionContextInterface, registry string, serial string, recipientMSPID string) error {
+	credit, err := getOwnedActiveCredit(ctx, registry, serial)
+	if err != nil {
+		return err
+	}
+	if len(recipientMSPID) == 0 {
+		return fmt.Errorf("recipientMSPID must be a non-empty string")
+	}
+	if recipientMSPID == credit.Owner {
+		return fmt.Errorf("the credit %v is already owned by %v", serial, recipientMSPID)
+	}
+
+	credit.Owner = recipientMSPID
+	log.Printf("TransferCredit Put: registry %v, serial %v, owner %v", registry, serial, recipientMSPID)
+	return putCredit(ctx, credit)
+}
+
+// RetireCreditForAsset permanently retires credits of the invoking organization against an asset on the world state
+// Only the current owner of the asset or the manufacturer of a final product can retire credits against it
+func (s *SmartContract) RetireCreditForAsset(ctx contractapi.TransactionContextInterface, registry string, serial string, assetID string) error {
+	credit, err := getOwnedActiveCredit(ctx, registry, serial)
+	if err != nil {
+		return err
+	}
+	assetJSON, err := ctx.GetStub().GetState(assetID)
+	if err != nil {
+		return fmt.Errorf("failed to read asset: %v", err)
+	}
+	if assetJSON == nil {
+		return fmt.Errorf("the asset %v does not exist on world state", assetID)
+	}
+	err = verifyAssetOwnerOrManufacturer(ctx, credit.Owner, assetID, assetJSON)
+	if err != nil {
+		return err
+	}
+
+	err = retireCredit(ctx, credit, &CreditRetirement{AssetID: assetID})
+	if err != nil {
+		return err
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(creditByAssetObjectType, []string{assetID, registry, serial})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+// RetireCreditForInventory permanently retires credits of the invoking organization against its inventory of a reporting period, e.g. FY2024
+// The period must be one of the reporting periods of the organization in the emissions audit chaincode
+func (s *SmartContract) RetireCreditForInventory(ctx contractapi.TransactionContextInterface, registry string, serial string, period string) error {
+	credit, err := getOwnedActiveCredit(ctx, registry, serial)
+	if err != nil {
+		return err
+	}
+	if len(period) == 0 {
+		return fmt.Errorf("period must be a non-empty string")
+	}
+	err = verifyReportingPeriod(ctx, credit.Owner, period)
+	if err != nil {
+		return err
+	}
+
+	err = retireCredit(ctx, credit, &CreditRetirement{Period: period})
+	if err != nil {
+		return err
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(creditByInventoryObjectType, []string{credit.Owner, period, registry, serial})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+// GetCredit returns the credit with the given registry and serial number
+func (s *SmartContract) GetCredit(ctx contractapi.TransactionContextInterface, registry string, serial string) (*Credit, error) {
+	credit, err := getCredit(ctx, registry, serial)
+	if err != nil {
+		return nil, err
+	}
+	if credit == nil {
+		return nil, fmt.Errorf("the credit %v of registry %v does not exist", serial, registry)
+	}
+	return credit, nil
+}
+
+// GetCreditsOfAsset returns all credits retired against an asset
+func (s *SmartContract) GetCreditsOfAsset(ctx contractapi.TransactionContextInterface, assetID string) ([]*Credit, error) {
+	return getIndexedCredits(ctx, creditByAssetObjectType, []string{assetID})
+}
+
+// GetCreditsOfInventory returns all credits an organization retired against its inventory of a reporting period
+func (s *SmartContract) GetCreditsOfInventory(ctx contractapi.TransactionContextInterface, mspID string, period string) ([]*Credit, error) {
+	return getIndexedCredits(ctx, creditByInventoryObjectType, []string{mspID, period})
+}
+
+// getCustomerAsset adds the gross footprint of a public asset and the credits retired against it
+func getCustomerAsset(ctx contractapi.TransactionContextInterface, asset *PublicAsset) (*CustomerAsset, error) {
+	shares := asset.EmissionsShares
+	if shares == nil {
+		shares = sharesOfIDs(asset.EmissionsIDs)
+	}
+	gross, err := sumEmissionsShares(ctx, shares)
+	if err != nil {
+		return nil, err
+	}
+	credits, err := getIndexedCredits(ctx, creditByAssetObjectType, []string{asset.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	customerAsset := CustomerAsset{
+		ID:           asset.ID,
+		EmissionsIDs: asset.EmissionsIDs,
+		BasedOn:      asset.BasedOn,
+		GrossGHG:     gross,
+		Credits:      credits,
+	}
+	for _, credit := range credits {
+		if credit.Kind == CreditRemoval {
+			customerAsset.RemovedGHG += credit.Quantity * kgCO2ePerCredit
+		} else {
+			customerAsset.AvoidedGHG += credit.Quantity * kgCO2ePerCredit
+		}
+	}
+	customerAsset.NetGHG = customerAsset.GrossGHG - customerAsset.AvoidedGHG - customerAsset.RemovedGHG
+	return &customerAsset, nil
+}
+
+// retireCredit marks a credit as retired, retired credits can neither be transferred nor retired again
+func retireCredit(ctx contractapi.TransactionContextInterface, credit *Credit, retirement *CreditRetirement) error {
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	retirement.Beneficiary = credit.Owner
+	retirement.Timestamp = txTime.Format(time.RFC3339)
+	retirement.TxID = ctx.GetStub().GetTxID()
+
+	credit.Status = CreditRetired
+	credit.Retirement = retirement
+	log.Printf("RetireCredit Put: registry %v, serial %v", credit.Registry, credit.Serial)
+	return putCredit(ctx, credit)
+}
+
+// verifyAssetOwnerOrManufacturer checks that an organization holds an asset in its private data collection
+// or, for final products, created it. Final products created before the manufacturer was recorded can only be claimed by their owner
+func verifyAssetOwnerOrManufacturer(ctx contractapi.TransactionContextInterface, mspID string, assetID string, assetJSON []byte) error {
+	ownerHash, err := ctx.GetStub().GetPrivateDataHash(mspID+"PrivateCollection", assetID)
+	if err != nil {
+		return fmt.Errorf("failed to read hash of asset: %v", err)
+	}
+	if ownerHash != nil {
+		return nil
+	}
+
+	var asset *FinalAsset
+	err = json.Unmarshal(assetJSON, &asset)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	if asset.ManufacturerMSPID == mspID {
+		return nil
+	}
+	return fmt.Errorf("the asset %v is neither owned nor manufactured by %v", assetID, mspID)
+}
+
+// verifySerialRangeIsFree checks that no registered block of credits of the registry covers one of the serial numbers of a new block
+// Serials without a trailing number are blocks of their own and only conflict with the same serial
+func verifySerialRangeIsFree(ctx contractapi.TransactionContextInterface, registry string, serial string, quantity int) error {
+	prefix, first, last, err := serialRange(serial, quantity)
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(creditObjectType, []string{registry})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		var credit *Credit
+		err = json.Unmarshal(queryResponse.Value, &credit)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		otherPrefix, otherFirst, otherLast, err := serialRange(credit.Serial, credit.Quantity)
+		if err != nil {
+			return err
+		}
+		if otherPrefix == prefix && otherFirst <= last && first <= otherLast {
+			return fmt.Errorf("the serial numbers of credit %v overlap with the registered credit %v of registry %v", serial, credit.Serial, registry)
+		}
+	}
+	return nil
+}
+
+// serialRange returns the prefix and the first and last serial number of a block of credits
+func serialRange(serial string, quantity int) (string, uint64, uint64, error) {
+	match := serialNumberPattern.FindStringSubmatch(serial)
+	if match == nil {
+		return serial, 0, 0, nil
+	}
+	first, err := strconv.ParseUint(match[2], 10, 64)
+	if err != nil || first > math.MaxUint64-uint64(quantity) {
+		return "", 0, 0, fmt.Errorf("the serial number of credit %v is out of range", serial)
+	}
+	return match[1], first, first + uint64(quantity) - 1, nil
+}
+
+// getOwnedActiveCredit reads a credit and checks that it is active and owned by the invoking organization
+func getOwnedActiveCredit(ctx contractapi.TransactionContextInterface, registry string, serial string) (*Credit, error) {
+	credit, err := getCredit(ctx, registry, serial)
+	if err != nil {
+		return nil, err
+	}
+	if credit == nil {
+		return nil, fmt.Errorf("the credit %v of registry %v does not exist", serial, registry)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	if credit.Owner != clientMSPID {
+		return nil, fmt.Errorf("the credit %v is not owned by %v", serial, clientMSPID)
+	}
+	if credit.Status != CreditActive {
+		return nil, fmt.Errorf("the credit %v is %v", serial, credit.Status)
+	}
+	return credit, nil
+}
+
+// getIndexedCredits reads the credits referenced by the keys of a retirement index
+func getIndexedCredits(ctx contractapi.TransactionContextInterface, objectType string, attributes []string) ([]*Credit, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	credits := []*Credit{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyAttributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+		// The registry and serial number are the last two attributes of every index
+		registry := keyAttributes[len(keyAttributes)-2]
+		serial := keyAttributes[len(keyAttributes)-1]
+		credit, err := getCredit(ctx, registry, serial)
+		if err != nil {
+			return nil, err
+		}
+		if credit == nil {
+			return nil, fmt.Errorf("the credit %v of registry %v does not exist", serial, registry)
+		}
+		credits = append(credits, credit)
+	}
+	return credits, nil
+}
+
+// getCredit reads a credit from the world state, it returns nil if the credit does not exist
+func getCredit(ctx contractapi.TransactionContextInterface, registry string, serial string) (*Credit, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(creditObjectType, []string{registry, serial})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	creditJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credit: %v", err)
+	}
+	if creditJSON == nil {
+		return nil, nil
+	}
+
+	var credit *Credit
+	err = json.Unmarshal(creditJSON, &credit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return credit, nil
+}
+
+// putCredit writes a credit to the world state
+func putCredit(ctx contractapi.TransactionContextInterface, credit *Credit) error {
+	key, err := ctx.GetStub().CreateCompositeKey(creditObjectType, []string{credit.Registry, credit.Serial})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	creditJSON, err := json.Marshal(credit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credit into JSON: %v", err)
+	}
+	return ctx.GetStub().PutState(key, creditJSON)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// emissionsChaincodeName is the name the emissions audit chaincode is deployed with on the same channel
+const emissionsChaincodeName = "emissionsAudit"
+
+// EmissionsRecord holds the fields of an emissions record of the emissions audit chaincode that are needed here
+type EmissionsRecord struct {
+	ID        string              `json:"ID"`
+	KgCO2     int                 `json:"KgCO2"`
+	CO2e      *Quantity           `json:"CO2e,omitempty"`      // Exact emissions in gCO2e, kgCO2e or tCO2e, not set for records created before exact emissions were introduced
+	Amendment *EmissionsAmendment `json:"Amendment,omitempty"` // Set for revisions that amend an earlier record
+}
+
+// kgCO2e returns the exact emissions of a record in KgCO2e, records created before exact emissions were introduced only have whole Kg
+func (record *EmissionsRecord) kgCO2e() (*big.Rat, error) {
+	if record.CO2e == nil {
+		return big.NewRat(int64(record.KgCO2), 1), nil
+	}
+	units, err := record.CO2e.millionths()
+	if err != nil {
+		return nil, fmt.Errorf("invalid emissions of record %v: %v", record.ID, err)
+	}
+	kg := new(big.Rat).SetFrac(units, new(big.Int).Exp(big.NewInt(10), big.NewInt(quantityDecimals), nil))
+	switch record.CO2e.Unit {
+	case UnitGramCO2e:
+		return kg.Quo(kg, big.NewRat(1000, 1)), nil
+	case UnitKgCO2e:
+		return kg, nil
+	case UnitTonneCO2e:
+		return kg.Mul(kg, big.NewRat(1000, 1)), nil
+	}
+	return nil, fmt.Errorf("emissions of record %v must be given in CO2 equivalents, got %v", record.ID, record.CO2e.Unit)
+}
+
+// EmissionsAmendment holds the fields of the amendment of an emissions record that are needed here
+type EmissionsAmendment struct {
+	RootID     string `json:"RootID"`     // ID of the original record
+	Supersedes string `json:"Supersedes"` // ID of the revision this revision replaces
+}
+
+// Facility holds the fields of a facility of the emissions audit chaincode that are needed here
+type Facility struct {
+	ID     string `json:"ID"`
+	MSPID  string `json:"MSPID"`
+	Status string `json:"Status"`
+}
+
+// ReportingPeriod holds the fields of a reporting period of the emissions audit chaincode that are needed here
+type ReportingPeriod struct {
+	ID    string `json:"ID"`
+	MSPID string `json:"MSPID"`
+}
+
+// verifyReportingPeriod checks that an organization defined the reporting period in the emissions audit chaincode
+func verifyReportingPeriod(ctx contractapi.TransactionContextInterface, mspID string, periodID string) error {
+	args := [][]byte{[]byte("GetReportingPeriod"), []byte(mspID), []byte(periodID)}
+	response := ctx.GetStub().InvokeChaincode(emissionsChaincodeName, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to read reporting period from %v: %v", emissionsChaincodeName, response.Message)
+	}
+
+	var period ReportingPeriod
+	err := json.Unmarshal(response.Payload, &period)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	if period.ID != periodID || period.MSPID != mspID {
+		return fmt.Errorf("the reporting period %v is not defined by %v", periodID, mspID)
+	}
+	return nil
+}
+
+// verifyFacility checks that a facility is registered for the organization of the client in the emissions audit chaincode
+// and still in operation, so assets can only be attributed to sites of the organization creating them
+func verifyFacility(ctx contractapi.TransactionContextInterface, facilityID string) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+
+	args := [][]byte{[]byte("GetFacility"), []byte(clientMSPID), []byte(facilityID)}
+	response := ctx.GetStub().InvokeChaincode(emissionsChaincodeName, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to read facility from %v: %v", emissionsChaincodeName, response.Message)
+	}
+
+	var facility Facility
+	err = json.Unmarshal(response.Payload, &facility)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	if facility.MSPID != clientMSPID {
+		return fmt.Errorf("the facility %v is not registered for %v", facilityID, clientMSPID)
+	}
+	if facility.Status != "ACTIVE" {
+		return fmt.Errorf("the facility %v is %v", facilityID, facility.Status)
+	}
+	return nil
+}
+
+// getEmissionsRecords reads the latest revisions of the given emissions records from the emissions audit chaincode
+func getEmissionsRecords(ctx contractapi.TransactionContextInterface, ids []string) ([]*EmissionsRecord, error) {
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal emissionsIDs into JSON: %v", err)
+	}
+
+	args := [][]byte{[]byte("GetEmissionsRecordsList"), idsJSON}
+	response := ctx.GetStub().InvokeChaincode(emissionsChaincodeName, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to read emissions records from %v: %v", emissionsChaincodeName, response.Message)
+	}
+
+	var records []*EmissionsRecord
+	err = json.Unmarshal(response.Payload, &records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return records, nil
+}
+
+// getEmissionsRecord reads the latest revision of a single emissions record from the emissions audit chaincode
+func getEmissionsRecord(ctx contractapi.TransactionContextInterface, id string) (*EmissionsRecord, error) {
+	records, err := getEmissionsRecords(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 {
+		return nil, fmt.Errorf("expected 1 emissions record from %v, got %v", emissionsChaincodeName, len(records))
+	}
+	return records[0], nil
+}
+
+// verifyOwnedEmissions checks in the emissions audit chaincode that all given emissions records exist, passed the audit
+// and belong to the organization of the client, so assets cannot reference dangling or foreign emissions
+func verifyOwnedEmissions(ctx contractapi.TransactionContextInterface, ids []string) error {
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return fmt.Errorf("failed to marshal emissionsIDs into JSON: %v", err)
+	}
+
+	args := [][]byte{[]byte("GetOwnedEmissionsRecords"), idsJSON}
+	response := ctx.GetStub().InvokeChaincode(emissionsChaincodeName, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("invalid emissionsIDs %v: %v", ids, response.Message)
+	}
+	return nil
+}
+
+// transferShippingTokens passes the emissions tokens of a claimed shipping from the seller to the buyer in the emissions audit chaincode
+// The amount is derived there from the weighted emissions records of the shipped assets
+func transferShippingTokens(ctx contractapi.TransactionContextInterface, shippingID string, sellerMSPID string, shares []EmissionsShare) error {
+	sharesJSON, err := json.Marshal(shares)
+	if err != nil {
+		return fmt.Errorf("failed to marshal emissions shares into JSON: %v", err)
+	}
+
+	args := [][]byte{[]byte("TransferShippingTokens"), []byte(shippingID), []byte(sellerMSPID), sharesJSON}
+	response := ctx.GetStub().InvokeChaincode(emissionsChaincodeName, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to transfer emissions tokens of shipping %v in %v: %v", shippingID, emissionsChaincodeName, response.Message)
+	}
+	return nil
+}
+
+// getTxTime returns the timestamp of the transaction, which is the same on every endorsing peer
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return timestamp.AsTime().UTC(), nil
+}
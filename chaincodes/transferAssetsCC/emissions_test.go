@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestEmissionsRecordKgCO2e(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  EmissionsRecord
+		want    string
+		wantErr bool
+	}{
+		{name: "whole Kg only", record: EmissionsRecord{ID: "E1", KgCO2: 12}, want: "12"},
+		{name: "fraction of a Kg", record: EmissionsRecord{ID: "E1", KgCO2: 0, CO2e: &Quantity{Unit: UnitKgCO2e, Value: "0.4"}}, want: "2/5"},
+		{name: "grams", record: EmissionsRecord{ID: "E1", KgCO2: 0, CO2e: &Quantity{Unit: UnitGramCO2e, Value: "350"}}, want: "7/20"},
+		{name: "tonnes", record: EmissionsRecord{ID: "E1", KgCO2: 1250, CO2e: &Quantity{Unit: UnitTonneCO2e, Value: "1.25"}}, want: "1250"},
+		{name: "no CO2 equivalents", record: EmissionsRecord{ID: "E1", CO2e: &Quantity{Unit: UnitKg, Value: "1"}}, wantErr: true},
+		{name: "invalid value", record: EmissionsRecord{ID: "E1", CO2e: &Quantity{Unit: UnitKgCO2e, Value: "-1"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.record.kgCO2e()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("kgCO2e() = %v, want error", got.RatString())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("kgCO2e() failed: %v", err)
+			}
+			want, _ := new(big.Rat).SetString(tt.want)
+			if got.Cmp(want) != 0 {
+				t.Errorf("kgCO2e() = %v, want %v", got.RatString(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// lineageRoot marks assets created with CreateAssetIn, which are not based on other assets
+const lineageRoot = "nil"
+
+// FootprintStage is the part of the footprint of a final product that was added at one asset of its lineage
+type FootprintStage struct {
+	AssetID      string   `json:"assetID"`
+	BasedOn      []string `json:"BasedOn"`
+	EmissionsIDs []string `json:"emissionsIDs"` // Emissions records first referenced by this asset, transport emissions count at the asset receiving the shipment
+	GHG          int      `json:"GHG"`          // KgCO2e of these emissions records
+}
+
+// ReadFinalProduct returns a final product with its cradle-to-gate footprint
+// The footprint is resolved again from the emissions audit chaincode, so amended emissions records are reflected
+func (s *SmartContract) ReadFinalProduct(ctx contractapi.TransactionContextInterface, assetID string) (*FinalAsset, error) {
+	log.Printf("Read final product from world state ID: %v", assetID)
+	assetJSON, err := ctx.GetStub().GetState(assetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset: %v", err)
+	}
+	if assetJSON == nil {
+		return nil, fmt.Errorf("the asset %v does not exist on the world state", assetID)
+	}
+
+	var asset *FinalAsset
+	err = json.Unmarshal(assetJSON, &asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	// Only FinalProduct stores the footprint stages
+	if asset.Stages == nil {
+		return nil, fmt.Errorf("the asset %v is not a final product", assetID)
+	}
+
+	err = resolveFootprint(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// ReadStoredFinalProduct returns a final product with the footprint stored when it was created, without resolving it again
+// The emissions audit chaincode reads it to check the final product tokens are retired for
+func (s *SmartContract) ReadStoredFinalProduct(ctx contractapi.TransactionContextInterface, assetID string) (*FinalAsset, error) {
+	log.Printf("Read stored final product from world state ID: %v", assetID)
+	return getFinalAsset(ctx, assetID)
+}
+
+// resolveFootprint walks the BasedOn lineage of a final product on the world state and sets its total footprint and the footprint of every stage
+// Every emissions record is counted once with the share the product bears, at the most upstream asset referencing it, so the stages add up to the total
+func resolveFootprint(ctx contractapi.TransactionContextInterface, asset *FinalAsset) error {
+	stages := []*FootprintStage{{AssetID: asset.ID, BasedOn: asset.BasedOn}}
+	lineageIDs := map[string][]string{asset.ID: asset.EmissionsIDs}
+	queue := append([]string{}, asset.BasedOn...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == lineageRoot || lineageIDs[id] != nil {
+			continue
+		}
+
+		assetJSON, err := ctx.GetStub().GetState(id)
+		if err != nil {
+			return fmt.Errorf("failed to read asset %v from world state: %v", id, err)
+		}
+		if assetJSON == nil {
+			return fmt.Errorf("the asset %v of the lineage of %v does not exist on the world state", id, asset.ID)
+		}
+		var publicAsset *PublicAsset
+		err = json.Unmarshal(assetJSON, &publicAsset)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		stages = append(stages, &FootprintStage{AssetID: id, BasedOn: publicAsset.BasedOn})
+		lineageIDs[id] = append([]string{}, publicAsset.EmissionsIDs...)
+		queue = append(queue, publicAsset.BasedOn...)
+	}
+
+	// Assets carry the emissions IDs of the assets they are based on, only the remaining IDs were added at a stage
+	// IDs added at several stages independently of each other are counted once, at the stage found deepest in the lineage
+	counted := make(map[string]bool)
+	unique := []string{}
+	for i := len(stages) - 1; i >= 0; i-- {
+		stage := stages[i]
+		inherited := make(map[string]bool)
+		for _, basedOn := range stage.BasedOn {
+			for _, id := range lineageIDs[basedOn] {
+				inherited[id] = true
+			}
+		}
+		stage.EmissionsIDs = []string{}
+		for _, id := range lineageIDs[stage.AssetID] {
+			if !inherited[id] && !counted[id] {
+				counted[id] = true
+				unique = append(unique, id)
+				stage.EmissionsIDs = append(stage.EmissionsIDs, id)
+			}
+		}
+	}
+
+	// Co-products only bear the share of an emissions record that was allocated to them
+	known := make(map[string]string)
+	for _, share := range asset.EmissionsShares {
+		known[share.ID] = share.Share
+	}
+	shares := []EmissionsShare{}
+	for _, id := range unique {
+		share, ok := known[id]
+		if !ok {
+			share = fullShare
+		}
+		shares = append(shares, EmissionsShare{ID: id, Share: share})
+	}
+	values, roots, err := weighEmissionsShares(ctx, shares)
+	if err != nil {
+		return err
+	}
+
+	// Revisions of the same record are counted once, at the deepest stage referencing one of them
+	exact := make([]*big.Rat, len(stages))
+	countedRecords := make(map[string]bool)
+	for i := len(stages) - 1; i >= 0; i-- {
+		exact[i] = new(big.Rat)
+		for _, id := range stages[i].EmissionsIDs {
+			if !countedRecords[roots[id]] {
+				countedRecords[roots[id]] = true
+				exact[i].Add(exact[i], values[roots[id]])
+			}
+		}
+	}
+	var rounded []int
+	asset.GHG, rounded = roundStages(exact)
+	for i, stage := range stages {
+		stage.GHG = rounded[i]
+	}
+	asset.Stages = stages
+	return nil
+}
+
+// roundStages rounds the exact footprints of the stages to whole KgCO2e, so that they add up to their total rounded half up
+// Every stage is rounded down first, the remaining KgCO2e go to the stages with the largest remainders
+func roundStages(exact []*big.Rat) (int, []int) {
+	total := new(big.Rat)
+	for _, value := range exact {
+		total.Add(total, value)
+	}
+	rounded := roundHalfUp(total)
+
+	remaining := rounded
+	stages := make([]int, len(exact))
+	remainders := make([]*big.Rat, len(exact))
+	for i, value := range exact {
+		floor := new(big.Int).Quo(value.Num(), value.Denom())
+		stages[i] = int(floor.Int64())
+		remaining -= stages[i]
+		remainders[i] = new(big.Rat).Sub(value, new(big.Rat).SetInt(floor))
+	}
+	order := make([]int, len(exact))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+	for _, i := range order[:remaining] {
+		stages[i]++
+	}
+	return rounded, stages
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestRoundStages(t *testing.T) {
+	tests := []struct {
+		name       string
+		exact      []string // Exact KgCO2e of every stage
+		wantTotal  int
+		wantStages []int
+	}{
+		{name: "no stages", exact: []string{}, wantTotal: 0, wantStages: []int{}},
+		{name: "whole values", exact: []string{"10", "5", "0"}, wantTotal: 15, wantStages: []int{10, 5, 0}},
+		{name: "largest remainder is rounded up", exact: []string{"1.4", "1.3", "1.3"}, wantTotal: 4, wantStages: []int{2, 1, 1}},
+		{name: "several stages are rounded up", exact: []string{"0.6", "0.6", "0.6", "0.2"}, wantTotal: 2, wantStages: []int{1, 1, 0, 0}},
+		{name: "equal remainders keep the order of the stages", exact: []string{"1/3", "1/3", "1/3"}, wantTotal: 1, wantStages: []int{1, 0, 0}},
+		{name: "total is rounded half up", exact: []string{"0.25", "0.25"}, wantTotal: 1, wantStages: []int{1, 0}},
+		{name: "total below a half", exact: []string{"0.2", "0.2"}, wantTotal: 0, wantStages: []int{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exact := make([]*big.Rat, len(tt.exact))
+			for i, value := range tt.exact {
+				exact[i], _ = new(big.Rat).SetString(value)
+			}
+			total, stages := roundStages(exact)
+			if total != tt.wantTotal || !reflect.DeepEqual(stages, tt.wantStages) {
+				t.Errorf("roundStages(%v) = %v, %v, want %v, %v", tt.exact, total, stages, tt.wantTotal, tt.wantStages)
+			}
+			sum := 0
+			for _, stage := range stages {
+				sum += stage
+			}
+			if sum != total {
+				t.Errorf("stages of %v add up to %v instead of %v", tt.exact, sum, total)
+			}
+		})
+	}
+}
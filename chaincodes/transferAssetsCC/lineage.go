@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Roles of the assets of a lineage
+const (
+	LineageMineInput    = "MINE_INPUT"   // Created with CreateAssetIn, not based on other assets
+	LineageIntermediate = "INTERMEDIATE" // Manufactured with ManufactureAsset
+	LineageFinal        = "FINAL"        // Created with FinalProduct
+	LineageDangling     = "DANGLING"     // Referenced in BasedOn but missing on the world state
+)
+
+// Lineage is the provenance graph of a public asset, it contains every asset reachable through BasedOn
+type Lineage struct {
+	AssetID  string         `json:"assetID"`
+	Cycles   [][]string     `json:"cycles"`   // Every cycle found as asset IDs in BasedOn direction, the first ID is repeated at the end
+	Dangling []string       `json:"dangling"` // Referenced assets that do not exist on the world state
+	Depth    int            `json:"depth"`    // Largest depth of all nodes
+	Nodes    []*LineageNode `json:"nodes"`
+}
+
+// LineageNode is one asset of a lineage, BasedOn lists the assets it was made of
+type LineageNode struct {
+	AssetID      string   `json:"assetID"`
+	BasedOn      []string `json:"BasedOn"`
+	Depth        int      `json:"depth"` // Shortest distance to the queried asset, 0 for the asset itself
+	EmissionsIDs []string `json:"emissionsIDs"`
+	Role         string   `json:"role"`
+}
+
+// GetAssetLineage returns the full provenance graph of a public asset by following BasedOn recursively through the world state
+// Cycles and references to missing assets are reported instead of failing the query
+func (s *SmartContract) GetAssetLineage(ctx contractapi.TransactionContextInterface, assetID string) (*Lineage, error) {
+	log.Printf("Read lineage from world state ID: %v", assetID)
+	return getLineage(ctx, assetID)
+}
+
+// GetAssetLineageDOT returns the provenance graph of a public asset in the DOT language of Graphviz
+// Edges point from an input to the asset made of it, missing assets and edges closing a cycle are drawn red
+func (s *SmartContract) GetAssetLineageDOT(ctx contractapi.TransactionContextInterface, assetID string) (string, error) {
+	lineage, err := getLineage(ctx, assetID)
+	if err != nil {
+		return "", err
+	}
+	return formatLineageDOT(lineage), nil
+}
+
+// formatLineageDOT writes a lineage as directed graph in the DOT language
+func formatLineageDOT(lineage *Lineage) string {
+	cycleEdges := make(map[string]bool)
+	for _, cycle := range lineage.Cycles {
+		for i := 0; i+1 < len(cycle); i++ {
+			cycleEdges[cycle[i]+"\x00"+cycle[i+1]] = true
+		}
+	}
+	shapes := map[string]string{
+		LineageMineInput:    "box",
+		LineageIntermediate: "ellipse",
+		LineageFinal:        "doubleoctagon",
+		LineageDangling:     "box",
+	}
+
+	var dot strings.Builder
+	fmt.Fprintf(&dot, "digraph %s {\n", dotID("lineage "+lineage.AssetID))
+	dot.WriteString("\trankdir=LR;\n")
+	for _, node := range lineage.Nodes {
+		attributes := fmt.Sprintf("label=%s, shape=%s", dotID(fmt.Sprintf("%s\n%s\ndepth %d", node.AssetID, node.Role, node.Depth)), shapes[node.Role])
+		if node.Role == LineageDangling {
+			attributes += ", style=dashed, color=red"
+		}
+		fmt.Fprintf(&dot, "\t%s [%s];\n", dotID(node.AssetID), attributes)
+	}
+	for _, node := range lineage.Nodes {
+		for _, basedOn := range node.BasedOn {
+			if basedOn == lineageRoot {
+				continue
+			}
+			attributes := ""
+			if cycleEdges[node.AssetID+"\x00"+basedOn] {
+				attributes = " [color=red]"
+			}
+			fmt.Fprintf(&dot, "\t%s -> %s%s;\n", dotID(basedOn), dotID(node.AssetID), attributes)
+		}
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+// getLineage reads the assets of a lineage breadth first, so every asset gets its shortest distance to the queried asset
+func getLineage(ctx contractapi.TransactionContextInterface, assetID string) (*Lineage, error) {
+	lineage := Lineage{
+		AssetID:  assetID,
+		Cycles:   [][]string{},
+		Dangling: []string{},
+		Nodes:    []*LineageNode{},
+	}
+	nodes := make(map[string]*LineageNode)
+	queue := []string{assetID}
+	depths := map[string]int{assetID: 0}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		assetJSON, err := ctx.GetStub().GetState(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read asset %v from world state: %v", id, err)
+		}
+		node := &LineageNode{AssetID: id, BasedOn: []string{}, Depth: depths[id], EmissionsIDs: []string{}}
+		if assetJSON == nil {
+			if id == assetID {
+				return nil, fmt.Errorf("the asset %v does not exist on the world state", assetID)
+			}
+			node.Role = LineageDangling
+			lineage.Dangling = append(lineage.Dangling, id)
+		} else {
+			// Final assets are a superset of public assets, only FinalProduct stores the footprint stages
+			var asset *FinalAsset
+			err = json.Unmarshal(assetJSON, &asset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal JSON of asset %v: %v", id, err)
+			}
+			if asset.BasedOn != nil {
+				node.BasedOn = asset.BasedOn
+			}
+			if asset.EmissionsIDs != nil {
+				node.EmissionsIDs = asset.EmissionsIDs
+			}
+			switch {
+			case asset.Stages != nil:
+				node.Role = LineageFinal
+			case len(asset.BasedOn) == 0 || (len(asset.BasedOn) == 1 && asset.BasedOn[0] == lineageRoot):
+				node.Role = LineageMineInput
+			default:
+				node.Role = LineageIntermediate
+			}
+		}
+		nodes[id] = node
+		lineage.Nodes = append(lineage.Nodes, node)
+		if node.Depth > lineage.Depth {
+			lineage.Depth = node.Depth
+		}
+
+		for _, basedOn := range node.BasedOn {
+			if _, ok := depths[basedOn]; ok || basedOn == lineageRoot {
+				continue
+			}
+			depths[basedOn] = node.Depth + 1
+			queue = append(queue, basedOn)
+		}
+	}
+
+	lineage.Cycles = findCycles(assetID, nodes)
+	return &lineage, nil
+}
+
+// findCycles searches the lineage depth first and returns the path of every BasedOn reference leading back to an asset on the current path
+func findCycles(assetID string, nodes map[string]*LineageNode) [][]string {
+	cycles := [][]string{}
+	onPath := make(map[string]int)
+	done := make(map[string]bool)
+	path := []string{}
+
+	var visit func(id string)
+	visit = func(id string) {
+		onPath[id] = len(path)
+		path = append(path, id)
+		for _, basedOn := range nodes[id].BasedOn {
+			if _, ok := nodes[basedOn]; !ok {
+				continue
+			}
+			if start, ok := onPath[basedOn]; ok {
+				cycle := append([]string{}, path[start:]...)
+				cycles = append(cycles, append(cycle, basedOn))
+			} else if !done[basedOn] {
+				visit(basedOn)
+			}
+		}
+		path = path[:len(path)-1]
+		delete(onPath, id)
+		done[id] = true
+	}
+	visit(assetID)
+	return cycles
+}
+
+// dotID quotes an identifier for the DOT language
+func dotID(id string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(id) + `"`
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		basedOn map[string][]string
+		want    [][]string
+	}{
+		{
+			name:    "mine input",
+			basedOn: map[string][]string{"A": {lineageRoot}},
+			want:    [][]string{},
+		},
+		{
+			name:    "diamond without cycle",
+			basedOn: map[string][]string{"A": {"B", "C"}, "B": {"D"}, "C": {"D"}, "D": {lineageRoot}},
+			want:    [][]string{},
+		},
+		{
+			name:    "self reference",
+			basedOn: map[string][]string{"A": {"A"}},
+			want:    [][]string{{"A", "A"}},
+		},
+		{
+			name:    "cycle below the queried asset",
+			basedOn: map[string][]string{"A": {"B"}, "B": {"C"}, "C": {"B"}},
+			want:    [][]string{{"B", "C", "B"}},
+		},
+		{
+			name:    "two cycles",
+			basedOn: map[string][]string{"A": {"B", "C"}, "B": {"A"}, "C": {"A"}},
+			want:    [][]string{{"A", "B", "A"}, {"A", "C", "A"}},
+		},
+		{
+			name:    "references to missing assets are ignored",
+			basedOn: map[string][]string{"A": {"X"}},
+			want:    [][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := make(map[string]*LineageNode)
+			for id, basedOn := range tt.basedOn {
+				nodes[id] = &LineageNode{AssetID: id, BasedOn: basedOn}
+			}
+			got := findCycles("A", nodes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findCycles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatLineageDOT(t *testing.T) {
+	tests := []struct {
+		name    string
+		lineage Lineage
+		want    []string // Lines the graph must contain
+		notWant []string // Lines the graph must not contain
+	}{
+		{
+			name: "roles and edges",
+			lineage: Lineage{AssetID: "P1", Cycles: [][]string{}, Nodes: []*LineageNode{
+				{AssetID: "P1", BasedOn: []string{"M1"}, Role: LineageFinal},
+				{AssetID: "M1", BasedOn: []string{lineageRoot}, Depth: 1, Role: LineageMineInput},
+			}},
+			want: []string{
+				`digraph "lineage P1" {`,
+				"\trankdir=LR;",
+				"\t\"P1\" [label=\"P1\\nFINAL\\ndepth 0\", shape=doubleoctagon];",
+				"\t\"M1\" [label=\"M1\\nMINE_INPUT\\ndepth 1\", shape=box];",
+				"\t\"M1\" -> \"P1\";",
+				"}",
+			},
+			notWant: []string{"\t\"nil\" -> \"M1\";"},
+		},
+		{
+			name: "dangling assets and cycles are drawn red",
+			lineage: Lineage{AssetID: "A", Cycles: [][]string{{"A", "B", "A"}}, Nodes: []*LineageNode{
+				{AssetID: "A", BasedOn: []string{"B", "X"}, Role: LineageIntermediate},
+				{AssetID: "B", BasedOn: []string{"A"}, Depth: 1, Role: LineageIntermediate},
+				{AssetID: "X", BasedOn: []string{}, Depth: 1, Role: LineageDangling},
+			}},
+			want: []string{
+				"\t\"X\" [label=\"X\\nDANGLING\\ndepth 1\", shape=box, style=dashed, color=red];",
+				"\t\"B\" -> \"A\" [color=red];",
+				"\t\"A\" -> \"B\" [color=red];",
+				"\t\"X\" -> \"A\";",
+			},
+		},
+		{
+			name: "identifiers are quoted",
+			lineage: Lineage{AssetID: `say "hi"`, Cycles: [][]string{}, Nodes: []*LineageNode{
+				{AssetID: `say "hi"`, BasedOn: []string{}, Role: LineageMineInput},
+			}},
+			want: []string{`digraph "lineage say \"hi\"" {`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatLineageDOT(&tt.lineage)
+			lines := make(map[string]bool)
+			for _, line := range strings.Split(got, "\n") {
+				lines[line] = true
+			}
+			for _, line := range tt.want {
+				if !lines[line] {
+					t.Errorf("graph does not contain %q:\n%s", line, got)
+				}
+			}
+			for _, line := range tt.notWant {
+				if lines[line] {
+					t.Errorf("graph contains %q:\n%s", line, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// mineOriginObjectType keys the origin details of mine inputs in the private collection of the mine
+const mineOriginObjectType = "mineOrigin"
+
+// productOriginObjectType keys the origin summaries of final products in the private collection of the OEM
+const productOriginObjectType = "productOrigin"
+
+// Raw materials with due diligence obligations, the conflict minerals (3TG) and the raw materials of batteries
+const (
+	MaterialTin      = "TIN"
+	MaterialTantalum = "TANTALUM"
+	MaterialTungsten = "TUNGSTEN"
+	MaterialGold     = "GOLD"
+	MaterialCobalt   = "COBALT"
+	MaterialLithium  = "LITHIUM"
+	MaterialNickel   = "NICKEL"
+	MaterialGraphite = "GRAPHITE"
+	MaterialLead     = "LEAD"
+)
+
+// originMaterials maps every material with due diligence obligations to whether it passes a smelter or refiner of the RMI list
+var originMaterials = map[string]bool{
+	MaterialTin:      true,
+	MaterialTantalum: true,
+	MaterialTungsten: true,
+	MaterialGold:     true,
+	MaterialCobalt:   true,
+	MaterialLithium:  false,
+	MaterialNickel:   false,
+	MaterialGraphite: false,
+	MaterialLead:     false,
+}
+
+// Risks of Annex II of the OECD Due Diligence Guidance for Responsible Supply Chains of Minerals
+const (
+	RiskSeriousAbuses       = "SERIOUS_ABUSES"         // Torture, forced labour, worst forms of child labour and other gross human rights violations
+	RiskNonStateArmedGroups = "NON_STATE_ARMED_GROUPS" // Direct or indirect support to non-state armed groups
+	RiskSecurityForces      = "SECURITY_FORCES"        // Illegal control, taxation or extortion by public or private security forces
+	RiskBribery             = "BRIBERY"                // Bribery and fraudulent misrepresentation of the origin of minerals
+	RiskMoneyLaundering     = "MONEY_LAUNDERING"
+	RiskTaxesAndRoyalties   = "TAXES_AND_ROYALTIES" // Taxes, fees and royalties not paid to governments
+)
+
+var annexIIRisks = map[string]bool{
+	RiskSeriousAbuses:       true,
+	RiskNonStateArmedGroups: true,
+	RiskSecurityForces:      true,
+	RiskBribery:             true,
+	RiskMoneyLaundering:     true,
+	RiskTaxesAndRoyalties:   true,
+}
+
+// auditStandards are the responsible sourcing standards a mine can be audited against
+var auditStandards = map[string]bool{
+	"CERA_4IN1": true, // Certification of Raw Materials
+	"RMAP":      true, // Responsible Minerals Assurance Process of the RMI
+	"LBMA_RGG":  true, // LBMA Responsible Gold Guidance
+	"RJC_COP":   true, // Responsible Jewellery Council Code of Practices
+	"IRMA":      true, // Initiative for Responsible Mining Assurance
+}
+
+// countryPattern matches ISO 3166-1 alpha-2 country codes, e.g. CD
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// smelterIDPattern matches the smelter and refiner IDs of the RMI list, e.g. CID002082
+var smelterIDPattern = regexp.MustCompile(`^CID[0-9]{6}$`)
+
+// MineOrigin is the origin and due diligence of an asset created with CreateAssetIn, it stays in the private collection of the mine
+type MineOrigin struct {
+	AssetID      string        `json:"assetID"`
+	Material     string        `json:"material"`
+	Country      string        `json:"country"` // ISO 3166-1 alpha-2 code of the mine
+	MineSite     string        `json:"mineSite"`
+	SmelterID    string        `json:"smelterID,omitempty" metadata:",optional"` // RMI smelter or refiner ID, required for 3TG and cobalt
+	Recycled     bool          `json:"recycled,omitempty" metadata:",optional"`  // The material was recovered from waste by a recycler, country and mineSite are those of the recycling plant
+	DueDiligence *DueDiligence `json:"dueDiligence"`
+}
+
+// DueDiligence is the status of the due diligence of a mine following the OECD Due Diligence Guidance
+type DueDiligence struct {
+	CAHRA         bool     `json:"cahra"`                                        // The mine is in a conflict-affected or high-risk area
+	AnnexIIRisks  []string `json:"annexIIRisks"`                                 // Risks of Annex II identified at the mine
+	AuditStandard string   `json:"auditStandard,omitempty" metadata:",optional"` // Standard the mine was audited against, not set if it was not audited
+	AuditReport   string   `json:"auditReport,omitempty" metadata:",optional"`   // URI of the audit report
+}
+
+// MaterialOrigin summarizes the origin of one raw material over all mine inputs of an asset
+// Mine sites and organizations are left out, so suppliers pass it on without disclosing their own suppliers
+type MaterialOrigin struct {
+	Material       string   `json:"material"`
+	Countries      []string `json:"countries"`
+	SmelterIDs     []string `json:"smelterIDs"`
+	CAHRA          bool     `json:"cahra"` // Set if at least one mine is in a conflict-affected or high-risk area
+	AnnexIIRisks   []string `json:"annexIIRisks"`
+	AuditStandards []string `json:"auditStandards"`
+	Unaudited      bool     `json:"unaudited"`                                     // Set if at least one mine was not audited
+	Inputs         int      `json:"inputs"`         // Number of mine inputs of the material
+	RecycledInputs int      `json:"recycledInputs"` // Number of those inputs that were recycled
+}
+
+// GetMineOrigin returns the origin details of an asset the invoking organization created with CreateAssetIn
+func (s *SmartContract) GetMineOrigin(ctx contractapi.TransactionContextInterface, assetID string) (*MineOrigin, error) {
+	var origin *MineOrigin
+	err := getOrgOriginRecord(ctx, mineOriginObjectType, assetID, &origin)
+	if err != nil {
+		return nil, err
+	}
+	return origin, nil
+}
+
+// GetProductOrigins returns the origin of the raw materials of a final product of the invoking organization
+// It is summarized from the mine inputs of the whole lineage when the final product is created
+func (s *SmartContract) GetProductOrigins(ctx contractapi.TransactionContextInterface, assetID string) ([]MaterialOrigin, error) {
+	var origins []MaterialOrigin
+	err := getOrgOriginRecord(ctx, productOriginObjectType, assetID, &origins)
+	if err != nil {
+		return nil, err
+	}
+	return origins, nil
+}
+
+// getOrgOriginRecord reads an origin record of an asset from the private collection of the invoking organization
+func getOrgOriginRecord(ctx contractapi.TransactionContextInterface, objectType string, assetID string, record interface{}) error {
+	err := verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("reading the origin cannot be performed: Error %v", err)
+	}
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	log.Printf("Read origin of %v from collection %v", assetID, orgCollection)
+	recordJSON, err := ctx.GetStub().GetPrivateData(orgCollection, key)
+	if err != nil {
+		return fmt.Errorf("failed to read origin: %v", err)
+	}
+	if recordJSON == nil {
+		return fmt.Errorf("the origin of %v does not exist in collection %v", assetID, orgCollection)
+	}
+	err = json.Unmarshal(recordJSON, record)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return nil
+}
+
+// getProductOrigins reads the origin summary of a final product from a private collection, it returns nil if none of its mine inputs declared an origin
+func getProductOrigins(ctx contractapi.TransactionContextInterface, collection string, assetID string) ([]MaterialOrigin, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(productOriginObjectType, []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	originsJSON, err := ctx.GetStub().GetPrivateData(collection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read origin: %v", err)
+	}
+	if originsJSON == nil {
+		return nil, nil
+	}
+	var origins []MaterialOrigin
+	err = json.Unmarshal(originsJSON, &origins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return origins, nil
+}
+
+// putOrgOriginRecord stores an origin record of an asset in a private collection
+func putOrgOriginRecord(ctx contractapi.TransactionContextInterface, collection string, objectType string, assetID string, record interface{}) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal origin into JSON: %v", err)
+	}
+
+	log.Printf("Put origin of %v into collection %v", assetID, collection)
+	err = ctx.GetStub().PutPrivateData(collection, key, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put origin into private data collecton: %v", err)
+	}
+	return nil
+}
+
+// parseMineOrigin checks the origin of a mine input and sorts the identified risks
+func parseMineOrigin(origin *MineOrigin) error {
+	passesSmelter, ok := originMaterials[origin.Material]
+	if !ok {
+		return fmt.Errorf("material %q has no due diligence obligations, it must be 3TG, cobalt, lithium, nickel, graphite or lead", origin.Material)
+	}
+	if !countryPattern.MatchString(origin.Country) {
+		return fmt.Errorf("country must be an ISO 3166-1 alpha-2 code, got %q", origin.Country)
+	}
+	if len(origin.MineSite) == 0 {
+		return fmt.Errorf("mineSite must be a non-empty string")
+	}
+	if len(origin.SmelterID) > 0 && !smelterIDPattern.MatchString(origin.SmelterID) {
+		return fmt.Errorf("smelterID must be an ID of the RMI smelter and refiner list, got %q", origin.SmelterID)
+	}
+	if passesSmelter && len(origin.SmelterID) == 0 {
+		return fmt.Errorf("smelterID must be given for %v", origin.Material)
+	}
+
+	dueDiligence := origin.DueDiligence
+	if dueDiligence == nil {
+		return fmt.Errorf("dueDiligence must be given")
+	}
+	risks := []string{}
+	for _, risk := range dueDiligence.AnnexIIRisks {
+		if !annexIIRisks[risk] {
+			return fmt.Errorf("unknown Annex II risk %q", risk)
+		}
+		risks = appendUnique(risks, risk)
+	}
+	sort.Strings(risks)
+	dueDiligence.AnnexIIRisks = risks
+
+	if len(dueDiligence.AuditStandard) == 0 {
+		if len(dueDiligence.AuditReport) > 0 {
+			return fmt.Errorf("auditReport needs the auditStandard the mine was audited against")
+		}
+		return nil
+	}
+	if !auditStandards[dueDiligence.AuditStandard] {
+		return fmt.Errorf("unknown auditStandard %q", dueDiligence.AuditStandard)
+	}
+	return validateDocumentURI("auditReport", dueDiligence.AuditReport)
+}
+
+// summarizeOrigin returns the summary of the origin of a mine input, which is passed on with the asset
+func summarizeOrigin(origin *MineOrigin) []MaterialOrigin {
+	summary := MaterialOrigin{
+		Material:       origin.Material,
+		Countries:      []string{origin.Country},
+		SmelterIDs:     []string{},
+		CAHRA:          origin.DueDiligence.CAHRA,
+		AnnexIIRisks:   unionSorted(nil, origin.DueDiligence.AnnexIIRisks),
+		AuditStandards: []string{},
+		Unaudited:      len(origin.DueDiligence.AuditStandard) == 0,
+		Inputs:         1,
+	}
+	if origin.Recycled {
+		summary.RecycledInputs = 1
+	}
+	if len(origin.SmelterID) > 0 {
+		summary.SmelterIDs = append(summary.SmelterIDs, origin.SmelterID)
+	}
+	if !summary.Unaudited {
+		summary.AuditStandards = append(summary.AuditStandards, origin.DueDiligence.AuditStandard)
+	}
+	return []MaterialOrigin{summary}
+}
+
+// mergeOrigins combines the origin summaries of several assets into one summary per material
+// It returns nil if no asset carries an origin, so assets without mine origin keep their previous JSON form
+// Every summary must count its mine inputs, otherwise the recycled content cannot be derived downstream
+func mergeOrigins(origins []MaterialOrigin) ([]MaterialOrigin, error) {
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	byMaterial := make(map[string]*MaterialOrigin)
+	materials := []string{}
+	for _, origin := range origins {
+		if origin.Inputs < 1 || origin.RecycledInputs < 0 || origin.RecycledInputs > origin.Inputs {
+			return nil, fmt.Errorf("the origin summary of %v must count at least one mine input and at most as many recycled inputs, got %d and %d", origin.Material, origin.Inputs, origin.RecycledInputs)
+		}
+		merged, ok := byMaterial[origin.Material]
+		if !ok {
+			merged = &MaterialOrigin{Material: origin.Material}
+			byMaterial[origin.Material] = merged
+			materials = append(materials, origin.Material)
+		}
+		merged.Countries = unionSorted(merged.Countries, origin.Countries)
+		merged.SmelterIDs = unionSorted(merged.SmelterIDs, origin.SmelterIDs)
+		merged.CAHRA = merged.CAHRA || origin.CAHRA
+		merged.AnnexIIRisks = unionSorted(merged.AnnexIIRisks, origin.AnnexIIRisks)
+		merged.AuditStandards = unionSorted(merged.AuditStandards, origin.AuditStandards)
+		merged.Unaudited = merged.Unaudited || origin.Unaudited
+		merged.Inputs += origin.Inputs
+		merged.RecycledInputs += origin.RecycledInputs
+	}
+
+	sort.Strings(materials)
+	summary := []MaterialOrigin{}
+	for _, material := range materials {
+		summary = append(summary, *byMaterial[material])
+	}
+	return summary, nil
+}
+
+// unionSorted returns the sorted values of both lists without duplicates
+func unionSorted(a []string, b []string) []string {
+	union := []string{}
+	for _, value := range append(append([]string{}, a...), b...) {
+		union = appendUnique(union, value)
+	}
+	sort.Strings(union)
+	return union
+}
+
+// appendUnique appends a value to a list if it is not in the list yet
+func appendUnique(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
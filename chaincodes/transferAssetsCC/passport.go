@@ -0,0 +1,544 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const batteryPassportObjectType = "batteryPassport"
+
+// passportCollection holds the slice of battery passports for notified bodies, it is shared by all organizations
+// The mine origins are not stored there, only their hash
+const passportCollection = "passportCollection"
+
+// notifiedBodyAttribute must be set to "true" in the certificate of clients acting for a notified body or market surveillance authority
+const notifiedBodyAttribute = "notifiedBody"
+
+// Categories of batteries of the EU Battery Regulation that need a battery passport
+const (
+	BatteryEV         = "EV"         // Electric vehicle batteries
+	BatteryLMT        = "LMT"        // Light means of transport batteries, e.g. e-bikes
+	BatteryIndustrial = "INDUSTRIAL" // Industrial batteries with a capacity above 2 kWh
+)
+
+// carbonFootprintClasses are the performance classes of the carbon footprint, A is the lowest footprint
+var carbonFootprintClasses = map[string]bool{"A": true, "B": true, "C": true, "D": true, "E": true}
+
+// criticalRawMaterials maps the materials the recycled content has to be declared for to the materials of the mine origins
+var criticalRawMaterials = map[string]string{
+	"Co": MaterialCobalt,
+	"Li": MaterialLithium,
+	"Ni": MaterialNickel,
+	"Pb": MaterialLead,
+}
+
+// BatteryPassport is the public slice of the battery passport of a final product, everyone can read it
+type BatteryPassport struct {
+	AssetID           string                `json:"assetID"`
+	BatteryCategory   string                `json:"batteryCategory"`
+	Chemistry         string                `json:"chemistry"` // e.g. NMC811 or LFP
+	ManufacturerMSPID string                `json:"manufacturerMSPID"`
+	FacilityID        string                `json:"facilityID,omitempty" metadata:",optional"` // Facility registered in the emissions audit chaincode the battery was produced at
+	IssuedAt          string                `json:"issuedAt"`                                  // Time of the transaction that issued the passport
+	CarbonFootprint   *CarbonFootprint      `json:"carbonFootprint"`
+	RecycledContent   map[string]string     `json:"recycledContent"` // Recycled share in percent per critical raw material of the lineage, e.g. {"Co":"16"}
+	DueDiligence      *PassportDueDiligence `json:"dueDiligence"`
+	Performance       *BatteryPerformance   `json:"performance"`
+}
+
+// PassportDueDiligence summarizes the supply chain due diligence over the mine origins of all raw materials of a battery
+// Countries and smelters are left out, they stay in the private collection of the manufacturer
+type PassportDueDiligence struct {
+	Materials      []string `json:"materials"`
+	CAHRA          bool     `json:"cahra"` // Set if at least one mine is in a conflict-affected or high-risk area
+	AnnexIIRisks   []string `json:"annexIIRisks"`
+	AuditStandards []string `json:"auditStandards"`
+	Unaudited      bool     `json:"unaudited"` // Set if at least one mine was not audited
+}
+
+// CarbonFootprint is the cradle-to-gate footprint of a battery, taken from its lineage when the passport is issued
+type CarbonFootprint struct {
+	KgCO2e int    `json:"kgCO2e"`
+	PerKWh string `json:"perKWh"` // KgCO2e per kWh of rated energy, rounded half up to 3 decimal places
+	Class  string `json:"class"`  // Declared performance class from A to E
+}
+
+// BatteryPerformance holds the rated performance and durability values, decimals are given like quantity values, e.g. 75.5
+type BatteryPerformance struct {
+	RatedCapacityAh        string `json:"ratedCapacityAh"`
+	NominalVoltageV        string `json:"nominalVoltageV"`
+	RatedEnergyKWh         string `json:"ratedEnergyKWh"`
+	OriginalPowerW         string `json:"originalPowerW"`
+	ExpectedLifetimeCycles int    `json:"expectedLifetimeCycles"`
+}
+
+// BatteryPassportNotified is the slice of a battery passport for notified bodies and market surveillance authorities
+// It holds the documentation supporting the declarations of the public slice
+type BatteryPassportNotified struct {
+	AssetID                      string            `json:"assetID"`
+	CarbonFootprintStudy         string            `json:"carbonFootprintStudy"`         // URI of the carbon footprint study
+	RecycledContentDocumentation string            `json:"recycledContentDocumentation"` // URI of the documentation of the recycled content
+	TestReports                  []string          `json:"testReports"`                  // URIs of the reports of the conformity tests
+	FootprintStages              []*FootprintStage `json:"footprintStages"`              // Footprint added at every asset of the lineage
+	EmissionsIDs                 []string          `json:"emissionsIDs"`
+	MineInputs                   []string          `json:"mineInputs"`  // Assets of the lineage created with CreateAssetIn
+	OriginsHash                  string            `json:"originsHash"` // SHA-256 of the JSON returned by GetProductOrigins, the manufacturer discloses the origins on request
+}
+
+// BatteryPassportManufacturer is the slice of a battery passport only the manufacturer can read
+type BatteryPassportManufacturer struct {
+	AssetID            string   `json:"assetID"`
+	BatchNumber        string   `json:"batchNumber"`
+	PartNumbers        []string `json:"partNumbers"`        // Part numbers of the components, e.g. for spare parts
+	DismantlingManual  string   `json:"dismantlingManual"`  // URI of the manual for dismantling and repurposing
+	SafetyInstructions string   `json:"safetyInstructions"` // URI of the safety instructions
+	BasedOn            []string `json:"BasedOn"`            // Assets the final product was made of
+}
+
+// IssueBatteryPassport creates the battery passport of a final product of the invoking organization
+// The footprint, the lineage, the manufacturer, the recycled content and the due diligence are taken from the ledger,
+// the remaining declarations are passed in the transient field asset_properties
+func (s *SmartContract) IssueBatteryPassport(ctx contractapi.TransactionContextInterface, assetID string) error {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+	transientPassportJSON, ok := transientMap["asset_properties"]
+	if !ok {
+		return fmt.Errorf("passport not found in the transient map input")
+	}
+
+	type passportTransient struct {
+		BatteryCategory              string              `json:"batteryCategory"`
+		Chemistry                    string              `json:"chemistry"`
+		FacilityID                   string              `json:"facilityID"`
+		CarbonFootprintClass         string              `json:"carbonFootprintClass"`
+		Performance                  *BatteryPerformance `json:"performance"`
+		CarbonFootprintStudy         string              `json:"carbonFootprintStudy"`
+		RecycledContentDocumentation string              `json:"recycledContentDocumentation"`
+		TestReports                  []string            `json:"testReports"`
+		BatchNumber                  string              `json:"batchNumber"`
+		PartNumbers                  []string            `json:"partNumbers"`
+		DismantlingManual            string              `json:"dismantlingManual"`
+		SafetyInstructions           string              `json:"safetyInstructions"`
+	}
+	var passportInput passportTransient
+	err = json.Unmarshal(transientPassportJSON, &passportInput)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	if passportInput.BatteryCategory != BatteryEV && passportInput.BatteryCategory != BatteryLMT && passportInput.BatteryCategory != BatteryIndustrial {
+		return fmt.Errorf("batteryCategory must be %v, %v or %v", BatteryEV, BatteryLMT, BatteryIndustrial)
+	}
+	if len(passportInput.Chemistry) == 0 {
+		return fmt.Errorf("chemistry must be a non-empty string")
+	}
+	if !carbonFootprintClasses[passportInput.CarbonFootprintClass] {
+		return fmt.Errorf("carbonFootprintClass must be one of A, B, C, D or E")
+	}
+	if passportInput.Performance == nil {
+		return fmt.Errorf("performance must be given")
+	}
+	ratedEnergy, err := validatePerformance(passportInput.Performance)
+	if err != nil {
+		return err
+	}
+	documents := [][2]string{
+		{"carbonFootprintStudy", passportInput.CarbonFootprintStudy},
+		{"recycledContentDocumentation", passportInput.RecycledContentDocumentation},
+		{"dismantlingManual", passportInput.DismantlingManual},
+		{"safetyInstructions", passportInput.SafetyInstructions},
+	}
+	for _, uri := range passportInput.TestReports {
+		documents = append(documents, [2]string{"testReports", uri})
+	}
+	for _, document := range documents {
+		err = validateDocumentURI(document[0], document[1])
+		if err != nil {
+			return err
+		}
+	}
+	if len(passportInput.BatchNumber) == 0 {
+		return fmt.Errorf("batchNumber must be a non-empty string")
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("IssueBatteryPassport cannot be performed: Error %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	orgCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	// Only OEMs create final products
+	rightsJSON, err := ctx.GetStub().GetPrivateData(orgCollection, "RIGHTS")
+	if err != nil {
+		return fmt.Errorf("failed to get rights: %v", err)
+	}
+	var right *Rights
+	if rightsJSON != nil {
+		err = json.Unmarshal(rightsJSON, &right)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+	}
+	if right == nil || right.Role != "OEM" {
+		return fmt.Errorf("only OEMs can issue battery passports")
+	}
+
+	asset, err := getFinalAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if asset.ManufacturerMSPID != clientMSPID {
+		return fmt.Errorf("the final product %v was not manufactured by %v", assetID, clientMSPID)
+	}
+	existing, err := getBatteryPassport(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("the battery passport of %v already exists", assetID)
+	}
+	if len(passportInput.FacilityID) > 0 {
+		err = verifyFacility(ctx, passportInput.FacilityID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Fill the passport from the lineage, it must be complete to declare the footprint
+	err = resolveFootprint(ctx, asset)
+	if err != nil {
+		return err
+	}
+	lineage, err := getLineage(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if len(lineage.Dangling) > 0 || len(lineage.Cycles) > 0 {
+		return fmt.Errorf("the lineage of %v is inconsistent, dangling assets %v, cycles %v", assetID, lineage.Dangling, lineage.Cycles)
+	}
+	mineInputs := []string{}
+	for _, node := range lineage.Nodes {
+		if node.Role == LineageMineInput {
+			mineInputs = append(mineInputs, node.AssetID)
+		}
+	}
+	origins, err := getProductOrigins(ctx, orgCollection, assetID)
+	if err != nil {
+		return err
+	}
+	if origins == nil {
+		return fmt.Errorf("no mine input of the lineage of %v declared its origin, the recycled content and due diligence cannot be derived", assetID)
+	}
+	recycledContent, err := deriveRecycledContent(origins)
+	if err != nil {
+		return err
+	}
+	originsJSON, err := json.Marshal(origins)
+	if err != nil {
+		return fmt.Errorf("failed to marshal origins into JSON: %v", err)
+	}
+	originsHash := sha256.Sum256(originsJSON)
+	perKWh := new(big.Rat).Quo(big.NewRat(int64(asset.GHG), 1), ratedEnergy)
+	txTime, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	passport := BatteryPassport{
+		AssetID:           assetID,
+		BatteryCategory:   passportInput.BatteryCategory,
+		Chemistry:         passportInput.Chemistry,
+		ManufacturerMSPID: clientMSPID,
+		FacilityID:        passportInput.FacilityID,
+		IssuedAt:          txTime.Format(time.RFC3339),
+		CarbonFootprint: &CarbonFootprint{
+			KgCO2e: asset.GHG,
+			PerKWh: perKWh.FloatString(3),
+			Class:  passportInput.CarbonFootprintClass,
+		},
+		RecycledContent: recycledContent,
+		DueDiligence:    summarizeDueDiligence(origins),
+		Performance:     passportInput.Performance,
+	}
+	testReports := passportInput.TestReports
+	if testReports == nil {
+		testReports = []string{}
+	}
+	notified := BatteryPassportNotified{
+		AssetID:                      assetID,
+		CarbonFootprintStudy:         passportInput.CarbonFootprintStudy,
+		RecycledContentDocumentation: passportInput.RecycledContentDocumentation,
+		TestReports:                  testReports,
+		FootprintStages:              asset.Stages,
+		EmissionsIDs:                 asset.EmissionsIDs,
+		MineInputs:                   mineInputs,
+		OriginsHash:                  hex.EncodeToString(originsHash[:]),
+	}
+	partNumbers := passportInput.PartNumbers
+	if partNumbers == nil {
+		partNumbers = []string{}
+	}
+	manufacturer := BatteryPassportManufacturer{
+		AssetID:            assetID,
+		BatchNumber:        passportInput.BatchNumber,
+		PartNumbers:        partNumbers,
+		DismantlingManual:  passportInput.DismantlingManual,
+		SafetyInstructions: passportInput.SafetyInstructions,
+		BasedOn:            asset.BasedOn,
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(batteryPassportObjectType, []string{assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	passportJSON, err := json.Marshal(passport)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passport into JSON: %v", err)
+	}
+	notifiedJSON, err := json.Marshal(notified)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passport into JSON: %v", err)
+	}
+	manufacturerJSON, err := json.Marshal(manufacturer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passport into JSON: %v", err)
+	}
+
+	log.Printf("IssueBatteryPassport Put: asset %v, collections %v and %v", assetID, passportCollection, orgCollection)
+	err = ctx.GetStub().PutState(key, passportJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put passport onto world state: %v", err)
+	}
+	err = ctx.GetStub().PutPrivateData(passportCollection, key, notifiedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put passport into private data collecton: %v", err)
+	}
+	err = ctx.GetStub().PutPrivateData(orgCollection, key, manufacturerJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put passport into private data collecton: %v", err)
+	}
+	return nil
+}
+
+// GetBatteryPassport returns the public slice of the battery passport of a final product
+func (s *SmartContract) GetBatteryPassport(ctx contractapi.TransactionContextInterface, assetID string) (*BatteryPassport, error) {
+	passport, err := getBatteryPassport(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if passport == nil {
+		return nil, fmt.Errorf("the battery passport of %v does not exist", assetID)
+	}
+	return passport, nil
+}
+
+// GetBatteryPassportNotified returns the slice of a battery passport for notified bodies, it can also be read by the manufacturer
+func (s *SmartContract) GetBatteryPassportNotified(ctx contractapi.TransactionContextInterface, assetID string) (*BatteryPassportNotified, error) {
+	passport, err := s.GetBatteryPassport(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetBatteryPassportNotified cannot be performed: Error %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	if clientMSPID != passport.ManufacturerMSPID {
+		err = ctx.GetClientIdentity().AssertAttributeValue(notifiedBodyAttribute, "true")
+		if err != nil {
+			return nil, fmt.Errorf("only notified bodies and the manufacturer can read this slice of the battery passport: %v", err)
+		}
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(batteryPassportObjectType, []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	notifiedJSON, err := ctx.GetStub().GetPrivateData(passportCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passport: %v", err)
+	}
+	if notifiedJSON == nil {
+		return nil, fmt.Errorf("the battery passport of %v does not exist in collection %v", assetID, passportCollection)
+	}
+	var notified *BatteryPassportNotified
+	err = json.Unmarshal(notifiedJSON, &notified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return notified, nil
+}
+
+// GetBatteryPassportManufacturer returns the slice of a battery passport only the manufacturer can read
+func (s *SmartContract) GetBatteryPassportManufacturer(ctx contractapi.TransactionContextInterface, assetID string) (*BatteryPassportManufacturer, error) {
+	passport, err := s.GetBatteryPassport(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetBatteryPassportManufacturer cannot be performed: Error %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	if clientMSPID != passport.ManufacturerMSPID {
+		return nil, fmt.Errorf("only the manufacturer %v can read this slice of the battery passport", passport.ManufacturerMSPID)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(batteryPassportObjectType, []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	orgCollection := clientMSPID + "PrivateCollection"
+	manufacturerJSON, err := ctx.GetStub().GetPrivateData(orgCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passport: %v", err)
+	}
+	if manufacturerJSON == nil {
+		return nil, fmt.Errorf("the battery passport of %v does not exist in collection %v", assetID, orgCollection)
+	}
+	var manufacturer *BatteryPassportManufacturer
+	err = json.Unmarshal(manufacturerJSON, &manufacturer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return manufacturer, nil
+}
+
+// getBatteryPassport reads the public slice of a battery passport, it returns nil if the passport does not exist
+func getBatteryPassport(ctx contractapi.TransactionContextInterface, assetID string) (*BatteryPassport, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(batteryPassportObjectType, []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	passportJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passport: %v", err)
+	}
+	if passportJSON == nil {
+		return nil, nil
+	}
+	var passport *BatteryPassport
+	err = json.Unmarshal(passportJSON, &passport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return passport, nil
+}
+
+// getFinalAsset reads an asset created by FinalProduct from the world state
+func getFinalAsset(ctx contractapi.TransactionContextInterface, assetID string) (*FinalAsset, error) {
+	assetJSON, err := ctx.GetStub().GetState(assetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset: %v", err)
+	}
+	if assetJSON == nil {
+		return nil, fmt.Errorf("the asset %v does not exist on the world state", assetID)
+	}
+	var asset *FinalAsset
+	err = json.Unmarshal(assetJSON, &asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	// Only FinalProduct stores the footprint stages
+	if asset.Stages == nil {
+		return nil, fmt.Errorf("the asset %v is not a final product", assetID)
+	}
+	return asset, nil
+}
+
+// deriveRecycledContent returns the recycled share in percent of every critical raw material in the origins of a battery
+// The share is the part of the mine inputs of the material that were recycled, rounded half up to 2 decimal places
+// Materials without mine inputs in the lineage are not declared
+func deriveRecycledContent(origins []MaterialOrigin) (map[string]string, error) {
+	recycledContent := make(map[string]string)
+	for symbol, material := range criticalRawMaterials {
+		for _, origin := range origins {
+			if origin.Material != material {
+				continue
+			}
+			if origin.Inputs < 1 {
+				return nil, fmt.Errorf("the origin summary of %v counts no mine inputs, its recycled content cannot be derived", material)
+			}
+			share := new(big.Rat).SetFrac64(int64(100*origin.RecycledInputs), int64(origin.Inputs))
+			percent := strings.TrimRight(share.FloatString(2), "0")
+			recycledContent[symbol] = strings.TrimSuffix(percent, ".")
+		}
+	}
+	return recycledContent, nil
+}
+
+// summarizeDueDiligence combines the due diligence of the origins of all materials of a battery
+func summarizeDueDiligence(origins []MaterialOrigin) *PassportDueDiligence {
+	dueDiligence := &PassportDueDiligence{
+		Materials:      []string{},
+		AnnexIIRisks:   []string{},
+		AuditStandards: []string{},
+	}
+	for _, origin := range origins {
+		dueDiligence.Materials = appendUnique(dueDiligence.Materials, origin.Material)
+		dueDiligence.CAHRA = dueDiligence.CAHRA || origin.CAHRA
+		dueDiligence.AnnexIIRisks = unionSorted(dueDiligence.AnnexIIRisks, origin.AnnexIIRisks)
+		dueDiligence.AuditStandards = unionSorted(dueDiligence.AuditStandards, origin.AuditStandards)
+		dueDiligence.Unaudited = dueDiligence.Unaudited || origin.Unaudited
+	}
+	sort.Strings(dueDiligence.Materials)
+	return dueDiligence
+}
+
+// validatePerformance checks the performance values and returns the rated energy, which the footprint is declared per
+func validatePerformance(performance *BatteryPerformance) (*big.Rat, error) {
+	values := [][2]string{
+		{"ratedCapacityAh", performance.RatedCapacityAh},
+		{"nominalVoltageV", performance.NominalVoltageV},
+		{"ratedEnergyKWh", performance.RatedEnergyKWh},
+		{"originalPowerW", performance.OriginalPowerW},
+	}
+	for _, value := range values {
+		if !quantityValuePattern.MatchString(value[1]) {
+			return nil, fmt.Errorf("%v must be a non-negative decimal with at most %d decimal places, got %q", value[0], quantityDecimals, value[1])
+		}
+	}
+	if performance.ExpectedLifetimeCycles <= 0 {
+		return nil, fmt.Errorf("expectedLifetimeCycles must be larger than 0")
+	}
+	ratedEnergy, _ := new(big.Rat).SetString(performance.RatedEnergyKWh)
+	if ratedEnergy.Sign() == 0 {
+		return nil, fmt.Errorf("ratedEnergyKWh must be larger than 0")
+	}
+	return ratedEnergy, nil
+}
+
+// validateDocumentURI checks that a referenced document is given as absolute URI, e.g. https://example.com/report.pdf
+func validateDocumentURI(field string, uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() {
+		return fmt.Errorf("%v must be an absolute URI, got %q", field, uri)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// quantityDecimals is the number of decimal places of a quantity, values are calculated in millionths of their unit
+const quantityDecimals = 6
+
+// Units of quantities, the same units are used by the emissions audit chaincode
+const (
+	UnitGramCO2e  = "gCO2e"
+	UnitKgCO2e    = "kgCO2e"
+	UnitTonneCO2e = "tCO2e"
+	UnitKg        = "kg"
+	UnitTonne     = "t"
+	UnitPiece     = "pcs"
+	UnitKWh       = "kWh"
+	UnitMWh       = "MWh"
+	UnitLitre     = "l"
+	UnitCubicM    = "m3"
+	UnitKm        = "km"
+	UnitTonneKm   = "tkm"
+)
+
+// quantityUnits lists all units a quantity can be given in
+var quantityUnits = map[string]bool{
+	UnitGramCO2e:  true,
+	UnitKgCO2e:    true,
+	UnitTonneCO2e: true,
+	UnitKg:        true,
+	UnitTonne:     true,
+	UnitPiece:     true,
+	UnitKWh:       true,
+	UnitMWh:       true,
+	UnitLitre:     true,
+	UnitCubicM:    true,
+	UnitKm:        true,
+	UnitTonneKm:   true,
+}
+
+// quantityValuePattern matches non-negative decimals with up to quantityDecimals decimal places
+var quantityValuePattern = regexp.MustCompile(`^(0|[1-9][0-9]*)(\.[0-9]{1,6})?$`)
+
+// Quantity is a non-negative fixed-point decimal with an explicit unit, e.g. 3 pcs
+// The value is kept as a decimal string, so it is exact and identical on every peer. No floating-point arithmetic is used on it
+type Quantity struct {
+	Unit  string `json:"unit"`
+	Value string `json:"value"` // Decimal with up to 6 decimal places and without trailing zeros, e.g. 12.5
+}
+
+// UnmarshalJSON also accepts a plain integer as number of pieces, which is how quantities were given before they had a unit
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '-' || (trimmed[0] >= '0' && trimmed[0] <= '9')) {
+		var number json.Number
+		err := json.Unmarshal(trimmed, &number)
+		if err != nil {
+			return err
+		}
+		*q = Quantity{Unit: UnitPiece, Value: number.String()}
+		return nil
+	}
+
+	type quantityFields Quantity
+	var fields quantityFields
+	err := json.Unmarshal(trimmed, &fields)
+	if err != nil {
+		return err
+	}
+	*q = Quantity(fields)
+	return nil
+}
+
+// parseQuantity checks a quantity and returns it in its canonical form, so equal quantities are marshalled into equal JSON
+func parseQuantity(q Quantity) (Quantity, error) {
+	units, err := q.millionths()
+	if err != nil {
+		return Quantity{}, err
+	}
+	return newQuantity(units, q.Unit)
+}
+
+// newQuantity formats a number of millionths of a unit as quantity, it fails if the number is out of range
+func newQuantity(units *big.Int, unit string) (Quantity, error) {
+	if !quantityUnits[unit] {
+		return Quantity{}, fmt.Errorf("unknown unit %s", unit)
+	}
+	if units.Sign() < 0 {
+		return Quantity{}, fmt.Errorf("quantity must not be negative")
+	}
+	if !units.IsInt64() {
+		return Quantity{}, fmt.Errorf("quantity exceeds the supported range of %s", unit)
+	}
+
+	digits := units.String()
+	if len(digits) <= quantityDecimals {
+		digits = strings.Repeat("0", quantityDecimals-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-quantityDecimals]
+	fraction := strings.TrimRight(digits[len(digits)-quantityDecimals:], "0")
+	if len(fraction) == 0 {
+		return Quantity{Unit: unit, Value: whole}, nil
+	}
+	return Quantity{Unit: unit, Value: whole + "." + fraction}, nil
+}
+
+// millionths returns the value of the quantity in millionths of its unit
+func (q Quantity) millionths() (*big.Int, error) {
+	if !quantityUnits[q.Unit] {
+		return nil, fmt.Errorf("unknown unit %s", q.Unit)
+	}
+	if !quantityValuePattern.MatchString(q.Value) {
+		return nil, fmt.Errorf("quantity %s must be a non-negative decimal with at most %d decimal places", q.Value, quantityDecimals)
+	}
+
+	whole, fraction, _ := strings.Cut(q.Value, ".")
+	fraction += strings.Repeat("0", quantityDecimals-len(fraction))
+	units, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok || !units.IsInt64() {
+		return nil, fmt.Errorf("quantity %s exceeds the supported range of %s", q.Value, q.Unit)
+	}
+	return units, nil
+}
+
+// pieces returns the number of pieces of a quantity, assets are counted individually so only whole positive pieces are accepted
+func (q Quantity) pieces() (int, error) {
+	if q.Unit != UnitPiece {
+		return 0, fmt.Errorf("quantity must be given in %s, got %s", UnitPiece, q.Unit)
+	}
+	units, err := q.millionths()
+	if err != nil {
+		return 0, err
+	}
+	count, remainder := new(big.Int).QuoRem(units, new(big.Int).Exp(big.NewInt(10), big.NewInt(quantityDecimals), nil), new(big.Int))
+	if remainder.Sign() != 0 {
+		return 0, fmt.Errorf("quantity of %s %s is not a whole number of pieces", q.Value, q.Unit)
+	}
+	if count.Sign() == 0 {
+		return 0, fmt.Errorf("quantity of %s %s must be a positive number of pieces", q.Value, q.Unit)
+	}
+	if count.Cmp(big.NewInt(math.MaxInt32)) > 0 {
+		return 0, fmt.Errorf("quantity of %s %s exceeds the supported number of pieces", q.Value, q.Unit)
+	}
+	return int(count.Int64()), nil
+}
+
+// legacyPieces returns a whole number of pieces as plain integer, which is how quantities were stored before they had a unit
+func (q Quantity) legacyPieces() (int, bool) {
+	if q.Unit != UnitPiece || strings.Contains(q.Value, ".") {
+		return 0, false
+	}
+	count, err := strconv.Atoi(q.Value)
+	return count, err == nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   Quantity
+		want    Quantity
+		wantErr bool
+	}{
+		{name: "whole pieces", input: Quantity{Unit: UnitPiece, Value: "3"}, want: Quantity{Unit: UnitPiece, Value: "3"}},
+		{name: "trailing zeros are removed", input: Quantity{Unit: UnitKg, Value: "2.500"}, want: Quantity{Unit: UnitKg, Value: "2.5"}},
+		{name: "zero fraction is removed", input: Quantity{Unit: UnitKg, Value: "7.000000"}, want: Quantity{Unit: UnitKg, Value: "7"}},
+		{name: "six decimal places", input: Quantity{Unit: UnitKgCO2e, Value: "0.000001"}, want: Quantity{Unit: UnitKgCO2e, Value: "0.000001"}},
+		{name: "zero", input: Quantity{Unit: UnitKWh, Value: "0"}, want: Quantity{Unit: UnitKWh, Value: "0"}},
+		{name: "seven decimal places", input: Quantity{Unit: UnitKg, Value: "0.0000001"}, wantErr: true},
+		{name: "negative", input: Quantity{Unit: UnitKg, Value: "-1"}, wantErr: true},
+		{name: "leading zero", input: Quantity{Unit: UnitKg, Value: "01"}, wantErr: true},
+		{name: "exponent", input: Quantity{Unit: UnitKg, Value: "1e3"}, wantErr: true},
+		{name: "empty value", input: Quantity{Unit: UnitKg, Value: ""}, wantErr: true},
+		{name: "unknown unit", input: Quantity{Unit: "lb", Value: "1"}, wantErr: true},
+		{name: "out of range", input: Quantity{Unit: UnitKg, Value: "9223372036855"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseQuantity(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseQuantity(%v) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseQuantity(%v) failed: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseQuantity(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Quantity
+		wantErr bool
+	}{
+		{name: "object", input: `{"unit":"kg","value":"1.5"}`, want: Quantity{Unit: UnitKg, Value: "1.5"}},
+		{name: "plain integer is read as pieces", input: `3`, want: Quantity{Unit: UnitPiece, Value: "3"}},
+		{name: "plain integer with spaces", input: ` 12 `, want: Quantity{Unit: UnitPiece, Value: "12"}},
+		{name: "string", input: `"3"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Quantity
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unmarshalling %s = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unmarshalling %s failed: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("unmarshalling %s = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityPieces(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   Quantity
+		want    int
+		wantErr bool
+	}{
+		{name: "whole pieces", input: Quantity{Unit: UnitPiece, Value: "4"}, want: 4},
+		{name: "zero fraction", input: Quantity{Unit: UnitPiece, Value: "4.0"}, want: 4},
+		{name: "fraction of a piece", input: Quantity{Unit: UnitPiece, Value: "1.5"}, wantErr: true},
+		{name: "zero pieces", input: Quantity{Unit: UnitPiece, Value: "0"}, wantErr: true},
+		{name: "other unit", input: Quantity{Unit: UnitKg, Value: "4"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.input.pieces()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("pieces of %v = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pieces of %v failed: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("pieces of %v = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityLegacyPieces(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  Quantity
+		want   int
+		wantOK bool
+	}{
+		{name: "whole pieces", input: Quantity{Unit: UnitPiece, Value: "3"}, want: 3, wantOK: true},
+		{name: "fraction", input: Quantity{Unit: UnitPiece, Value: "0.5"}},
+		{name: "other unit", input: Quantity{Unit: UnitKg, Value: "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.input.legacyPieces()
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("legacyPieces of %v = %v, %v, want %v, %v", tt.input, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}